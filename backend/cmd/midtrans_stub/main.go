@@ -0,0 +1,306 @@
+// Command midtrans_stub is a local stand-in for the Midtrans Snap and Core
+// APIs, for development and end-to-end tests without a sandbox account.
+// Point MIDTRANS_API_URL at it and MIDTRANS_SNAP_URL at its /snap path, then
+// settle orders from the payment page it serves or with
+// POST /stub/orders/:order_id/:status, which sends a signed notification to
+// the API callback like Midtrans does.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Julianarwansah/sistemcharging/backend/internal/config"
+	"github.com/Julianarwansah/sistemcharging/backend/internal/gateway"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type order struct {
+	OrderID           string
+	TransactionID     string
+	GrossAmount       string
+	PaymentType       string
+	Bank              string
+	VANumber          string
+	QRString          string
+	TransactionStatus string
+	ExpiresAt         time.Time
+}
+
+type stub struct {
+	serverKey       string
+	baseURL         string
+	notificationURL string
+
+	mu     sync.Mutex
+	orders map[string]*order
+	tokens map[string]string // Snap token to order ID
+}
+
+func main() {
+	cfg := config.Load()
+	port := os.Getenv("STUB_PORT")
+	if port == "" {
+		port = "8090"
+	}
+	notificationURL := os.Getenv("STUB_NOTIFICATION_URL")
+	if notificationURL == "" {
+		notificationURL = "http://localhost:" + cfg.ServerPort + "/api/v1/payments/callback/midtrans"
+	}
+	serverKey := cfg.MidtransServerKey
+	if serverKey == "" {
+		serverKey = "SB-Mid-server-stub"
+	}
+
+	s := &stub{
+		serverKey:       serverKey,
+		baseURL:         "http://localhost:" + port,
+		notificationURL: notificationURL,
+		orders:          map[string]*order{},
+		tokens:          map[string]string{},
+	}
+
+	r := gin.Default()
+	api := r.Group("", s.requireServerKey)
+	{
+		api.POST("/snap/v1/transactions", s.createSnap)
+		api.POST("/v2/charge", s.charge)
+		api.GET("/v2/:order_id/status", s.status)
+	}
+	r.GET("/snap/v4/redirection/:token", s.paymentPage)
+	r.POST("/stub/orders/:order_id/:status", s.settle)
+
+	log.Printf("🧪 Midtrans stub on :%s, notifying %s (server key %q)", port, notificationURL, serverKey)
+	if err := r.Run(":" + port); err != nil {
+		log.Fatalf("Failed to start stub: %v", err)
+	}
+}
+
+func (s *stub) requireServerKey(c *gin.Context) {
+	user, _, ok := c.Request.BasicAuth()
+	if !ok || user != s.serverKey {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"status_code":    "401",
+			"status_message": "Access denied, please check client or server key",
+		})
+		return
+	}
+	c.Next()
+}
+
+type transactionRequest struct {
+	PaymentType        string `json:"payment_type"`
+	TransactionDetails struct {
+		OrderID     string `json:"order_id"`
+		GrossAmount int64  `json:"gross_amount"`
+	} `json:"transaction_details"`
+	BankTransfer struct {
+		Bank string `json:"bank"`
+	} `json:"bank_transfer"`
+}
+
+func (s *stub) newOrder(req transactionRequest) (*order, error) {
+	details := req.TransactionDetails
+	if details.OrderID == "" || details.GrossAmount <= 0 {
+		return nil, fmt.Errorf("transaction_details.order_id and gross_amount are required")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.orders[details.OrderID]; exists {
+		return nil, fmt.Errorf("transaction_details.order_id has already been taken")
+	}
+	o := &order{
+		OrderID:           details.OrderID,
+		TransactionID:     uuid.NewString(),
+		GrossAmount:       strconv.FormatInt(details.GrossAmount, 10) + ".00",
+		PaymentType:       req.PaymentType,
+		TransactionStatus: "pending",
+		ExpiresAt:         time.Now().Add(time.Hour),
+	}
+	s.orders[o.OrderID] = o
+	return o, nil
+}
+
+// newToken registers a payment page for an order.
+func (s *stub) newToken(o *order) string {
+	token := uuid.NewString()
+	s.mu.Lock()
+	s.tokens[token] = o.OrderID
+	s.mu.Unlock()
+	return token
+}
+
+func (s *stub) createSnap(c *gin.Context) {
+	var req transactionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error_messages": []string{err.Error()}})
+		return
+	}
+	o, err := s.newOrder(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error_messages": []string{err.Error()}})
+		return
+	}
+
+	token := s.newToken(o)
+	c.JSON(http.StatusCreated, gin.H{
+		"token":        token,
+		"redirect_url": s.baseURL + "/snap/v4/redirection/" + token,
+	})
+}
+
+func (s *stub) charge(c *gin.Context) {
+	var req transactionRequest
+	if err := c.ShouldBindJSON(&req); err != nil || (req.PaymentType != "bank_transfer" && req.PaymentType != "qris") {
+		c.JSON(http.StatusOK, gin.H{"status_code": "400", "status_message": "Only bank_transfer and qris are supported by the stub"})
+		return
+	}
+	o, err := s.newOrder(req)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"status_code": "406", "status_message": err.Error()})
+		return
+	}
+	expiryTime := o.ExpiresAt.In(time.FixedZone("WIB", 7*3600)).Format("2006-01-02 15:04:05")
+
+	// The QR code action opens the stub payment page, standing in for the
+	// customer scanning the code
+	if req.PaymentType == "qris" {
+		s.mu.Lock()
+		o.QRString = "00020101021226620014COM.GO-JEK.WWW" + o.TransactionID
+		s.mu.Unlock()
+		token := s.newToken(o)
+		c.JSON(http.StatusOK, gin.H{
+			"status_code":        "201",
+			"status_message":     "QRIS transaction is created",
+			"transaction_id":     o.TransactionID,
+			"order_id":           o.OrderID,
+			"gross_amount":       o.GrossAmount,
+			"payment_type":       o.PaymentType,
+			"transaction_status": o.TransactionStatus,
+			"qr_string":          o.QRString,
+			"actions":            []gin.H{{"name": "generate-qr-code", "method": "GET", "url": s.baseURL + "/snap/v4/redirection/" + token}},
+			"expiry_time":        expiryTime,
+		})
+		return
+	}
+
+	s.mu.Lock()
+	o.Bank = req.BankTransfer.Bank
+	o.VANumber = fmt.Sprintf("8808%012d", rand.Int63n(1e12))
+	s.mu.Unlock()
+
+	c.JSON(http.StatusOK, gin.H{
+		"status_code":        "201",
+		"status_message":     "Success, Bank Transfer transaction is created",
+		"transaction_id":     o.TransactionID,
+		"order_id":           o.OrderID,
+		"gross_amount":       o.GrossAmount,
+		"payment_type":       o.PaymentType,
+		"transaction_status": o.TransactionStatus,
+		"va_numbers":         []gin.H{{"bank": o.Bank, "va_number": o.VANumber}},
+		"expiry_time":        expiryTime,
+	})
+}
+
+// notification builds the signed notification body of an order, which is
+// also what the status API returns.
+func (s *stub) notification(o *order) gateway.MidtransNotification {
+	statusCode := "201"
+	switch o.TransactionStatus {
+	case "settlement", "capture":
+		statusCode = "200"
+	case "deny", "cancel", "expire", "failure":
+		statusCode = "202"
+	}
+	return gateway.MidtransNotification{
+		OrderID:           o.OrderID,
+		TransactionID:     o.TransactionID,
+		StatusCode:        statusCode,
+		GrossAmount:       o.GrossAmount,
+		SignatureKey:      gateway.MidtransSignature(o.OrderID, statusCode, o.GrossAmount, s.serverKey),
+		TransactionStatus: o.TransactionStatus,
+		FraudStatus:       "accept",
+		PaymentType:       o.PaymentType,
+	}
+}
+
+func (s *stub) status(c *gin.Context) {
+	s.mu.Lock()
+	o, ok := s.orders[c.Param("order_id")]
+	var n gateway.MidtransNotification
+	if ok {
+		n = s.notification(o)
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		c.JSON(http.StatusOK, gin.H{"status_code": "404", "status_message": "Transaction doesn't exist."})
+		return
+	}
+	c.JSON(http.StatusOK, n)
+}
+
+func (s *stub) paymentPage(c *gin.Context) {
+	s.mu.Lock()
+	orderID, ok := s.tokens[c.Param("token")]
+	o := s.orders[orderID]
+	s.mu.Unlock()
+	if !ok {
+		c.String(http.StatusNotFound, "Unknown token")
+		return
+	}
+
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.String(http.StatusOK, `<!doctype html>
+<html><body style="font-family:sans-serif">
+<h2>Midtrans stub</h2>
+<p>Order %[1]s, Rp %[2]s, status <b>%[3]s</b></p>
+<form method="post" action="/stub/orders/%[1]s/settlement"><button>Bayar</button></form>
+<form method="post" action="/stub/orders/%[1]s/deny"><button>Tolak</button></form>
+<form method="post" action="/stub/orders/%[1]s/expire"><button>Kedaluwarsa</button></form>
+</body></html>`, o.OrderID, o.GrossAmount, o.TransactionStatus)
+}
+
+// settle moves an order to the given status and notifies the API.
+func (s *stub) settle(c *gin.Context) {
+	status := c.Param("status")
+	switch status {
+	case "settlement", "deny", "cancel", "expire", "failure":
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported status " + status})
+		return
+	}
+
+	s.mu.Lock()
+	o, ok := s.orders[c.Param("order_id")]
+	var n gateway.MidtransNotification
+	if ok {
+		o.TransactionStatus = status
+		n = s.notification(o)
+	}
+	s.mu.Unlock()
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown order"})
+		return
+	}
+
+	body, _ := json.Marshal(n)
+	resp, err := http.Post(s.notificationURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	resp.Body.Close()
+
+	c.JSON(http.StatusOK, gin.H{"order_id": o.OrderID, "transaction_status": status, "callback_status": resp.StatusCode})
+}
@@ -0,0 +1,96 @@
+// Command reconcile cross-checks payments, charging sessions, wallet
+// transactions, user balances and the payment providers' records, and
+// prints every mismatch. With -fix it applies the safe fixes. It exits with
+// status 1 while issues remain, so it can run from cron.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/Julianarwansah/sistemcharging/backend/internal/config"
+	"github.com/Julianarwansah/sistemcharging/backend/internal/database"
+	"github.com/Julianarwansah/sistemcharging/backend/internal/gateway"
+	"github.com/Julianarwansah/sistemcharging/backend/internal/reconcile"
+)
+
+func main() {
+	days := flag.Int("days", 30, "check payments and sessions of the last `n` days, 0 for all")
+	fix := flag.Bool("fix", false, "apply the safe fixes")
+	checkGateway := flag.Bool("gateway", true, "check payments against the payment providers")
+	asJSON := flag.Bool("json", false, "print the report as JSON")
+	flag.Parse()
+
+	cfg := config.Load()
+	db := database.Connect(cfg)
+
+	now := time.Now()
+	opts := reconcile.Options{Fix: *fix}
+	if *days > 0 {
+		opts.Since = now.AddDate(0, 0, -*days)
+	}
+
+	// The dummy provider keeps its records in the server's memory, so only
+	// real providers can be checked from here
+	if *checkGateway {
+		var providers []gateway.Provider
+		if cfg.MidtransServerKey != "" {
+			providers = append(providers, gateway.NewMidtrans(cfg.MidtransServerKey, cfg.MidtransAPIURL, cfg.MidtransSnapURL))
+		}
+		if cfg.XenditSecretKey != "" {
+			providers = append(providers, gateway.NewXendit(cfg.XenditSecretKey, cfg.XenditCallbackToken, cfg.XenditAPIURL, cfg.PaymentRedirectURL))
+		}
+		payments, err := gateway.NewRegistry(providers, nil)
+		if err != nil {
+			log.Fatalf("Failed to set up payment providers: %v", err)
+		}
+		opts.Payments = payments
+	}
+
+	report, err := reconcile.Run(context.Background(), db, opts, now)
+	if err != nil {
+		log.Fatalf("Reconciliation failed: %v", err)
+	}
+
+	if *asJSON {
+		out, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(out))
+	} else {
+		for _, issue := range report.Issues {
+			state := "manual"
+			switch {
+			case issue.Fixed:
+				state = "fixed"
+			case issue.FixError != "":
+				state = "fix failed: " + issue.FixError
+			case issue.Fixable:
+				state = "fixable"
+			}
+			fmt.Printf("%-26s %s [%s]\n", issue.Kind, describe(issue), state)
+		}
+		fmt.Printf("Checked %d session(s) and %d gateway payment(s): %d issue(s), %d fixed\n",
+			report.Sessions, report.GatewayChecked, len(report.Issues), report.Fixed)
+	}
+
+	if !report.OK {
+		os.Exit(1)
+	}
+}
+
+func describe(issue reconcile.Issue) string {
+	text := issue.Detail
+	switch {
+	case issue.PaymentID != nil:
+		text = "payment " + issue.PaymentID.String() + ": " + text
+	case issue.SessionID != nil:
+		text = "session " + issue.SessionID.String() + ": " + text
+	case issue.Account != "":
+		text = issue.Account + ": " + text
+	}
+	return text
+}
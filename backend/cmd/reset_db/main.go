@@ -6,6 +6,8 @@ import (
 	"github.com/Julianarwansah/sistemcharging/backend/internal/config"
 	"github.com/Julianarwansah/sistemcharging/backend/internal/database"
 	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
+	"github.com/Julianarwansah/sistemcharging/backend/internal/services"
+	"gorm.io/gorm"
 )
 
 func main() {
@@ -18,7 +20,11 @@ func main() {
 	db.Exec("TRUNCATE TABLE payments CASCADE")
 	db.Exec("TRUNCATE TABLE wallet_transactions CASCADE")
 
-	db.Model(&models.User{}).Where("1 = 1").Update("balance", 0)
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		return services.ResetWallets(tx, "Reset saldo (reset_db)")
+	}); err != nil {
+		log.Fatalf("Failed to reset balances: %v", err)
+	}
 	db.Model(&models.Connector{}).Where("1 = 1").Update("status", "available")
 
 	log.Println("✅ Data reset successful!")
@@ -1,15 +1,24 @@
 package main
 
 import (
+	"context"
 	"log"
+	"time"
 
+	"github.com/Julianarwansah/sistemcharging/backend/internal/autotopup"
 	"github.com/Julianarwansah/sistemcharging/backend/internal/config"
 	"github.com/Julianarwansah/sistemcharging/backend/internal/database"
+	"github.com/Julianarwansah/sistemcharging/backend/internal/gateway"
 	"github.com/Julianarwansah/sistemcharging/backend/internal/handlers"
+	"github.com/Julianarwansah/sistemcharging/backend/internal/mailer"
 	"github.com/Julianarwansah/sistemcharging/backend/internal/middleware"
+	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
 	mqttclient "github.com/Julianarwansah/sistemcharging/backend/internal/mqtt"
+	"github.com/Julianarwansah/sistemcharging/backend/internal/scheduler"
+	"github.com/Julianarwansah/sistemcharging/backend/internal/services"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
 func main() {
@@ -21,6 +30,20 @@ func main() {
 	database.Migrate()
 	database.Seed()
 
+	// Back balances that predate the ledger with opening entries and make
+	// sure the cached balances still match it
+	if opened, err := services.OpenLedger(db); err != nil {
+		log.Fatalf("Failed to open ledger: %v", err)
+	} else if opened > 0 {
+		log.Printf("📒 Opened ledger wallets for %d user(s)", opened)
+	}
+	if report, err := services.ReconcileLedger(db, time.Now()); err != nil {
+		log.Printf("⚠️  Ledger reconciliation failed: %v", err)
+	} else if !report.OK {
+		log.Printf("⚠️  Ledger out of balance: %d unbalanced transaction(s), %d account and %d wallet mismatch(es)",
+			len(report.UnbalancedTransactions), len(report.AccountMismatches), len(report.WalletMismatches))
+	}
+
 	// Initialize WebSocket hub
 	wsHub := mqttclient.NewWebSocketHub()
 
@@ -34,7 +57,7 @@ func main() {
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", middleware.IdempotencyHeader},
 		AllowCredentials: true,
 	}))
 
@@ -47,6 +70,52 @@ func main() {
 		})
 	})
 
+	// Payment providers, enabled by their keys. The dummy provider takes no
+	// money and is only available in development.
+	var providers []gateway.Provider
+	if cfg.MidtransServerKey != "" {
+		providers = append(providers, gateway.NewMidtrans(cfg.MidtransServerKey, cfg.MidtransAPIURL, cfg.MidtransSnapURL))
+	}
+	if cfg.XenditSecretKey != "" {
+		providers = append(providers, gateway.NewXendit(cfg.XenditSecretKey, cfg.XenditCallbackToken, cfg.XenditAPIURL, cfg.PaymentRedirectURL))
+	}
+	if cfg.IsDevelopment() {
+		providers = append(providers, gateway.NewDummy())
+	}
+	payments, err := gateway.NewRegistry(providers, cfg.PaymentMethods)
+	if err != nil {
+		log.Fatalf("Invalid PAYMENT_METHODS: %v", err)
+	}
+	log.Printf("💳 Payment providers: %v", payments.Providers())
+	paymentExpiry := time.Duration(cfg.PaymentExpiryMins) * time.Minute
+
+	// Start background jobs (scheduled charging starts, unconfirmed session
+	// expiry)
+	scheduler.NewScheduler(db, mqttClient, time.Duration(cfg.SchedulerIntervalSec)*time.Second, paymentExpiry).Start()
+
+	// Top wallets up from saved payment methods once settlement takes them
+	// below the user's threshold
+	autoTopUp := &autotopup.Service{DB: db, Payments: payments, Hub: wsHub}
+	mqttClient.AfterSettle = func(userID uuid.UUID) {
+		autoTopUp.Check(context.Background(), userID, 0, autotopup.TriggerSettlement)
+	}
+
+	// Receipts are e-mailed through the configured backend; without one
+	// they can only be downloaded
+	var mail mailer.Mailer
+	switch cfg.MailBackend {
+	case "":
+	case "file":
+		mail = mailer.NewFile(cfg.MailDir, cfg.MailFrom)
+	case "smtp":
+		mail = mailer.NewSMTP(cfg.SMTPHost+":"+cfg.SMTPPort, cfg.SMTPUser, cfg.SMTPPass, cfg.MailFrom)
+	default:
+		log.Fatalf("Invalid MAIL_BACKEND %q, expected file or smtp", cfg.MailBackend)
+	}
+	if mail != nil {
+		log.Printf("✉️  Mail backend: %s", mail.Name())
+	}
+
 	// Initialize handlers
 	authHandler := &handlers.AuthHandler{
 		DB:             db,
@@ -55,12 +124,40 @@ func main() {
 		GoogleClientID: cfg.GoogleClientID,
 	}
 	stationHandler := &handlers.StationHandler{DB: db}
-	sessionHandler := &handlers.SessionHandler{DB: db, MQTT: mqttClient, Hub: wsHub}
-	paymentHandler := &handlers.PaymentHandler{DB: db, MQTT: mqttClient, Hub: wsHub}
+	sessionHandler := &handlers.SessionHandler{DB: db, MQTT: mqttClient, Hub: wsHub, Payments: payments, PaymentExpiry: paymentExpiry, AutoTopUp: autoTopUp}
+	paymentHandler := &handlers.PaymentHandler{DB: db, MQTT: mqttClient, Hub: wsHub, Payments: payments, AutoTopUp: autoTopUp}
 	adminHandler := &handlers.AdminHandler{DB: db}
-	walletHandler := &handlers.WalletHandler{DB: db, Hub: wsHub}
+	walletHandler := &handlers.WalletHandler{
+		DB:            db,
+		Hub:           wsHub,
+		Payments:      payments,
+		PaymentExpiry: paymentExpiry,
+		TransferLimits: services.TransferLimits{
+			Min:   models.NewMoney(float64(cfg.TransferMinRupiah)),
+			Max:   models.NewMoney(float64(cfg.TransferMaxRupiah)),
+			Daily: models.NewMoney(float64(cfg.TransferDailyRupiah)),
+		},
+	}
+	autoTopUpHandler := &handlers.AutoTopUpHandler{DB: db, Payments: payments}
+	tariffHandler := &handlers.TariffHandler{DB: db}
+	priceHistoryHandler := &handlers.PriceHistoryHandler{DB: db}
+	voucherHandler := &handlers.VoucherHandler{DB: db}
+	ledgerHandler := &handlers.LedgerHandler{DB: db}
+	reconciliationHandler := &handlers.ReconciliationHandler{DB: db, Payments: payments}
+	refundHandler := &handlers.RefundHandler{DB: db, Hub: wsHub}
+	organizationHandler := &handlers.OrganizationHandler{DB: db}
+	vehicleHandler := &handlers.VehicleHandler{DB: db}
+	estimateHandler := &handlers.EstimateHandler{DB: db}
+	authTokenHandler := &handlers.AuthTokenHandler{DB: db}
+	localAuthHandler := &handlers.LocalAuthHandler{DB: db, MQTT: mqttClient}
+	sessionShareHandler := &handlers.SessionShareHandler{DB: db, Hub: wsHub}
+	receiptHandler := &handlers.ReceiptHandler{DB: db, Mailer: mail}
 	wsHandler := &handlers.WebSocketHandler{Hub: wsHub}
 
+	// Money-moving routes replay their response for retried requests that
+	// carry an Idempotency-Key header
+	idempotent := middleware.Idempotency(db, time.Duration(cfg.IdempotencyRetentionHrs)*time.Hour)
+
 	// API routes
 	api := r.Group("/api/v1")
 	{
@@ -72,9 +169,13 @@ func main() {
 			auth.POST("/google", authHandler.GoogleLogin)
 		}
 
-		// Payment callback (public)
+		// Payment provider callbacks (public, verified per provider)
 		api.POST("/payments/callback", paymentHandler.Callback)
-		api.POST("/payments/pay/:id", paymentHandler.DummyPay)
+		api.POST("/payments/callback/:provider", paymentHandler.Callback)
+
+		// Shared session progress (public, by share token)
+		api.GET("/public/sessions/:token", sessionShareHandler.PublicProgress)
+		api.GET("/public/sessions/:token/ws", sessionShareHandler.PublicStream)
 
 		// Protected routes
 		protected := api.Group("")
@@ -106,6 +207,59 @@ func main() {
 				admin.GET("/activity", adminHandler.GetActivityLogs)
 				admin.DELETE("/users/:id", adminHandler.DeleteUser)
 				admin.POST("/reset", adminHandler.ResetData)
+
+				// Tariffs
+				admin.GET("/tariffs", tariffHandler.List)
+				admin.GET("/tariffs/:id", tariffHandler.Get)
+				admin.POST("/tariffs", tariffHandler.Create)
+				admin.PUT("/tariffs/:id", tariffHandler.Update)
+				admin.DELETE("/tariffs/:id", tariffHandler.Delete)
+
+				// Connector price history & scheduled price changes
+				admin.GET("/connectors/:id/prices", priceHistoryHandler.List)
+				admin.POST("/connectors/:id/prices", priceHistoryHandler.Schedule)
+				admin.DELETE("/connectors/:id/prices/:changeId", priceHistoryHandler.Cancel)
+
+				// Vouchers
+				admin.GET("/vouchers", voucherHandler.List)
+				admin.POST("/vouchers", voucherHandler.Create)
+				admin.PUT("/vouchers/:id", voucherHandler.Update)
+				admin.DELETE("/vouchers/:id", voucherHandler.Delete)
+
+				// Ledger
+				admin.GET("/ledger/accounts", ledgerHandler.Accounts)
+				admin.GET("/ledger/accounts/:id/entries", ledgerHandler.Entries)
+				admin.GET("/ledger/reconcile", ledgerHandler.Reconcile)
+
+				// Manual wallet credit from platform adjustments
+				admin.POST("/wallet/topup", idempotent, walletHandler.AdminTopUp)
+
+				// Payment reconciliation
+				admin.GET("/reconciliation", reconciliationHandler.Report)
+				admin.POST("/reconciliation/fix", reconciliationHandler.Fix)
+
+				// Refunds
+				admin.GET("/sessions/:id/refunds", refundHandler.List)
+				admin.POST("/sessions/:id/refunds", refundHandler.Create)
+
+				// Fleet organizations & invoices
+				admin.GET("/organizations", organizationHandler.AdminList)
+				admin.POST("/organizations", organizationHandler.AdminCreate)
+				admin.PUT("/organizations/:id", organizationHandler.AdminUpdate)
+				admin.POST("/organizations/:id/members", organizationHandler.AdminAddMember)
+				admin.POST("/organizations/:id/topup", idempotent, organizationHandler.AdminTopUp)
+				admin.POST("/organizations/:id/invoices", organizationHandler.AdminGenerateInvoice)
+				admin.GET("/invoices", organizationHandler.AdminInvoices)
+				admin.GET("/invoices/:id", organizationHandler.AdminInvoice)
+				admin.POST("/invoices/:id/pay", idempotent, organizationHandler.AdminPayInvoice)
+
+				// Charger authorization tokens
+				admin.GET("/tokens", authTokenHandler.AdminList)
+				admin.PUT("/tokens/:id", authTokenHandler.AdminUpdate)
+				admin.GET("/connectors/:id/auth-list", localAuthHandler.Get)
+				admin.POST("/connectors/:id/auth-list", localAuthHandler.Add)
+				admin.DELETE("/connectors/:id/auth-list/:tokenId", localAuthHandler.Remove)
+				admin.POST("/connectors/:id/auth-list/sync", localAuthHandler.Sync)
 			}
 
 			// Stations
@@ -123,15 +277,61 @@ func main() {
 			}
 
 			// Sessions
-			protected.POST("/sessions", sessionHandler.Create)
+			protected.POST("/sessions", idempotent, sessionHandler.Create)
 			protected.GET("/sessions/:id", sessionHandler.Get)
-			protected.POST("/sessions/:id/stop", sessionHandler.Stop)
+			protected.POST("/sessions/:id/stop", idempotent, sessionHandler.Stop)
+			protected.POST("/sessions/:id/cancel", sessionHandler.Cancel)
+			protected.PUT("/sessions/:id/schedule", sessionHandler.Reschedule)
 			protected.GET("/sessions/history", sessionHandler.History)
+			protected.GET("/sessions/:id/shares", sessionShareHandler.List)
+			protected.POST("/sessions/:id/shares", sessionShareHandler.Create)
+			protected.DELETE("/sessions/:id/shares/:shareId", sessionShareHandler.Revoke)
+			protected.GET("/sessions/:id/receipt", receiptHandler.Download)
+			protected.POST("/sessions/:id/receipt/email", receiptHandler.Email)
+			protected.POST("/estimates", estimateHandler.Create)
+
+			// Vehicles
+			protected.GET("/vehicles", vehicleHandler.List)
+			protected.POST("/vehicles", vehicleHandler.Create)
+			protected.PUT("/vehicles/:id", vehicleHandler.Update)
+			protected.DELETE("/vehicles/:id", vehicleHandler.Delete)
+
+			// RFID cards and tokens for starting sessions at the charger
+			protected.GET("/tokens", authTokenHandler.List)
+			protected.POST("/tokens", authTokenHandler.Create)
+			protected.PUT("/tokens/:id", authTokenHandler.Update)
+			protected.DELETE("/tokens/:id", authTokenHandler.Delete)
+
+			// Payments
+			protected.GET("/payments/methods", paymentHandler.Methods)
+			protected.POST("/payments/pay/:id", idempotent, paymentHandler.Pay)
 
 			// Wallet
 			protected.GET("/wallet/balance", walletHandler.GetBalance)
-			protected.POST("/wallet/topup", walletHandler.TopUp)
-			protected.POST("/admin/wallet/topup", walletHandler.AdminTopUp)
+			protected.GET("/wallet/transactions", walletHandler.Transactions)
+			protected.POST("/wallet/topup", idempotent, walletHandler.TopUp)
+			protected.POST("/wallet/redeem", walletHandler.Redeem)
+			protected.POST("/wallet/transfer", idempotent, walletHandler.Transfer)
+			protected.GET("/wallet/payment-methods", autoTopUpHandler.ListMethods)
+			protected.POST("/wallet/payment-methods", autoTopUpHandler.SaveMethod)
+			protected.DELETE("/wallet/payment-methods/:id", autoTopUpHandler.DeleteMethod)
+			protected.GET("/wallet/auto-topup", autoTopUpHandler.Get)
+			protected.PUT("/wallet/auto-topup", autoTopUpHandler.Update)
+
+			// Fleet organization of the caller
+			protected.GET("/organization", organizationHandler.Get)
+			protected.GET("/organization/members", organizationHandler.Members)
+			protected.POST("/organization/members", organizationHandler.AddMember)
+			protected.PUT("/organization/members/:memberId", organizationHandler.UpdateMember)
+			protected.DELETE("/organization/members/:memberId", organizationHandler.RemoveMember)
+			protected.GET("/organization/transactions", organizationHandler.Transactions)
+			protected.GET("/organization/sessions", organizationHandler.Sessions)
+			protected.GET("/organization/invoices", organizationHandler.Invoices)
+			protected.GET("/organization/invoices/:invoiceId", organizationHandler.Invoice)
+			protected.GET("/organization/tokens", organizationHandler.Tokens)
+			protected.POST("/organization/tokens", organizationHandler.IssueToken)
+			protected.PUT("/organization/tokens/:tokenId", organizationHandler.UpdateToken)
+			protected.DELETE("/organization/tokens/:tokenId", organizationHandler.DeleteToken)
 
 			// WebSocket
 			protected.GET("/ws/*topic", wsHandler.HandleTopic)
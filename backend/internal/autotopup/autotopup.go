@@ -0,0 +1,284 @@
+// Package autotopup charges a user's saved payment method when their wallet
+// balance falls below the threshold they configured.
+package autotopup
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/Julianarwansah/sistemcharging/backend/internal/gateway"
+	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
+	mqttclient "github.com/Julianarwansah/sistemcharging/backend/internal/mqtt"
+	"github.com/Julianarwansah/sistemcharging/backend/internal/services"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MaxFailures is the number of consecutive failed charges after which auto
+// top-up is switched off until the user enables it again.
+const MaxFailures = 3
+
+// pendingTimeout is how long a pending auto top-up blocks new ones. A charge
+// whose callback never came is left to the payment reconciliation.
+const pendingTimeout = time.Hour
+
+// What made Check run.
+const (
+	TriggerSessionStart = "session_start"
+	TriggerSettlement   = "settlement"
+)
+
+type Service struct {
+	DB       *gorm.DB
+	Payments *gateway.Registry
+	Hub      *mqttclient.WebSocketHub
+}
+
+// MonthlyUsage sums the auto top-ups of a user this calendar month, from
+// which the monthly cap is counted, that are paid or still pending.
+func MonthlyUsage(db *gorm.DB, userID uuid.UUID, now time.Time) (models.Money, error) {
+	var used models.Money
+	err := db.Model(&models.Payment{}).
+		Where("user_id = ? AND automatic AND status IN ? AND created_at >= ?", userID,
+			[]models.PaymentStatus{models.PaymentPending, models.PaymentSuccess}, services.MonthStart(db, now)).
+		Select("COALESCE(SUM(amount), 0)").Row().Scan(&used)
+	return used, err
+}
+
+// Check tops up the wallet of a user with auto top-up enabled whose balance
+// is below their threshold, or below need when need is set. It returns the
+// payment it made, or nil when none was needed or allowed. A charge the
+// provider pays right away is credited before Check returns; a pending one
+// once the provider's callback arrives.
+func (s *Service) Check(ctx context.Context, userID uuid.UUID, need models.Money, trigger string) (*models.Payment, error) {
+	var setting models.AutoTopUp
+	if err := s.DB.Preload("PaymentMethod").First(&setting, "user_id = ? AND enabled", userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	method := setting.PaymentMethod
+	if method == nil {
+		return nil, nil
+	}
+
+	var charger gateway.SavedMethodCharger
+	if provider, err := s.Payments.Provider(method.Provider); err == nil {
+		charger, _ = provider.(gateway.SavedMethodCharger)
+	}
+	if charger == nil {
+		s.recordFailure(userID, nil, "Payment gateway "+method.Provider+" tidak aktif")
+		return nil, nil
+	}
+
+	payment, err := s.reserve(&setting, need, time.Now())
+	if err != nil || payment == nil {
+		return nil, err
+	}
+	log.Printf("🔁 Auto top-up Rp %s for user %s (%s)", payment.Amount, userID, trigger)
+
+	var user models.User
+	s.DB.First(&user, "id = ?", userID)
+	status, err := charger.ChargeSaved(ctx, gateway.SavedChargeRequest{
+		OrderID:     payment.ID.String(),
+		Amount:      payment.Amount,
+		Method:      method.Method,
+		Token:       method.Token,
+		Description: "Top up otomatis SistemCharging",
+		Customer:    gateway.Customer{Name: user.Name, Email: user.Email, Phone: user.Phone},
+	})
+	if err != nil {
+		log.Printf("⚠️  Auto top-up charge for payment %s failed: %v", payment.ID, err)
+		payment.Status = models.PaymentFailed
+		s.DB.Model(payment).Update("status", payment.Status)
+		s.recordFailure(userID, payment, "Gagal menghubungi payment gateway")
+		return payment, nil
+	}
+
+	if status.Result.PaymentStatus() == models.PaymentPending {
+		payment.ExternalID = status.Reference
+		s.DB.Model(payment).Update("external_id", payment.ExternalID)
+		return payment, nil
+	}
+
+	var changed bool
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		payment, changed, err = services.CompletePayment(tx, payment.ID, services.PaymentUpdate{
+			Gateway:   method.Provider,
+			Status:    status.Result.PaymentStatus(),
+			Amount:    status.Amount,
+			Reference: status.Reference,
+		}, time.Now())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if changed {
+		s.Completed(payment)
+		if payment.Status == models.PaymentSuccess {
+			s.notifyBalance(userID)
+		}
+	}
+	return payment, nil
+}
+
+// reserve creates the pending payment of an auto top-up under a lock on the
+// setting, so concurrent checks charge at most once. Nothing is charged
+// while another auto top-up is pending or when the monthly cap would be
+// exceeded; the user is told about the cap once per month.
+func (s *Service) reserve(setting *models.AutoTopUp, need models.Money, now time.Time) (*models.Payment, error) {
+	var payment *models.Payment
+	var capReached bool
+	var used models.Money
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(setting, "id = ? AND enabled", setting.ID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return nil
+			}
+			return err
+		}
+
+		balance, err := services.WalletBalance(tx, setting.UserID)
+		if err != nil {
+			return err
+		}
+		if balance >= setting.Threshold && balance >= need {
+			return nil
+		}
+
+		var pending int64
+		if err := tx.Model(&models.Payment{}).
+			Where("user_id = ? AND automatic AND status = ? AND created_at >= ?",
+				setting.UserID, models.PaymentPending, now.Add(-pendingTimeout)).
+			Count(&pending).Error; err != nil {
+			return err
+		}
+		if pending > 0 {
+			return nil
+		}
+
+		used, err = MonthlyUsage(tx, setting.UserID, now)
+		if err != nil {
+			return err
+		}
+		if used+setting.Amount > setting.MonthlyCap {
+			if setting.CapReachedAt == nil || setting.CapReachedAt.Before(services.MonthStart(tx, now)) {
+				capReached = true
+				return tx.Model(setting).Update("cap_reached_at", now).Error
+			}
+			return nil
+		}
+
+		payment = &models.Payment{
+			UserID:         setting.UserID,
+			Purpose:        models.PurposeTopUp,
+			Automatic:      true,
+			PaymentMethod:  setting.PaymentMethod.Method,
+			PaymentGateway: setting.PaymentMethod.Provider,
+			Amount:         setting.Amount,
+			Status:         models.PaymentPending,
+		}
+		return tx.Create(payment).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if capReached {
+		s.notify(setting.UserID, map[string]interface{}{
+			"status":      "cap_reached",
+			"monthly_cap": setting.MonthlyCap,
+			"used":        used,
+		})
+	}
+	return payment, nil
+}
+
+// Completed records the outcome of an auto top-up payment, whether the
+// provider settled it right away or through the callback, and tells the
+// user about it.
+func (s *Service) Completed(payment *models.Payment) {
+	if payment.Status != models.PaymentSuccess {
+		s.recordFailure(payment.UserID, payment, "Pembayaran ditolak oleh "+payment.PaymentGateway)
+		return
+	}
+
+	s.DB.Model(&models.AutoTopUp{}).Where("user_id = ?", payment.UserID).
+		Updates(map[string]interface{}{"failure_count": 0, "last_error": ""})
+
+	var user models.User
+	s.DB.Select("balance").First(&user, "id = ?", payment.UserID)
+	s.notify(payment.UserID, map[string]interface{}{
+		"status":     "success",
+		"payment_id": payment.ID,
+		"amount":     payment.Amount,
+		"balance":    user.Balance,
+	})
+}
+
+// recordFailure counts a failed auto top-up, switches auto top-up off after
+// MaxFailures in a row and notifies the user.
+func (s *Service) recordFailure(userID uuid.UUID, payment *models.Payment, reason string) {
+	var setting models.AutoTopUp
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&setting, "user_id = ?", userID).Error; err != nil {
+			return err
+		}
+		now := time.Now()
+		setting.FailureCount++
+		setting.LastError = reason
+		setting.LastFailedAt = &now
+		if setting.FailureCount >= MaxFailures {
+			setting.Enabled = false
+		}
+		return tx.Model(&setting).Updates(map[string]interface{}{
+			"failure_count":  setting.FailureCount,
+			"last_error":     setting.LastError,
+			"last_failed_at": setting.LastFailedAt,
+			"enabled":        setting.Enabled,
+		}).Error
+	})
+	if err != nil {
+		log.Printf("⚠️  Failed to record auto top-up failure for user %s: %v", userID, err)
+		return
+	}
+
+	data := map[string]interface{}{
+		"status":        "failed",
+		"reason":        reason,
+		"failure_count": setting.FailureCount,
+		"disabled":      !setting.Enabled,
+	}
+	if payment != nil {
+		data["payment_id"] = payment.ID
+		data["amount"] = payment.Amount
+	}
+	s.notify(userID, data)
+}
+
+func (s *Service) notifyBalance(userID uuid.UUID) {
+	var user models.User
+	s.DB.Select("balance").First(&user, "id = ?", userID)
+	balanceData, _ := json.Marshal(map[string]interface{}{
+		"type":    "balance_update",
+		"balance": user.Balance,
+		"user_id": userID,
+	})
+	s.Hub.Broadcast(userID.String(), balanceData)
+	s.Hub.Broadcast("admin", balanceData)
+}
+
+func (s *Service) notify(userID uuid.UUID, data map[string]interface{}) {
+	data["type"] = "auto_topup"
+	data["user_id"] = userID
+	payload, _ := json.Marshal(data)
+	s.Hub.Broadcast(userID.String(), payload)
+	s.Hub.Broadcast("admin", payload)
+}
@@ -1,8 +1,10 @@
 package config
 
 import (
+	"log"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
@@ -22,12 +24,71 @@ type Config struct {
 	MQTTUser       string
 	MQTTPass       string
 	GoogleClientID string
+	// SchedulerIntervalSec is how often background jobs (scheduled starts) run
+	SchedulerIntervalSec int
+	// IdempotencyRetentionHrs is how long responses to requests sent with an
+	// Idempotency-Key are kept for replay
+	IdempotencyRetentionHrs int
+	// AppEnv is "production" or "development"; the dummy payment provider
+	// is only available in development
+	AppEnv string
+	// Payment providers are enabled by their keys. PaymentMethods routes a
+	// payment method to a provider, e.g. {"bca_va": "xendit"}; other methods
+	// go to the first enabled provider supporting them.
+	MidtransServerKey   string
+	MidtransClientKey   string
+	MidtransAPIURL      string
+	MidtransSnapURL     string
+	XenditSecretKey     string
+	XenditCallbackToken string
+	XenditAPIURL        string
+	PaymentMethods      map[string]string
+	PaymentRedirectURL  string
+	PaymentExpiryMins   int
+	// Wallet-to-wallet transfers are limited per transfer and per sender per
+	// day, in whole rupiah
+	TransferMinRupiah   int
+	TransferMaxRupiah   int
+	TransferDailyRupiah int
+	// Receipts are e-mailed through MailBackend: "file" writes messages to
+	// MailDir, "smtp" sends them through SMTPHost; empty disables e-mail
+	MailBackend string
+	MailFrom    string
+	MailDir     string
+	SMTPHost    string
+	SMTPPort    string
+	SMTPUser    string
+	SMTPPass    string
+}
+
+// IsDevelopment reports whether development-only features are enabled.
+func (c *Config) IsDevelopment() bool {
+	return c.AppEnv == "development"
 }
 
 func Load() *Config {
 	godotenv.Load()
 
 	expiryHrs, _ := strconv.Atoi(getEnv("JWT_EXPIRY_HOURS", "72"))
+	schedulerSec, err := strconv.Atoi(getEnv("SCHEDULER_INTERVAL_SECONDS", "30"))
+	if err != nil || schedulerSec <= 0 {
+		log.Printf("⚠️  Invalid SCHEDULER_INTERVAL_SECONDS, using 30")
+		schedulerSec = 30
+	}
+	idempotencyHrs, _ := strconv.Atoi(getEnv("IDEMPOTENCY_RETENTION_HOURS", "24"))
+	paymentExpiryMins, _ := strconv.Atoi(getEnv("PAYMENT_EXPIRY_MINUTES", "60"))
+	transferMin, _ := strconv.Atoi(getEnv("TRANSFER_MIN_AMOUNT", "10000"))
+	transferMax, _ := strconv.Atoi(getEnv("TRANSFER_MAX_AMOUNT", "1000000"))
+	transferDaily, _ := strconv.Atoi(getEnv("TRANSFER_DAILY_LIMIT", "2000000"))
+
+	midtransAPIURL, midtransSnapURL := gatewayURLs(getEnv("MIDTRANS_IS_PRODUCTION", "false") == "true")
+
+	paymentMethods := map[string]string{}
+	for _, pair := range strings.Split(getEnv("PAYMENT_METHODS", ""), ",") {
+		if method, provider, ok := strings.Cut(strings.TrimSpace(pair), "="); ok {
+			paymentMethods[strings.TrimSpace(method)] = strings.TrimSpace(provider)
+		}
+	}
 
 	return &Config{
 		ServerPort:     getEnv("SERVER_PORT", "8080"),
@@ -44,6 +105,30 @@ func Load() *Config {
 		MQTTUser:       getEnv("MQTT_USER", ""),
 		MQTTPass:       getEnv("MQTT_PASS", ""),
 		GoogleClientID: getEnv("GOOGLE_CLIENT_ID", ""),
+
+		SchedulerIntervalSec:    schedulerSec,
+		IdempotencyRetentionHrs: idempotencyHrs,
+		AppEnv:                  getEnv("APP_ENV", "production"),
+		MidtransServerKey:       getEnv("MIDTRANS_SERVER_KEY", ""),
+		MidtransClientKey:       getEnv("MIDTRANS_CLIENT_KEY", ""),
+		MidtransAPIURL:          getEnv("MIDTRANS_API_URL", midtransAPIURL),
+		MidtransSnapURL:         getEnv("MIDTRANS_SNAP_URL", midtransSnapURL),
+		XenditSecretKey:         getEnv("XENDIT_SECRET_KEY", ""),
+		XenditCallbackToken:     getEnv("XENDIT_CALLBACK_TOKEN", ""),
+		XenditAPIURL:            getEnv("XENDIT_API_URL", "https://api.xendit.co"),
+		PaymentMethods:          paymentMethods,
+		PaymentRedirectURL:      getEnv("PAYMENT_REDIRECT_URL", ""),
+		PaymentExpiryMins:       paymentExpiryMins,
+		TransferMinRupiah:       transferMin,
+		TransferMaxRupiah:       transferMax,
+		TransferDailyRupiah:     transferDaily,
+		MailBackend:             getEnv("MAIL_BACKEND", ""),
+		MailFrom:                getEnv("MAIL_FROM", "SistemCharging <noreply@charging.id>"),
+		MailDir:                 getEnv("MAIL_DIR", "mail"),
+		SMTPHost:                getEnv("SMTP_HOST", "localhost"),
+		SMTPPort:                getEnv("SMTP_PORT", "25"),
+		SMTPUser:                getEnv("SMTP_USER", ""),
+		SMTPPass:                getEnv("SMTP_PASS", ""),
 	}
 }
 
@@ -51,6 +136,14 @@ func (c *Config) DSN() string {
 	return "postgres://" + c.DBUser + ":" + c.DBPassword + "@" + c.DBHost + ":" + c.DBPort + "/" + c.DBName + "?sslmode=" + c.DBSSLMode + "&TimeZone=Asia/Jakarta"
 }
 
+// gatewayURLs returns the default Midtrans Core API and Snap URLs.
+func gatewayURLs(production bool) (string, string) {
+	if production {
+		return "https://api.midtrans.com", "https://app.midtrans.com/snap"
+	}
+	return "https://api.sandbox.midtrans.com", "https://app.sandbox.midtrans.com/snap"
+}
+
 func getEnv(key, fallback string) string {
 	if val, ok := os.LookupEnv(key); ok {
 		return val
@@ -27,6 +27,10 @@ func Connect(cfg *config.Config) *gorm.DB {
 }
 
 func Migrate() {
+	if err := migrateMoney(DB); err != nil {
+		log.Fatalf("Failed to migrate money columns: %v", err)
+	}
+
 	DB.AutoMigrate(
 		&models.User{},
 		&models.Station{},
@@ -36,12 +40,58 @@ func Migrate() {
 		&models.WalletTransaction{},
 		&models.SystemConfig{},
 		&models.ActivityLog{},
+		&models.Tariff{},
+		&models.TariffBand{},
+		&models.ConnectorPriceChange{},
+		&models.Voucher{},
+		&models.VoucherRedemption{},
+		&models.SessionLineItem{},
+		&models.LedgerAccount{},
+		&models.LedgerTransaction{},
+		&models.LedgerEntry{},
+		&models.Refund{},
+		&models.IdempotencyKey{},
+		&models.SavedPaymentMethod{},
+		&models.AutoTopUp{},
+		&models.Organization{},
+		&models.OrganizationMember{},
+		&models.Invoice{},
+		&models.InvoiceLine{},
+		&models.Vehicle{},
+		&models.AuthToken{},
+		&models.LocalAuthEntry{},
+		&models.LocalAuthList{},
+		&models.SessionShare{},
+		&models.Receipt{},
 	)
 	// Manual migration for GoogleID to handle NULL values in unique index
 	DB.Exec("ALTER TABLE users ALTER COLUMN google_id DROP NOT NULL")
 	DB.Exec("ALTER TABLE users ALTER COLUMN google_id SET DEFAULT NULL")
 	DB.Exec("UPDATE users SET google_id = NULL WHERE google_id = ''")
 	DB.Exec("UPDATE users SET role = 'user' WHERE role IS NULL OR role = ''")
+	DB.Exec("ALTER TABLE activity_logs ALTER COLUMN admin_id DROP NOT NULL")
+
+	// Payments now also cover wallet top-ups, which have no session
+	DB.Exec("ALTER TABLE payments ALTER COLUMN session_id DROP NOT NULL")
+	DB.Exec(`UPDATE payments p SET user_id = cs.user_id FROM charging_sessions cs
+		WHERE p.session_id = cs.id AND p.user_id IS NULL`)
+	DB.Exec(`UPDATE payments SET payment_gateway = 'wallet', payment_method = 'wallet'
+		WHERE purpose = 'session' AND payment_gateway = 'dummy'`)
+
+	// Link old deductions to their session and fill in the running balance
+	// of wallet entries recorded before it was tracked, working back from
+	// the current balance
+	DB.Exec(`UPDATE wallet_transactions SET session_id = reference_id::uuid
+		WHERE session_id IS NULL AND transaction_type = 'deduction'
+		AND reference_id IN (SELECT id::text FROM charging_sessions)`)
+	DB.Exec(`UPDATE wallet_transactions w SET balance_after = h.balance_after
+		FROM (
+			SELECT wt.id, u.balance - COALESCE(SUM(CASE WHEN wt.transaction_type = 'deduction' THEN -wt.amount ELSE wt.amount END)
+				OVER (PARTITION BY wt.user_id ORDER BY wt.created_at DESC, wt.id DESC
+					ROWS BETWEEN UNBOUNDED PRECEDING AND 1 PRECEDING), 0) AS balance_after
+			FROM wallet_transactions wt JOIN users u ON u.id = wt.user_id
+		) h
+		WHERE w.id = h.id AND w.balance_after IS NULL`)
 
 	var userCount, adminCount int64
 	DB.Model(&models.User{}).Where("role = ?", "user").Count(&userCount)
@@ -81,7 +131,7 @@ func Seed() {
 				StationID:     station1.ID,
 				ConnectorType: "Type 2",
 				PowerKW:       3.3,
-				PricePerKWH:   2500,
+				PricePerKWH:   models.NewMoney(2500),
 				Status:        models.ConnectorAvailable,
 				MQTTTopic:     "charger/" + station1.ID.String() + "/connector1",
 			},
@@ -89,7 +139,7 @@ func Seed() {
 				StationID:     station1.ID,
 				ConnectorType: "CCS",
 				PowerKW:       50.0,
-				PricePerKWH:   3500,
+				PricePerKWH:   models.NewMoney(3500),
 				Status:        models.ConnectorAvailable,
 				MQTTTopic:     "charger/" + station1.ID.String() + "/connector2",
 			},
@@ -97,7 +147,7 @@ func Seed() {
 				StationID:     station2.ID,
 				ConnectorType: "Type 2",
 				PowerKW:       7.4,
-				PricePerKWH:   2800,
+				PricePerKWH:   models.NewMoney(2800),
 				Status:        models.ConnectorAvailable,
 				MQTTTopic:     "charger/" + station2.ID.String() + "/connector1",
 			},
@@ -172,6 +222,26 @@ func Seed() {
 			ConfigValue: "Asia/Jakarta",
 			Description: "Zona waktu sistem",
 		},
+		{
+			ConfigKey:   "tax_name",
+			ConfigValue: "PPN",
+			Description: "Nama pajak yang ditampilkan di rincian tagihan",
+		},
+		{
+			ConfigKey:   "tax_rate_percent",
+			ConfigValue: "11",
+			Description: "Tarif pajak (persen) atas biaya sesi dan biaya layanan",
+		},
+		{
+			ConfigKey:   "service_fee_percent",
+			ConfigValue: "0",
+			Description: "Biaya layanan platform (persen dari biaya sesi)",
+		},
+		{
+			ConfigKey:   "service_fee_flat",
+			ConfigValue: "0",
+			Description: "Biaya layanan platform tetap per sesi",
+		},
 	}
 
 	for _, cfg := range defaultConfigs {
@@ -0,0 +1,97 @@
+package database
+
+import (
+	"fmt"
+	"log"
+
+	"gorm.io/gorm"
+)
+
+// moneyColumns lists every column holding a models.Money amount. They used
+// to be decimal columns in rupiah and are now bigint columns in 1/100
+// rupiah.
+var moneyColumns = map[string][]string{
+	"users":                   {"balance"},
+	"stations":                {"idle_fee_per_minute", "idle_max_fee"},
+	"connectors":              {"price_per_kwh", "idle_fee_per_minute", "idle_max_fee"},
+	"charging_sessions":       {"energy_cost", "time_cost", "start_fee", "adjustment", "idle_fee", "discount", "service_fee", "tax", "total_cost", "max_cost"},
+	"payments":                {"amount", "discount", "service_fee", "tax"},
+	"wallet_transactions":     {"amount", "discount"},
+	"tariffs":                 {"price_per_kwh", "price_per_minute", "start_fee", "min_price", "max_price"},
+	"tariff_bands":            {"price_per_kwh", "price_per_minute"},
+	"connector_price_changes": {"price_per_kwh"},
+	"vouchers":                {"amount", "max_discount"},
+	"voucher_redemptions":     {"amount"},
+	"session_line_items":      {"amount"},
+}
+
+// migrateMoney converts the remaining decimal money columns to integer
+// minor units. It must run before AutoMigrate, which would otherwise change
+// the column type without scaling the stored amounts. Columns that are
+// already bigint, or do not exist yet, are skipped, so it is safe to run on
+// every start.
+func migrateMoney(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := splitVoucherValue(tx); err != nil {
+			return err
+		}
+
+		converted := 0
+		for table, columns := range moneyColumns {
+			for _, column := range columns {
+				var dataType string
+				tx.Raw(`SELECT data_type FROM information_schema.columns
+					WHERE table_schema = CURRENT_SCHEMA() AND table_name = ? AND column_name = ?`, table, column).
+					Scan(&dataType)
+				if dataType != "numeric" {
+					continue
+				}
+
+				// The numeric default cannot be cast along with the column,
+				// so drop it; AutoMigrate restores it afterwards
+				stmt := fmt.Sprintf(`ALTER TABLE %q ALTER COLUMN %q DROP DEFAULT,
+					ALTER COLUMN %q TYPE bigint USING ROUND(%q * 100)::bigint`, table, column, column, column)
+				if err := tx.Exec(stmt).Error; err != nil {
+					return fmt.Errorf("convert %s.%s: %w", table, column, err)
+				}
+				converted++
+			}
+		}
+
+		// Tariff snapshots are JSON and decode money in rupiah as before,
+		// so they need no conversion
+		if converted > 0 {
+			log.Printf("💱 Converted %d money column(s) to minor units", converted)
+		}
+		return nil
+	})
+}
+
+// splitVoucherValue moves the old decimal vouchers.value column apart:
+// percentages and free kWh go to their own columns and the remaining rupiah
+// amounts are renamed to amount, which migrateMoney then converts like any
+// other money column.
+func splitVoucherValue(tx *gorm.DB) error {
+	var dataType string
+	tx.Raw(`SELECT data_type FROM information_schema.columns
+		WHERE table_schema = CURRENT_SCHEMA() AND table_name = 'vouchers' AND column_name = 'value'`).
+		Scan(&dataType)
+	if dataType != "numeric" {
+		return nil
+	}
+
+	stmts := []string{
+		`ALTER TABLE "vouchers" ADD COLUMN IF NOT EXISTS "percent" decimal(5,2) DEFAULT 0,
+			ADD COLUMN IF NOT EXISTS "free_kwh" decimal(10,3) DEFAULT 0`,
+		`UPDATE "vouchers" SET "percent" = "value", "value" = 0 WHERE "type" = 'percentage'`,
+		`UPDATE "vouchers" SET "free_kwh" = "value", "value" = 0 WHERE "type" = 'free_kwh'`,
+		`ALTER TABLE "vouchers" RENAME COLUMN "value" TO "amount"`,
+	}
+	for _, stmt := range stmts {
+		if err := tx.Exec(stmt).Error; err != nil {
+			return fmt.Errorf("split vouchers.value: %w", err)
+		}
+	}
+	log.Println("💱 Split vouchers.value into amount, percent and free_kwh")
+	return nil
+}
@@ -0,0 +1,101 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
+)
+
+const MethodDummy = "dummy"
+
+var (
+	_ Provider           = (*Dummy)(nil)
+	_ SavedMethodCharger = (*Dummy)(nil)
+)
+
+// Dummy is a provider that takes no money. Payments are settled by calling
+// POST /payments/pay/:id, which reports them paid through Pay. It keeps its
+// state in memory and must only be enabled in development.
+type Dummy struct {
+	mu     sync.Mutex
+	orders map[string]*Status
+}
+
+func NewDummy() *Dummy {
+	return &Dummy{orders: map[string]*Status{}}
+}
+
+func (d *Dummy) Name() string { return "dummy" }
+
+func (d *Dummy) Methods() []string { return []string{MethodDummy, MethodQRIS} }
+
+func (d *Dummy) CreateCharge(ctx context.Context, req ChargeRequest) (*Charge, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.orders[req.OrderID] = &Status{OrderID: req.OrderID, Reference: req.OrderID, Result: ResultPending, Amount: req.Amount}
+	charge := &Charge{Reference: req.OrderID, RedirectURL: "/api/v1/payments/pay/" + req.OrderID}
+	if req.Method == MethodQRIS {
+		charge.QRString = "DUMMY-QRIS-" + req.OrderID
+	}
+	return charge, nil
+}
+
+// Pay marks an order paid, standing in for the customer completing it at a
+// real gateway. Orders from before a restart are recreated on demand.
+func (d *Dummy) Pay(orderID string, amount models.Money) *Status {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	status := &Status{OrderID: orderID, Reference: orderID, Result: ResultPaid, Amount: amount}
+	d.orders[orderID] = status
+	return status
+}
+
+func (d *Dummy) SavedMethods() []string { return []string{MethodCard} }
+
+// ChargeSaved pays right away, unless the token is "fail" so declined
+// charges can be tried out.
+func (d *Dummy) ChargeSaved(ctx context.Context, req SavedChargeRequest) (*Status, error) {
+	result := ResultPaid
+	if req.Token == "fail" {
+		result = ResultFailed
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	status := &Status{OrderID: req.OrderID, Reference: req.OrderID, Result: result, Amount: req.Amount}
+	d.orders[req.OrderID] = status
+	copied := *status
+	return &copied, nil
+}
+
+// VerifyCallback accepts a JSON status without authentication; callbacks
+// are only reachable while the dummy provider is enabled.
+func (d *Dummy) VerifyCallback(header http.Header, body []byte) (*Status, error) {
+	var callback struct {
+		OrderID string       `json:"order_id"`
+		Result  Result       `json:"result"`
+		Amount  models.Money `json:"amount"`
+	}
+	if err := json.Unmarshal(body, &callback); err != nil || callback.OrderID == "" {
+		return nil, fmt.Errorf("dummy: invalid callback")
+	}
+	return &Status{OrderID: callback.OrderID, Reference: callback.OrderID, Result: callback.Result, Amount: callback.Amount}, nil
+}
+
+func (d *Dummy) Status(ctx context.Context, reference string) (*Status, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	status, ok := d.orders[reference]
+	if !ok {
+		return nil, fmt.Errorf("dummy: order %s not found", reference)
+	}
+	copied := *status
+	return &copied, nil
+}
+
+func (d *Dummy) Refund(ctx context.Context, req RefundRequest) error {
+	return nil
+}
@@ -0,0 +1,350 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
+)
+
+// Midtrans payment methods. MethodSnap returns a hosted payment page; the
+// VA methods return a virtual account number directly. MethodQRIS is also
+// charged through the Core API.
+const (
+	MethodSnap  = "snap"
+	MethodBCAVA = "bca_va"
+	MethodBNIVA = "bni_va"
+	MethodBRIVA = "bri_va"
+)
+
+// MidtransNotification is a Midtrans HTTP notification, also returned by
+// the status API.
+type MidtransNotification struct {
+	OrderID           string `json:"order_id"`
+	TransactionID     string `json:"transaction_id"`
+	StatusCode        string `json:"status_code"`
+	GrossAmount       string `json:"gross_amount"`
+	SignatureKey      string `json:"signature_key"`
+	TransactionStatus string `json:"transaction_status"`
+	FraudStatus       string `json:"fraud_status"`
+	PaymentType       string `json:"payment_type"`
+	StatusMessage     string `json:"status_message"`
+}
+
+// Result maps the Midtrans transaction status to a payment outcome. Card
+// captures only count as paid once the fraud check accepted them.
+func (n MidtransNotification) Result() Result {
+	switch n.TransactionStatus {
+	case "settlement":
+		return ResultPaid
+	case "capture":
+		if n.FraudStatus == "" || n.FraudStatus == "accept" {
+			return ResultPaid
+		}
+		return ResultPending
+	case "deny", "failure":
+		return ResultFailed
+	case "expire":
+		return ResultExpired
+	case "cancel":
+		return ResultCancelled
+	}
+	return ResultPending
+}
+
+func (n MidtransNotification) status() (*Status, error) {
+	amount, err := models.ParseMoney(n.GrossAmount)
+	if err != nil {
+		return nil, err
+	}
+	return &Status{OrderID: n.OrderID, Reference: n.OrderID, Result: n.Result(), Amount: amount}, nil
+}
+
+// MethodCard is a saved card, charged with its saved token.
+const MethodCard = "card"
+
+var (
+	_ Provider           = (*Midtrans)(nil)
+	_ SavedMethodCharger = (*Midtrans)(nil)
+)
+
+// Midtrans talks to the Midtrans Snap and Core APIs. The URLs can point at
+// the sandbox, production, or the local stub in cmd/midtrans_stub.
+type Midtrans struct {
+	serverKey string
+	apiURL    string
+	snapURL   string
+	client    *http.Client
+}
+
+func NewMidtrans(serverKey, apiURL, snapURL string) *Midtrans {
+	return &Midtrans{
+		serverKey: serverKey,
+		apiURL:    strings.TrimRight(apiURL, "/"),
+		snapURL:   strings.TrimRight(snapURL, "/"),
+		client:    &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// MidtransSignature computes the signature_key of a notification.
+func MidtransSignature(orderID, statusCode, grossAmount, serverKey string) string {
+	sum := sha512.Sum512([]byte(orderID + statusCode + grossAmount + serverKey))
+	return hex.EncodeToString(sum[:])
+}
+
+func (m *Midtrans) Name() string { return "midtrans" }
+
+func (m *Midtrans) Methods() []string {
+	return []string{MethodSnap, MethodBCAVA, MethodBNIVA, MethodBRIVA, MethodQRIS}
+}
+
+// VerifyCallback checks that a notification was signed with our server key.
+func (m *Midtrans) VerifyCallback(header http.Header, body []byte) (*Status, error) {
+	var n MidtransNotification
+	if err := json.Unmarshal(body, &n); err != nil || n.OrderID == "" {
+		return nil, fmt.Errorf("midtrans: invalid notification")
+	}
+	expected := MidtransSignature(n.OrderID, n.StatusCode, n.GrossAmount, m.serverKey)
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(strings.ToLower(n.SignatureKey))) != 1 {
+		return nil, ErrInvalidSignature
+	}
+	return n.status()
+}
+
+// CreateCharge starts a payment for the order. The order ID is also the
+// reference for status queries.
+func (m *Midtrans) CreateCharge(ctx context.Context, req ChargeRequest) (*Charge, error) {
+	grossAmount, err := wholeRupiah(req.Amount)
+	if err != nil {
+		return nil, err
+	}
+	details := map[string]interface{}{
+		"order_id":     req.OrderID,
+		"gross_amount": grossAmount,
+	}
+	customer := map[string]interface{}{
+		"first_name": req.Customer.Name,
+		"email":      req.Customer.Email,
+		"phone":      req.Customer.Phone,
+	}
+	minutes := expiryMinutes(req.Expiry)
+
+	if req.Method == MethodSnap {
+		var resp struct {
+			Token         string   `json:"token"`
+			RedirectURL   string   `json:"redirect_url"`
+			ErrorMessages []string `json:"error_messages"`
+		}
+		body := map[string]interface{}{
+			"transaction_details": details,
+			"customer_details":    customer,
+			"expiry":              map[string]interface{}{"unit": "minutes", "duration": minutes},
+		}
+		if err := m.do(ctx, http.MethodPost, m.snapURL+"/v1/transactions", body, &resp); err != nil {
+			return nil, err
+		}
+		if resp.Token == "" {
+			return nil, fmt.Errorf("midtrans snap: %s", strings.Join(resp.ErrorMessages, "; "))
+		}
+		expiresAt := time.Now().Add(time.Duration(minutes) * time.Minute)
+		return &Charge{Reference: req.OrderID, Token: resp.Token, RedirectURL: resp.RedirectURL, ExpiresAt: &expiresAt}, nil
+	}
+
+	if req.Method == MethodQRIS {
+		var resp struct {
+			StatusCode    string `json:"status_code"`
+			StatusMessage string `json:"status_message"`
+			QRString      string `json:"qr_string"`
+			ExpiryTime    string `json:"expiry_time"`
+			Actions       []struct {
+				Name string `json:"name"`
+				URL  string `json:"url"`
+			} `json:"actions"`
+		}
+		body := map[string]interface{}{
+			"payment_type":        "qris",
+			"transaction_details": details,
+			"customer_details":    customer,
+			"custom_expiry":       map[string]interface{}{"unit": "minute", "expiry_duration": minutes},
+		}
+		if err := m.do(ctx, http.MethodPost, m.apiURL+"/v2/charge", body, &resp); err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != "201" || resp.QRString == "" {
+			return nil, fmt.Errorf("midtrans charge: %s %s", resp.StatusCode, resp.StatusMessage)
+		}
+
+		charge := &Charge{Reference: req.OrderID, QRString: resp.QRString, ExpiresAt: parseWIB(resp.ExpiryTime)}
+		for _, action := range resp.Actions {
+			if action.Name == "generate-qr-code" {
+				charge.QRImageURL = action.URL
+			}
+		}
+		return charge, nil
+	}
+
+	bank, ok := strings.CutSuffix(req.Method, "_va")
+	if !ok || (bank != "bca" && bank != "bni" && bank != "bri") {
+		return nil, ErrUnsupportedMethod
+	}
+	var resp struct {
+		StatusCode    string `json:"status_code"`
+		StatusMessage string `json:"status_message"`
+		TransactionID string `json:"transaction_id"`
+		ExpiryTime    string `json:"expiry_time"`
+		VANumbers     []struct {
+			Bank     string `json:"bank"`
+			VANumber string `json:"va_number"`
+		} `json:"va_numbers"`
+	}
+	body := map[string]interface{}{
+		"payment_type":        "bank_transfer",
+		"transaction_details": details,
+		"customer_details":    customer,
+		"bank_transfer":       map[string]interface{}{"bank": bank},
+		"custom_expiry":       map[string]interface{}{"unit": "minute", "expiry_duration": minutes},
+	}
+	if err := m.do(ctx, http.MethodPost, m.apiURL+"/v2/charge", body, &resp); err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != "201" || len(resp.VANumbers) == 0 {
+		return nil, fmt.Errorf("midtrans charge: %s %s", resp.StatusCode, resp.StatusMessage)
+	}
+
+	return &Charge{
+		Reference: req.OrderID,
+		Bank:      resp.VANumbers[0].Bank,
+		VANumber:  resp.VANumbers[0].VANumber,
+		ExpiresAt: parseWIB(resp.ExpiryTime),
+	}, nil
+}
+
+// parseWIB parses a Midtrans timestamp, which is in WIB without a zone.
+func parseWIB(value string) *time.Time {
+	t, err := time.ParseInLocation("2006-01-02 15:04:05", value, time.FixedZone("WIB", 7*3600))
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+func (m *Midtrans) SavedMethods() []string { return []string{MethodCard} }
+
+// ChargeSaved charges a card with the saved_token_id Midtrans returned when
+// the card was first paid with save_card enabled. The order ID is the
+// reference for status queries.
+func (m *Midtrans) ChargeSaved(ctx context.Context, req SavedChargeRequest) (*Status, error) {
+	if req.Method != MethodCard {
+		return nil, ErrUnsupportedMethod
+	}
+	grossAmount, err := wholeRupiah(req.Amount)
+	if err != nil {
+		return nil, err
+	}
+	body := map[string]interface{}{
+		"payment_type": "credit_card",
+		"transaction_details": map[string]interface{}{
+			"order_id":     req.OrderID,
+			"gross_amount": grossAmount,
+		},
+		"credit_card": map[string]interface{}{"token_id": req.Token},
+		"customer_details": map[string]interface{}{
+			"first_name": req.Customer.Name,
+			"email":      req.Customer.Email,
+			"phone":      req.Customer.Phone,
+		},
+	}
+	var n MidtransNotification
+	if err := m.do(ctx, http.MethodPost, m.apiURL+"/v2/charge", body, &n); err != nil {
+		return nil, err
+	}
+	switch n.StatusCode {
+	case "200", "201", "202":
+		return n.status()
+	}
+	return nil, fmt.Errorf("midtrans charge: %s %s", n.StatusCode, n.StatusMessage)
+}
+
+// Status asks Midtrans for the current state of an order.
+func (m *Midtrans) Status(ctx context.Context, reference string) (*Status, error) {
+	var n MidtransNotification
+	if err := m.do(ctx, http.MethodGet, m.apiURL+"/v2/"+reference+"/status", nil, &n); err != nil {
+		return nil, err
+	}
+	if n.StatusCode == "404" {
+		return nil, fmt.Errorf("midtrans status: order %s not found", reference)
+	}
+	return n.status()
+}
+
+// Refund returns money of a settled order to the payer. Midtrans only
+// supports this for some methods, such as cards and e-wallets.
+func (m *Midtrans) Refund(ctx context.Context, req RefundRequest) error {
+	amount, err := wholeRupiah(req.Amount)
+	if err != nil {
+		return err
+	}
+	var resp struct {
+		StatusCode    string `json:"status_code"`
+		StatusMessage string `json:"status_message"`
+	}
+	body := map[string]interface{}{
+		"refund_key": req.OrderID + "-" + strconv.FormatInt(time.Now().UnixNano(), 36),
+		"amount":     amount,
+		"reason":     req.Reason,
+	}
+	if err := m.do(ctx, http.MethodPost, m.apiURL+"/v2/"+req.Reference+"/refund", body, &resp); err != nil {
+		return err
+	}
+	switch resp.StatusCode {
+	case "200":
+		return nil
+	case "412":
+		return ErrRefundUnsupported
+	}
+	return fmt.Errorf("midtrans refund: %s %s", resp.StatusCode, resp.StatusMessage)
+}
+
+func (m *Midtrans) do(ctx context.Context, method, url string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(m.serverKey, "")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusUnauthorized {
+		return fmt.Errorf("midtrans: %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	return json.Unmarshal(data, out)
+}
@@ -0,0 +1,146 @@
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
+)
+
+const testServerKey = "SB-Mid-server-test"
+
+func TestMidtransSignature(t *testing.T) {
+	// SHA-512 of order_id + status_code + gross_amount + server key
+	const want = "41235e016b76163e186daf8f0ea78e34b1018acd1de1c5cf8d63aad481fdd5eadcbf8c5ae2ca1b87615d57fc4e91ffa6d0a3571d1c813819f571aaf112c9ab68"
+	if got := MidtransSignature("ORDER-1", "200", "1500.00", testServerKey); got != want {
+		t.Errorf("MidtransSignature() = %s, want %s", got, want)
+	}
+}
+
+func TestMidtransVerifyCallback(t *testing.T) {
+	m := NewMidtrans(testServerKey, "", "")
+	signed := func(n MidtransNotification) MidtransNotification {
+		n.SignatureKey = MidtransSignature(n.OrderID, n.StatusCode, n.GrossAmount, testServerKey)
+		return n
+	}
+	settled := MidtransNotification{
+		OrderID:           "ORDER-1",
+		StatusCode:        "200",
+		GrossAmount:       "15000.00",
+		TransactionStatus: "settlement",
+	}
+
+	tests := []struct {
+		name       string
+		body       func() []byte
+		wantErr    error
+		wantResult Result
+	}{
+		{
+			name:       "valid signature",
+			body:       func() []byte { return marshal(t, signed(settled)) },
+			wantResult: ResultPaid,
+		},
+		{
+			name: "upper case signature",
+			body: func() []byte {
+				n := signed(settled)
+				n.SignatureKey = strings.ToUpper(n.SignatureKey)
+				return marshal(t, n)
+			},
+			wantResult: ResultPaid,
+		},
+		{
+			name: "signed with another server key",
+			body: func() []byte {
+				n := settled
+				n.SignatureKey = MidtransSignature(n.OrderID, n.StatusCode, n.GrossAmount, "SB-Mid-server-other")
+				return marshal(t, n)
+			},
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name: "amount changed after signing",
+			body: func() []byte {
+				n := signed(settled)
+				n.GrossAmount = "1.00"
+				return marshal(t, n)
+			},
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name: "status changed after signing",
+			body: func() []byte {
+				n := signed(MidtransNotification{OrderID: "ORDER-1", StatusCode: "407", GrossAmount: "15000.00", TransactionStatus: "expire"})
+				n.StatusCode = "200"
+				return marshal(t, n)
+			},
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:    "missing signature",
+			body:    func() []byte { return marshal(t, settled) },
+			wantErr: ErrInvalidSignature,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, err := m.VerifyCallback(nil, tt.body())
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("VerifyCallback() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("VerifyCallback() error: %v", err)
+			}
+			if status.OrderID != "ORDER-1" || status.Result != tt.wantResult || status.Amount != models.NewMoney(15000) {
+				t.Errorf("VerifyCallback() = %+v, want ORDER-1 %s 15000.00", status, tt.wantResult)
+			}
+		})
+	}
+}
+
+func TestMidtransVerifyCallbackInvalidBody(t *testing.T) {
+	m := NewMidtrans(testServerKey, "", "")
+	for _, body := range []string{``, `not json`, `{"status_code":"200"}`} {
+		if _, err := m.VerifyCallback(nil, []byte(body)); err == nil || errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("VerifyCallback(%q) error = %v, want invalid notification", body, err)
+		}
+	}
+}
+
+func TestMidtransNotificationResult(t *testing.T) {
+	tests := []struct {
+		status, fraud string
+		want          Result
+	}{
+		{"settlement", "", ResultPaid},
+		{"capture", "accept", ResultPaid},
+		{"capture", "challenge", ResultPending},
+		{"pending", "", ResultPending},
+		{"deny", "", ResultFailed},
+		{"expire", "", ResultExpired},
+		{"cancel", "", ResultCancelled},
+	}
+
+	for _, tt := range tests {
+		n := MidtransNotification{TransactionStatus: tt.status, FraudStatus: tt.fraud}
+		if got := n.Result(); got != tt.want {
+			t.Errorf("Result(%s, %q) = %s, want %s", tt.status, tt.fraud, got, tt.want)
+		}
+	}
+}
+
+func marshal(t *testing.T, v interface{}) []byte {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
@@ -0,0 +1,229 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
+)
+
+var (
+	ErrInvalidSignature  = errors.New("gateway: invalid callback signature")
+	ErrFractionalAmount  = errors.New("gateway: amount must be whole rupiah")
+	ErrUnsupportedMethod = errors.New("gateway: unsupported payment method")
+	ErrRefundUnsupported = errors.New("gateway: payment method cannot be refunded")
+	ErrUnknownProvider   = errors.New("gateway: unknown payment provider")
+)
+
+// MethodQRIS is a dynamic QRIS code for the exact amount, which the payer
+// scans with any Indonesian bank or e-wallet app.
+const MethodQRIS = "qris"
+
+// Result is the outcome of a gateway transaction.
+type Result string
+
+const (
+	ResultPending   Result = "pending"
+	ResultPaid      Result = "paid"
+	ResultFailed    Result = "failed"
+	ResultExpired   Result = "expired"
+	ResultCancelled Result = "cancelled"
+)
+
+// PaymentStatus maps the result to the status stored on the payment.
+func (r Result) PaymentStatus() models.PaymentStatus {
+	switch r {
+	case ResultPaid:
+		return models.PaymentSuccess
+	case ResultFailed, ResultExpired:
+		return models.PaymentFailed
+	case ResultCancelled:
+		return models.PaymentCancelled
+	}
+	return models.PaymentPending
+}
+
+type Customer struct {
+	Name  string
+	Email string
+	Phone string
+}
+
+type ChargeRequest struct {
+	OrderID     string // Our payment ID
+	Amount      models.Money
+	Method      string
+	Description string
+	Customer    Customer
+	Expiry      time.Duration
+}
+
+// Charge is what the user needs to complete a payment: a payment page, a
+// bank and virtual account number, an e-wallet checkout link, or a QRIS
+// payload to render as a QR code (some providers also host an image of it).
+// Reference identifies the transaction at the provider for Status.
+type Charge struct {
+	Reference   string     `json:"reference"`
+	Token       string     `json:"token,omitempty"`
+	RedirectURL string     `json:"redirect_url,omitempty"`
+	Bank        string     `json:"bank,omitempty"`
+	VANumber    string     `json:"va_number,omitempty"`
+	QRString    string     `json:"qr_string,omitempty"`
+	QRImageURL  string     `json:"qr_image_url,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+// Status is the state of a transaction at the provider, from a verified
+// callback or a status query.
+type Status struct {
+	OrderID   string
+	Reference string // Pass to Status to confirm this state with the provider
+	Result    Result
+	Amount    models.Money
+}
+
+type RefundRequest struct {
+	OrderID   string
+	Reference string
+	Amount    models.Money
+	Reason    string
+}
+
+// SavedChargeRequest charges a payment method the customer saved at the
+// provider earlier. Token is the provider's reference to it, such as a
+// saved card token or a payment method ID.
+type SavedChargeRequest struct {
+	OrderID     string // Our payment ID
+	Amount      models.Money
+	Method      string
+	Token       string
+	Description string
+	Customer    Customer
+}
+
+// SavedMethodCharger is implemented by providers that can charge a saved
+// payment method without the customer present, as auto top-up does.
+type SavedMethodCharger interface {
+	// SavedMethods lists the kinds of payment method that can be saved.
+	SavedMethods() []string
+	// ChargeSaved charges the method and returns the state of the charge;
+	// a pending charge is settled later through the callback.
+	ChargeSaved(ctx context.Context, req SavedChargeRequest) (*Status, error)
+}
+
+// Provider is a payment gateway. Callbacks are only trusted after
+// VerifyCallback accepted them, and callers confirm the reported state with
+// Status before moving money.
+type Provider interface {
+	Name() string
+	// Methods lists the payment methods the provider can take.
+	Methods() []string
+	CreateCharge(ctx context.Context, req ChargeRequest) (*Charge, error)
+	// VerifyCallback authenticates a callback request and parses it.
+	VerifyCallback(header http.Header, body []byte) (*Status, error)
+	Status(ctx context.Context, reference string) (*Status, error)
+	Refund(ctx context.Context, req RefundRequest) error
+}
+
+// Registry picks the provider for each payment method.
+type Registry struct {
+	providers map[string]Provider
+	methods   map[string]Provider
+	order     []string
+}
+
+// NewRegistry routes every method to the first provider that supports it,
+// unless overrides names a provider for the method. Overrides for a
+// provider that is not enabled are an error.
+func NewRegistry(providers []Provider, overrides map[string]string) (*Registry, error) {
+	r := &Registry{providers: map[string]Provider{}, methods: map[string]Provider{}}
+	for _, p := range providers {
+		r.providers[p.Name()] = p
+		for _, method := range p.Methods() {
+			if _, taken := r.methods[method]; !taken {
+				r.methods[method] = p
+				r.order = append(r.order, method)
+			}
+		}
+	}
+
+	for method, name := range overrides {
+		p, ok := r.providers[name]
+		if !ok {
+			return nil, errors.New("gateway: provider " + name + " for method " + method + " is not enabled")
+		}
+		supported := false
+		for _, m := range p.Methods() {
+			supported = supported || m == method
+		}
+		if !supported {
+			return nil, errors.New("gateway: provider " + name + " does not support method " + method)
+		}
+		if _, taken := r.methods[method]; !taken {
+			r.order = append(r.order, method)
+		}
+		r.methods[method] = p
+	}
+	return r, nil
+}
+
+// ForMethod returns the provider taking payments of a method. An empty
+// method picks the first configured one.
+func (r *Registry) ForMethod(method string) (Provider, string, error) {
+	if method == "" {
+		if len(r.order) == 0 {
+			return nil, "", ErrUnsupportedMethod
+		}
+		method = r.order[0]
+	}
+	p, ok := r.methods[method]
+	if !ok {
+		return nil, "", ErrUnsupportedMethod
+	}
+	return p, method, nil
+}
+
+// Provider returns an enabled provider by name.
+func (r *Registry) Provider(name string) (Provider, error) {
+	p, ok := r.providers[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return p, nil
+}
+
+// Methods returns the available payment methods and their providers.
+func (r *Registry) Methods() map[string]string {
+	methods := make(map[string]string, len(r.methods))
+	for method, p := range r.methods {
+		methods[method] = p.Name()
+	}
+	return methods
+}
+
+// Providers returns the names of the enabled providers.
+func (r *Registry) Providers() []string {
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func wholeRupiah(amount models.Money) (int64, error) {
+	if amount.Minor()%100 != 0 {
+		return 0, ErrFractionalAmount
+	}
+	return amount.Minor() / 100, nil
+}
+
+func expiryMinutes(expiry time.Duration) int {
+	if minutes := int(expiry.Minutes()); minutes > 0 {
+		return minutes
+	}
+	return 60
+}
@@ -0,0 +1,541 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
+)
+
+// Xendit payment methods: a hosted invoice page, closed single-use virtual
+// accounts, and e-wallet charges. MethodQRIS uses the QR codes API.
+const (
+	MethodInvoice   = "invoice"
+	MethodMandiriVA = "mandiri_va"
+	MethodPermataVA = "permata_va"
+	MethodOVO       = "ovo"
+	MethodDANA      = "dana"
+	MethodShopeePay = "shopeepay"
+)
+
+var xenditBanks = map[string]string{
+	MethodBCAVA:     "BCA",
+	MethodBNIVA:     "BNI",
+	MethodBRIVA:     "BRI",
+	MethodMandiriVA: "MANDIRI",
+	MethodPermataVA: "PERMATA",
+}
+
+var xenditWallets = map[string]string{
+	MethodOVO:       "ID_OVO",
+	MethodDANA:      "ID_DANA",
+	MethodShopeePay: "ID_SHOPEEPAY",
+}
+
+// Xendit references carry the product so Status knows which API to ask.
+const (
+	xenditInvoiceRef   = "invoice:"
+	xenditVARef        = "va:"
+	xenditVAPaymentRef = "va_payment:"
+	xenditEWalletRef   = "ewallet:"
+	xenditQRRef        = "qr:"
+	xenditRequestRef   = "pr:"
+)
+
+// xenditQRAPIVersion selects the QR codes API version with reference_id
+// and payment events.
+const xenditQRAPIVersion = "2022-07-31"
+
+var (
+	_ Provider           = (*Xendit)(nil)
+	_ SavedMethodCharger = (*Xendit)(nil)
+)
+
+// Xendit talks to the Xendit invoice, virtual account, e-wallet and QR code
+// APIs.
+// Callbacks are authenticated with the account's callback verification
+// token.
+type Xendit struct {
+	secretKey     string
+	callbackToken string
+	apiURL        string
+	redirectURL   string
+	client        *http.Client
+}
+
+// NewXendit creates the adapter. redirectURL is where invoices and e-wallet
+// checkouts send the user after paying.
+func NewXendit(secretKey, callbackToken, apiURL, redirectURL string) *Xendit {
+	return &Xendit{
+		secretKey:     secretKey,
+		callbackToken: callbackToken,
+		apiURL:        strings.TrimRight(apiURL, "/"),
+		redirectURL:   redirectURL,
+		client:        &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+func (x *Xendit) Name() string { return "xendit" }
+
+func (x *Xendit) Methods() []string {
+	return []string{MethodInvoice, MethodBCAVA, MethodBNIVA, MethodBRIVA, MethodMandiriVA, MethodPermataVA,
+		MethodOVO, MethodDANA, MethodShopeePay, MethodQRIS}
+}
+
+func (x *Xendit) CreateCharge(ctx context.Context, req ChargeRequest) (*Charge, error) {
+	amount, err := wholeRupiah(req.Amount)
+	if err != nil {
+		return nil, err
+	}
+	expiry := time.Duration(expiryMinutes(req.Expiry)) * time.Minute
+
+	if req.Method == MethodInvoice {
+		var resp xenditInvoice
+		body := map[string]interface{}{
+			"external_id":          req.OrderID,
+			"amount":               amount,
+			"description":          req.Description,
+			"payer_email":          req.Customer.Email,
+			"invoice_duration":     int(expiry.Seconds()),
+			"currency":             models.Currency,
+			"success_redirect_url": x.redirectURL,
+		}
+		if err := x.do(ctx, http.MethodPost, "/v2/invoices", body, &resp); err != nil {
+			return nil, err
+		}
+		charge := &Charge{Reference: xenditInvoiceRef + resp.ID, RedirectURL: resp.InvoiceURL}
+		if resp.ExpiryDate != nil {
+			charge.ExpiresAt = resp.ExpiryDate
+		}
+		return charge, nil
+	}
+
+	if bank, ok := xenditBanks[req.Method]; ok {
+		var resp struct {
+			ID             string    `json:"id"`
+			AccountNumber  string    `json:"account_number"`
+			BankCode       string    `json:"bank_code"`
+			ExpirationDate time.Time `json:"expiration_date"`
+		}
+		body := map[string]interface{}{
+			"external_id":     req.OrderID,
+			"bank_code":       bank,
+			"name":            req.Customer.Name,
+			"expected_amount": amount,
+			"is_closed":       true,
+			"is_single_use":   true,
+			"expiration_date": time.Now().Add(expiry).UTC().Format(time.RFC3339),
+		}
+		if err := x.do(ctx, http.MethodPost, "/callback_virtual_accounts", body, &resp); err != nil {
+			return nil, err
+		}
+		return &Charge{
+			Reference: xenditVARef + resp.ID,
+			Bank:      strings.ToLower(resp.BankCode),
+			VANumber:  resp.AccountNumber,
+			ExpiresAt: &resp.ExpirationDate,
+		}, nil
+	}
+
+	if channel, ok := xenditWallets[req.Method]; ok {
+		var resp xenditEWalletCharge
+		properties := map[string]interface{}{"success_redirect_url": x.redirectURL}
+		if req.Method == MethodOVO {
+			properties = map[string]interface{}{"mobile_number": req.Customer.Phone}
+		}
+		body := map[string]interface{}{
+			"reference_id":       req.OrderID,
+			"currency":           models.Currency,
+			"amount":             amount,
+			"checkout_method":    "ONE_TIME_PAYMENT",
+			"channel_code":       channel,
+			"channel_properties": properties,
+		}
+		if err := x.do(ctx, http.MethodPost, "/ewallets/charges", body, &resp); err != nil {
+			return nil, err
+		}
+		charge := &Charge{Reference: xenditEWalletRef + resp.ID}
+		for _, url := range []string{resp.Actions.MobileDeeplinkURL, resp.Actions.MobileWebURL, resp.Actions.DesktopWebURL} {
+			if url != "" {
+				charge.RedirectURL = url
+				break
+			}
+		}
+		return charge, nil
+	}
+
+	if req.Method == MethodQRIS {
+		var resp xenditQRCode
+		body := map[string]interface{}{
+			"reference_id": req.OrderID,
+			"type":         "DYNAMIC",
+			"currency":     models.Currency,
+			"amount":       amount,
+			"expires_at":   time.Now().Add(expiry).UTC().Format(time.RFC3339),
+		}
+		if err := x.do(ctx, http.MethodPost, "/qr_codes", body, &resp); err != nil {
+			return nil, err
+		}
+		return &Charge{Reference: xenditQRRef + resp.ID, QRString: resp.QRString, ExpiresAt: resp.ExpiresAt}, nil
+	}
+
+	return nil, ErrUnsupportedMethod
+}
+
+type xenditInvoice struct {
+	ID         string     `json:"id"`
+	ExternalID string     `json:"external_id"`
+	Status     string     `json:"status"`
+	Amount     float64    `json:"amount"`
+	InvoiceURL string     `json:"invoice_url"`
+	ExpiryDate *time.Time `json:"expiry_date"`
+}
+
+func (i xenditInvoice) status() *Status {
+	result := ResultPending
+	switch i.Status {
+	case "PAID", "SETTLED":
+		result = ResultPaid
+	case "EXPIRED":
+		result = ResultExpired
+	}
+	return &Status{OrderID: i.ExternalID, Reference: xenditInvoiceRef + i.ID, Result: result, Amount: models.NewMoney(i.Amount)}
+}
+
+type xenditEWalletCharge struct {
+	ID           string  `json:"id"`
+	ReferenceID  string  `json:"reference_id"`
+	Status       string  `json:"status"`
+	ChargeAmount float64 `json:"charge_amount"`
+	Actions      struct {
+		DesktopWebURL     string `json:"desktop_web_checkout_url"`
+		MobileWebURL      string `json:"mobile_web_checkout_url"`
+		MobileDeeplinkURL string `json:"mobile_deeplink_checkout_url"`
+	} `json:"actions"`
+}
+
+func (c xenditEWalletCharge) status() *Status {
+	result := ResultPending
+	switch c.Status {
+	case "SUCCEEDED":
+		result = ResultPaid
+	case "FAILED":
+		result = ResultFailed
+	case "VOIDED":
+		result = ResultCancelled
+	}
+	return &Status{OrderID: c.ReferenceID, Reference: xenditEWalletRef + c.ID, Result: result, Amount: models.NewMoney(c.ChargeAmount)}
+}
+
+type xenditQRCode struct {
+	ID          string     `json:"id"`
+	ReferenceID string     `json:"reference_id"`
+	Status      string     `json:"status"`
+	Amount      float64    `json:"amount"`
+	QRString    string     `json:"qr_string"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+}
+
+// xenditQRPayment is a payment made by scanning a QR code.
+type xenditQRPayment struct {
+	QRID        string  `json:"qr_id"`
+	ReferenceID string  `json:"reference_id"`
+	Status      string  `json:"status"`
+	Amount      float64 `json:"amount"`
+}
+
+func (p xenditQRPayment) status() *Status {
+	result := ResultPending
+	if p.Status == "SUCCEEDED" {
+		result = ResultPaid
+	}
+	return &Status{OrderID: p.ReferenceID, Reference: xenditQRRef + p.QRID, Result: result, Amount: models.NewMoney(p.Amount)}
+}
+
+// xenditPaymentRequest is a charge of a saved payment method.
+type xenditPaymentRequest struct {
+	ID          string  `json:"id"`
+	ReferenceID string  `json:"reference_id"`
+	Status      string  `json:"status"`
+	Amount      float64 `json:"amount"`
+}
+
+// status maps the request state. A request that needs the customer to act
+// cannot complete without them, so it counts as failed.
+func (r xenditPaymentRequest) status() *Status {
+	result := ResultPending
+	switch r.Status {
+	case "SUCCEEDED":
+		result = ResultPaid
+	case "FAILED", "REQUIRES_ACTION":
+		result = ResultFailed
+	case "CANCELED", "VOIDED":
+		result = ResultCancelled
+	}
+	return &Status{OrderID: r.ReferenceID, Reference: xenditRequestRef + r.ID, Result: result, Amount: models.NewMoney(r.Amount)}
+}
+
+type xenditVAPayment struct {
+	PaymentID  string  `json:"payment_id"`
+	ExternalID string  `json:"external_id"`
+	Amount     float64 `json:"amount"`
+}
+
+// VerifyCallback checks the x-callback-token header and parses invoice,
+// virtual account payment, e-wallet, QR payment and saved method payment
+// callbacks.
+func (x *Xendit) VerifyCallback(header http.Header, body []byte) (*Status, error) {
+	token := header.Get("X-Callback-Token")
+	if x.callbackToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(x.callbackToken)) != 1 {
+		return nil, ErrInvalidSignature
+	}
+
+	var probe struct {
+		Event      string          `json:"event"`
+		Data       json.RawMessage `json:"data"`
+		PaymentID  string          `json:"payment_id"`
+		InvoiceURL string          `json:"invoice_url"`
+		Status     string          `json:"status"`
+	}
+	if err := json.Unmarshal(body, &probe); err != nil {
+		return nil, fmt.Errorf("xendit: invalid callback")
+	}
+
+	switch {
+	case strings.HasPrefix(probe.Event, "ewallet."):
+		var charge xenditEWalletCharge
+		if err := json.Unmarshal(probe.Data, &charge); err != nil {
+			return nil, fmt.Errorf("xendit: invalid e-wallet callback")
+		}
+		return charge.status(), nil
+	case strings.HasPrefix(probe.Event, "payment."):
+		var payment struct {
+			PaymentRequestID string  `json:"payment_request_id"`
+			ReferenceID      string  `json:"reference_id"`
+			Status           string  `json:"status"`
+			Amount           float64 `json:"amount"`
+		}
+		if err := json.Unmarshal(probe.Data, &payment); err != nil || payment.PaymentRequestID == "" {
+			return nil, fmt.Errorf("xendit: invalid payment callback")
+		}
+		request := xenditPaymentRequest{ID: payment.PaymentRequestID, ReferenceID: payment.ReferenceID,
+			Status: payment.Status, Amount: payment.Amount}
+		return request.status(), nil
+	case probe.Event == "qr.payment":
+		var payment xenditQRPayment
+		if err := json.Unmarshal(probe.Data, &payment); err != nil {
+			return nil, fmt.Errorf("xendit: invalid QR payment callback")
+		}
+		return payment.status(), nil
+	case probe.PaymentID != "" && probe.Status == "":
+		var payment xenditVAPayment
+		if err := json.Unmarshal(body, &payment); err != nil {
+			return nil, fmt.Errorf("xendit: invalid virtual account callback")
+		}
+		return &Status{
+			OrderID:   payment.ExternalID,
+			Reference: xenditVAPaymentRef + payment.PaymentID,
+			Result:    ResultPaid,
+			Amount:    models.NewMoney(payment.Amount),
+		}, nil
+	default:
+		var invoice xenditInvoice
+		if err := json.Unmarshal(body, &invoice); err != nil || invoice.ID == "" {
+			return nil, fmt.Errorf("xendit: unrecognised callback")
+		}
+		return invoice.status(), nil
+	}
+}
+
+func (x *Xendit) Status(ctx context.Context, reference string) (*Status, error) {
+	switch {
+	case strings.HasPrefix(reference, xenditInvoiceRef):
+		var invoice xenditInvoice
+		if err := x.do(ctx, http.MethodGet, "/v2/invoices/"+strings.TrimPrefix(reference, xenditInvoiceRef), nil, &invoice); err != nil {
+			return nil, err
+		}
+		return invoice.status(), nil
+
+	case strings.HasPrefix(reference, xenditVAPaymentRef):
+		var payment xenditVAPayment
+		path := "/callback_virtual_account_payments/payment_id=" + strings.TrimPrefix(reference, xenditVAPaymentRef)
+		if err := x.do(ctx, http.MethodGet, path, nil, &payment); err != nil {
+			return nil, err
+		}
+		return &Status{OrderID: payment.ExternalID, Reference: reference, Result: ResultPaid, Amount: models.NewMoney(payment.Amount)}, nil
+
+	case strings.HasPrefix(reference, xenditVARef):
+		// The account itself does not say whether it was paid; payments are
+		// confirmed through the payment ID from the callback. An account
+		// that closed after its expiry date was never paid.
+		var va struct {
+			ExternalID     string    `json:"external_id"`
+			Status         string    `json:"status"`
+			ExpectedAmount float64   `json:"expected_amount"`
+			ExpirationDate time.Time `json:"expiration_date"`
+		}
+		if err := x.do(ctx, http.MethodGet, "/callback_virtual_accounts/"+strings.TrimPrefix(reference, xenditVARef), nil, &va); err != nil {
+			return nil, err
+		}
+		result := ResultPending
+		if va.Status == "INACTIVE" && time.Now().After(va.ExpirationDate) {
+			result = ResultExpired
+		}
+		return &Status{OrderID: va.ExternalID, Reference: reference, Result: result, Amount: models.NewMoney(va.ExpectedAmount)}, nil
+
+	case strings.HasPrefix(reference, xenditEWalletRef):
+		var charge xenditEWalletCharge
+		if err := x.do(ctx, http.MethodGet, "/ewallets/charges/"+strings.TrimPrefix(reference, xenditEWalletRef), nil, &charge); err != nil {
+			return nil, err
+		}
+		return charge.status(), nil
+
+	case strings.HasPrefix(reference, xenditRequestRef):
+		var request xenditPaymentRequest
+		if err := x.do(ctx, http.MethodGet, "/payment_requests/"+strings.TrimPrefix(reference, xenditRequestRef), nil, &request); err != nil {
+			return nil, err
+		}
+		return request.status(), nil
+
+	case strings.HasPrefix(reference, xenditQRRef):
+		// A dynamic code takes a single payment; without one it is pending
+		// until it expires
+		id := strings.TrimPrefix(reference, xenditQRRef)
+		var payments struct {
+			Data []xenditQRPayment `json:"data"`
+		}
+		if err := x.do(ctx, http.MethodGet, "/qr_codes/"+id+"/payments", nil, &payments); err != nil {
+			return nil, err
+		}
+		for _, payment := range payments.Data {
+			if payment.Status == "SUCCEEDED" {
+				return payment.status(), nil
+			}
+		}
+		var qr xenditQRCode
+		if err := x.do(ctx, http.MethodGet, "/qr_codes/"+id, nil, &qr); err != nil {
+			return nil, err
+		}
+		result := ResultPending
+		if qr.Status == "INACTIVE" {
+			result = ResultExpired
+		}
+		return &Status{OrderID: qr.ReferenceID, Reference: reference, Result: result, Amount: models.NewMoney(qr.Amount)}, nil
+	}
+	return nil, fmt.Errorf("xendit: unknown reference %q", reference)
+}
+
+func (x *Xendit) SavedMethods() []string {
+	return []string{MethodCard, MethodOVO, MethodDANA, MethodShopeePay}
+}
+
+// ChargeSaved charges a reusable payment method through the payment
+// requests API; Token is the payment method ID.
+func (x *Xendit) ChargeSaved(ctx context.Context, req SavedChargeRequest) (*Status, error) {
+	amount, err := wholeRupiah(req.Amount)
+	if err != nil {
+		return nil, err
+	}
+	body := map[string]interface{}{
+		"reference_id":      req.OrderID,
+		"amount":            amount,
+		"currency":          models.Currency,
+		"payment_method_id": req.Token,
+		"description":       req.Description,
+		"capture_method":    "AUTOMATIC",
+	}
+	var request xenditPaymentRequest
+	if err := x.do(ctx, http.MethodPost, "/payment_requests", body, &request); err != nil {
+		return nil, err
+	}
+	return request.status(), nil
+}
+
+// Refund returns money to the payer. Invoices and e-wallet charges can be
+// refunded; bank transfers to virtual accounts cannot.
+func (x *Xendit) Refund(ctx context.Context, req RefundRequest) error {
+	amount, err := wholeRupiah(req.Amount)
+	if err != nil {
+		return err
+	}
+	var resp struct {
+		ID     string `json:"id"`
+		Status string `json:"status"`
+	}
+
+	switch {
+	case strings.HasPrefix(req.Reference, xenditInvoiceRef):
+		body := map[string]interface{}{
+			"invoice_id":   strings.TrimPrefix(req.Reference, xenditInvoiceRef),
+			"reference_id": req.OrderID,
+			"amount":       amount,
+			"currency":     models.Currency,
+			"reason":       "REQUESTED_BY_CUSTOMER",
+			"metadata":     map[string]string{"reason": req.Reason},
+		}
+		if err := x.do(ctx, http.MethodPost, "/refunds", body, &resp); err != nil {
+			return err
+		}
+	case strings.HasPrefix(req.Reference, xenditEWalletRef):
+		body := map[string]interface{}{"amount": amount, "reason": "REQUESTED_BY_CUSTOMER"}
+		path := "/ewallets/charges/" + strings.TrimPrefix(req.Reference, xenditEWalletRef) + "/refunds"
+		if err := x.do(ctx, http.MethodPost, path, body, &resp); err != nil {
+			return err
+		}
+	default:
+		return ErrRefundUnsupported
+	}
+
+	if resp.Status == "FAILED" {
+		return fmt.Errorf("xendit refund %s failed", resp.ID)
+	}
+	return nil
+}
+
+func (x *Xendit) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, x.apiURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(x.secretKey, "")
+	req.Header.Set("Content-Type", "application/json")
+	if strings.HasPrefix(path, "/qr_codes") {
+		req.Header.Set("api-version", xenditQRAPIVersion)
+	}
+
+	resp, err := x.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			ErrorCode string `json:"error_code"`
+			Message   string `json:"message"`
+		}
+		json.Unmarshal(data, &apiErr)
+		return fmt.Errorf("xendit: %s: %s %s", resp.Status, apiErr.ErrorCode, apiErr.Message)
+	}
+	return json.Unmarshal(data, out)
+}
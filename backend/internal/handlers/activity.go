@@ -20,7 +20,7 @@ func logActivity(c *gin.Context, db *gorm.DB, action, target, detail string) {
 	}
 
 	activity := models.ActivityLog{
-		AdminID:   adminID,
+		AdminID:   &adminID,
 		AdminName: admin.Name,
 		Action:    action,
 		Target:    target,
@@ -30,3 +30,14 @@ func logActivity(c *gin.Context, db *gorm.DB, action, target, detail string) {
 
 	db.Create(&activity)
 }
+
+// adminIDFrom returns the authenticated user's ID, or nil outside an
+// authenticated request.
+func adminIDFrom(c *gin.Context) *uuid.UUID {
+	raw, exists := c.Get("user_id")
+	if !exists {
+		return nil
+	}
+	id := raw.(uuid.UUID)
+	return &id
+}
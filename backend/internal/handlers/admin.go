@@ -2,9 +2,11 @@ package handlers
 
 import (
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
+	"github.com/Julianarwansah/sistemcharging/backend/internal/services"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
@@ -16,13 +18,15 @@ type AdminHandler struct {
 }
 
 func (h *AdminHandler) GetStats(c *gin.Context) {
-	var totalRevenue float64
+	var totalRevenue models.Money
 	var totalUsers int64
 	var activeStations int64
 	var totalEnergy float64
 
-	// Total Revenue from successful payments
-	h.DB.Model(&models.Payment{}).Where("status = ?", models.PaymentSuccess).Select("COALESCE(SUM(amount), 0)").Scan(&totalRevenue)
+	// Total Revenue from successful payments, net of partial refunds
+	h.DB.Model(&models.Payment{}).Where("purpose = ? AND status IN ?", models.PurposeSession,
+		[]models.PaymentStatus{models.PaymentSuccess, models.PaymentPartiallyRefunded}).
+		Select("COALESCE(SUM(amount - refunded_amount), 0)").Scan(&totalRevenue)
 
 	// Total Users
 	h.DB.Model(&models.User{}).Count(&totalUsers)
@@ -91,8 +95,8 @@ func (h *AdminHandler) ResetData(c *gin.Context) {
 			return err
 		}
 
-		// Reset all user balances
-		if err := tx.Model(&models.User{}).Where("1 = 1").Update("balance", 0).Error; err != nil {
+		// Reset all user balances through the ledger, which keeps its history
+		if err := services.ResetWallets(tx, "Reset saldo oleh Admin"); err != nil {
 			return err
 		}
 
@@ -201,8 +205,8 @@ func (h *AdminHandler) UpdateUser(c *gin.Context) {
 
 func (h *AdminHandler) GetRevenueStats(c *gin.Context) {
 	type RevenuePoint struct {
-		Date  string  `json:"date"`
-		Total float64 `json:"total"`
+		Date  string       `json:"date"`
+		Total models.Money `json:"total"`
 	}
 
 	var stats []RevenuePoint
@@ -211,11 +215,11 @@ func (h *AdminHandler) GetRevenueStats(c *gin.Context) {
 	query := `
 		SELECT 
 			TO_CHAR(date_series, 'DD Mon') as date,
-			COALESCE(SUM(p.amount), 0) as total
+			COALESCE(SUM(p.amount - p.refunded_amount), 0) as total
 		FROM 
 			generate_series(CURRENT_DATE - INTERVAL '6 days', CURRENT_DATE, '1 day') AS date_series
 		LEFT JOIN 
-			payments p ON DATE(p.created_at) = date_series AND p.status = 'success'
+			payments p ON DATE(p.created_at) = date_series AND p.purpose = 'session' AND p.status IN ('success', 'partially_refunded')
 		GROUP BY 
 			date_series
 		ORDER BY 
@@ -258,11 +262,11 @@ func (h *AdminHandler) GetNotifications(c *gin.Context) {
 
 	// 2. Recent Payments
 	var recentPayments []models.Payment
-	h.DB.Preload("Session.User").Where("status = ?", models.PaymentSuccess).Order("created_at desc").Limit(5).Find(&recentPayments)
+	h.DB.Preload("User").Where("status = ?", models.PaymentSuccess).Order("created_at desc").Limit(5).Find(&recentPayments)
 	for _, p := range recentPayments {
 		userName := "Unknown"
-		if p.Session.User.Name != "" {
-			userName = p.Session.User.Name
+		if p.User != nil && p.User.Name != "" {
+			userName = p.User.Name
 		}
 		activities = append(activities, Activity{
 			Type:    "payment",
@@ -328,6 +332,16 @@ func (h *AdminHandler) UpdateSettings(c *gin.Context) {
 		return
 	}
 
+	// Tax and fee settings feed billing, so reject anything but amounts >= 0
+	for _, key := range []string{"tax_rate_percent", "service_fee_percent", "service_fee_flat"} {
+		if value, ok := req[key]; ok {
+			if v, err := strconv.ParseFloat(value, 64); err != nil || v < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Nilai " + key + " harus berupa angka positif"})
+				return
+			}
+		}
+	}
+
 	for key, value := range req {
 		if err := h.DB.Model(&models.SystemConfig{}).Where("config_key = ?", key).Update("config_value", value).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memperbarui pengaturan " + key})
@@ -341,10 +355,10 @@ func (h *AdminHandler) UpdateSettings(c *gin.Context) {
 
 func (h *AdminHandler) GetActiveStations(c *gin.Context) {
 	type StationMetric struct {
-		ID               string  `json:"id"`
-		Name             string  `json:"name"`
-		TransactionCount int     `json:"transaction_count"`
-		TotalRevenue     float64 `json:"total_revenue"`
+		ID               string       `json:"id"`
+		Name             string       `json:"name"`
+		TransactionCount int          `json:"transaction_count"`
+		TotalRevenue     models.Money `json:"total_revenue"`
 	}
 
 	var metrics []StationMetric
@@ -354,7 +368,7 @@ func (h *AdminHandler) GetActiveStations(c *gin.Context) {
 			s.id, 
 			s.name, 
 			COUNT(p.id) as transaction_count, 
-			COALESCE(SUM(p.amount), 0) as total_revenue
+			COALESCE(SUM(p.amount - p.refunded_amount), 0) as total_revenue
 		FROM 
 			stations s
 		LEFT JOIN 
@@ -362,7 +376,7 @@ func (h *AdminHandler) GetActiveStations(c *gin.Context) {
 		LEFT JOIN 
 			charging_sessions cs ON cs.connector_id = c.id
 		LEFT JOIN 
-			payments p ON p.session_id = cs.id AND p.status = 'success'
+			payments p ON p.session_id = cs.id AND p.status IN ('success', 'partially_refunded')
 		GROUP BY 
 			s.id, s.name
 		ORDER BY 
@@ -0,0 +1,298 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type AuthTokenHandler struct {
+	DB *gorm.DB
+}
+
+type TokenInput struct {
+	Type      models.AuthTokenType `json:"type" binding:"required,oneof=rfid virtual contract"`
+	UID       string               `json:"uid" binding:"max=100"` // Generated for virtual tokens
+	Label     string               `json:"label" binding:"max=100"`
+	ExpiresAt *time.Time           `json:"expires_at"`
+}
+
+type TokenUpdateInput struct {
+	Label     *string    `json:"label" binding:"omitempty,max=100"`
+	Blocked   *bool      `json:"blocked"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+func (in TokenUpdateInput) apply(token *models.AuthToken) {
+	if in.Label != nil {
+		token.Label = *in.Label
+	}
+	if in.Blocked != nil {
+		token.Blocked = *in.Blocked
+	}
+	if in.ExpiresAt != nil {
+		token.ExpiresAt = in.ExpiresAt
+	}
+}
+
+// issueToken registers a token for a user, billed to an organization when
+// orgID is set. Virtual tokens get a generated UID. It returns the HTTP
+// status and message of a failure.
+func issueToken(db *gorm.DB, userID uuid.UUID, orgID *uuid.UUID, input TokenInput) (*models.AuthToken, int, string) {
+	uid := models.NormalizeTokenUID(input.UID)
+	if input.Type == models.TokenVirtual {
+		b := make([]byte, 8)
+		if _, err := rand.Read(b); err != nil {
+			return nil, http.StatusInternalServerError, "Gagal membuat token"
+		}
+		uid = "VT" + strings.ToUpper(hex.EncodeToString(b))
+	}
+	if uid == "" {
+		return nil, http.StatusBadRequest, "UID token wajib diisi"
+	}
+
+	var existing int64
+	db.Model(&models.AuthToken{}).Where("uid = ?", uid).Count(&existing)
+	if existing > 0 {
+		return nil, http.StatusConflict, "Token sudah terdaftar"
+	}
+
+	token := models.AuthToken{
+		Type:           input.Type,
+		UID:            uid,
+		Label:          input.Label,
+		UserID:         userID,
+		OrganizationID: orgID,
+		ExpiresAt:      input.ExpiresAt,
+	}
+	if err := db.Create(&token).Error; err != nil {
+		return nil, http.StatusInternalServerError, "Gagal menyimpan token"
+	}
+	return &token, 0, ""
+}
+
+// List returns the tokens issued to the user, personal and fleet ones.
+func (h *AuthTokenHandler) List(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	var tokens []models.AuthToken
+	if err := h.DB.Preload("Organization").Where("user_id = ?", userID).
+		Order("created_at").Find(&tokens).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil token"})
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// Create registers an RFID card or contract ID of the user, or issues them
+// a virtual token. Sessions started with it are billed to their wallet.
+func (h *AuthTokenHandler) Create(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	var input TokenInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid"})
+		return
+	}
+
+	token, status, msg := issueToken(h.DB, userID, nil, input)
+	if token == nil {
+		c.JSON(status, gin.H{"error": msg})
+		return
+	}
+	c.JSON(http.StatusCreated, token)
+}
+
+// Update changes the label, blocked state or expiry of one of the user's
+// personal tokens, e.g. to block a lost card. Fleet tokens are managed by
+// the organization.
+func (h *AuthTokenHandler) Update(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	var token models.AuthToken
+	if err := h.DB.First(&token, "id = ? AND user_id = ? AND organization_id IS NULL", c.Param("id"), userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Token tidak ditemukan"})
+		return
+	}
+
+	var input TokenUpdateInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid"})
+		return
+	}
+
+	input.apply(&token)
+	if err := h.DB.Save(&token).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memperbarui token"})
+		return
+	}
+	c.JSON(http.StatusOK, token)
+}
+
+// Delete removes one of the user's personal tokens.
+func (h *AuthTokenHandler) Delete(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	result := h.DB.Where("id = ? AND user_id = ? AND organization_id IS NULL", c.Param("id"), userID).Delete(&models.AuthToken{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghapus token"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Token tidak ditemukan"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Token dihapus"})
+}
+
+// AdminList lists tokens, optionally of one user (user_id) or organization
+// (organization_id), or matching a UID.
+func (h *AuthTokenHandler) AdminList(c *gin.Context) {
+	query := h.DB.Preload("User").Preload("Organization")
+	if v := c.Query("user_id"); v != "" {
+		query = query.Where("user_id = ?", v)
+	}
+	if v := c.Query("organization_id"); v != "" {
+		query = query.Where("organization_id = ?", v)
+	}
+	if v := c.Query("uid"); v != "" {
+		query = query.Where("uid = ?", models.NormalizeTokenUID(v))
+	}
+
+	var tokens []models.AuthToken
+	if err := query.Order("created_at desc").Limit(200).Find(&tokens).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil token"})
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// AdminUpdate blocks or unblocks any token or changes its expiry.
+func (h *AuthTokenHandler) AdminUpdate(c *gin.Context) {
+	var token models.AuthToken
+	if err := h.DB.First(&token, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Token tidak ditemukan"})
+		return
+	}
+
+	var input TokenUpdateInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid"})
+		return
+	}
+
+	input.apply(&token)
+	if err := h.DB.Save(&token).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memperbarui token"})
+		return
+	}
+
+	action := "Ubah Token"
+	if input.Blocked != nil && *input.Blocked {
+		action = "Blokir Token"
+	} else if input.Blocked != nil {
+		action = "Buka Blokir Token"
+	}
+	logActivity(c, h.DB, action, token.UID, "Admin memperbarui token "+string(token.Type)+" "+token.UID)
+	c.JSON(http.StatusOK, token)
+}
+
+// Tokens lists the fleet tokens of the caller's organization.
+func (h *OrganizationHandler) Tokens(c *gin.Context) {
+	manager, ok := h.membership(c, true)
+	if !ok {
+		return
+	}
+
+	var tokens []models.AuthToken
+	if err := h.DB.Preload("User").Where("organization_id = ?", manager.OrganizationID).
+		Order("created_at").Find(&tokens).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil token"})
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// IssueToken registers a fleet card or token for a member. Sessions
+// started with it are billed to the organization.
+func (h *OrganizationHandler) IssueToken(c *gin.Context) {
+	manager, ok := h.membership(c, true)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		TokenInput
+		MemberID string `json:"member_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid"})
+		return
+	}
+
+	var member models.OrganizationMember
+	if err := h.DB.First(&member, "id = ? AND organization_id = ?", input.MemberID, manager.OrganizationID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Anggota tidak ditemukan"})
+		return
+	}
+
+	token, status, msg := issueToken(h.DB, member.UserID, &manager.OrganizationID, input.TokenInput)
+	if token == nil {
+		c.JSON(status, gin.H{"error": msg})
+		return
+	}
+	c.JSON(http.StatusCreated, token)
+}
+
+// UpdateToken changes the label, blocked state or expiry of a fleet token.
+func (h *OrganizationHandler) UpdateToken(c *gin.Context) {
+	manager, ok := h.membership(c, true)
+	if !ok {
+		return
+	}
+
+	var token models.AuthToken
+	if err := h.DB.First(&token, "id = ? AND organization_id = ?", c.Param("tokenId"), manager.OrganizationID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Token tidak ditemukan"})
+		return
+	}
+
+	var input TokenUpdateInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid"})
+		return
+	}
+
+	input.apply(&token)
+	if err := h.DB.Save(&token).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memperbarui token"})
+		return
+	}
+	c.JSON(http.StatusOK, token)
+}
+
+// DeleteToken removes a fleet token.
+func (h *OrganizationHandler) DeleteToken(c *gin.Context) {
+	manager, ok := h.membership(c, true)
+	if !ok {
+		return
+	}
+
+	result := h.DB.Where("id = ? AND organization_id = ?", c.Param("tokenId"), manager.OrganizationID).Delete(&models.AuthToken{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghapus token"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Token tidak ditemukan"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Token dihapus"})
+}
@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Julianarwansah/sistemcharging/backend/internal/autotopup"
+	"github.com/Julianarwansah/sistemcharging/backend/internal/gateway"
+	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
+	"github.com/Julianarwansah/sistemcharging/backend/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type AutoTopUpHandler struct {
+	DB *gorm.DB
+	// Payments holds the providers payment methods can be saved at
+	Payments *gateway.Registry
+}
+
+// ListMethods lists the user's saved payment methods.
+func (h *AutoTopUpHandler) ListMethods(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	var methods []models.SavedPaymentMethod
+	if err := h.DB.Where("user_id = ?", userID).Order("created_at").Find(&methods).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil metode pembayaran"})
+		return
+	}
+	c.JSON(http.StatusOK, methods)
+}
+
+// SaveMethod stores a payment method the app saved at the provider, e.g.
+// the saved card token from the provider's SDK, for auto top-up.
+func (h *AutoTopUpHandler) SaveMethod(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	var input struct {
+		Provider string `json:"provider" binding:"required"`
+		Method   string `json:"method" binding:"required"`
+		Token    string `json:"token" binding:"required,max=255"`
+		Label    string `json:"label" binding:"max=100"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid"})
+		return
+	}
+
+	provider, err := h.Payments.Provider(input.Provider)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Payment gateway tidak aktif"})
+		return
+	}
+	charger, ok := provider.(gateway.SavedMethodCharger)
+	supported := false
+	if ok {
+		for _, m := range charger.SavedMethods() {
+			supported = supported || m == input.Method
+		}
+	}
+	if !supported {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Metode pembayaran tidak dapat disimpan di " + input.Provider})
+		return
+	}
+
+	method := models.SavedPaymentMethod{
+		UserID:   userID,
+		Provider: input.Provider,
+		Method:   input.Method,
+		Token:    input.Token,
+		Label:    input.Label,
+	}
+	if err := h.DB.Create(&method).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menyimpan metode pembayaran"})
+		return
+	}
+	c.JSON(http.StatusCreated, method)
+}
+
+// DeleteMethod removes a saved payment method. Auto top-up using it is
+// switched off.
+func (h *AutoTopUpHandler) DeleteMethod(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	var method models.SavedPaymentMethod
+	if err := h.DB.First(&method, "id = ? AND user_id = ?", c.Param("id"), userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Metode pembayaran tidak ditemukan"})
+		return
+	}
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.AutoTopUp{}).Where("payment_method_id = ?", method.ID).
+			Updates(map[string]interface{}{"enabled": false, "payment_method_id": nil}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&method).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghapus metode pembayaran"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Metode pembayaran dihapus"})
+}
+
+// Get returns the user's auto top-up setting with this month's usage and
+// the latest auto top-up payments.
+func (h *AutoTopUpHandler) Get(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	var setting models.AutoTopUp
+	if err := h.DB.Preload("PaymentMethod").First(&setting, "user_id = ?", userID).Error; err != nil {
+		if err != gorm.ErrRecordNotFound {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil pengaturan top up otomatis"})
+			return
+		}
+		setting = models.AutoTopUp{UserID: userID}
+	}
+
+	now := time.Now()
+	used, err := autotopup.MonthlyUsage(h.DB, userID, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghitung pemakaian bulan ini"})
+		return
+	}
+
+	var payments []models.Payment
+	h.DB.Where("user_id = ? AND automatic", userID).Order("created_at desc").Limit(10).Find(&payments)
+
+	c.JSON(http.StatusOK, gin.H{
+		"setting":         setting,
+		"used_this_month": used,
+		"month_start":     services.MonthStart(h.DB, now),
+		"payments":        payments,
+	})
+}
+
+// Update configures auto top-up. Enabling it again resets the failure
+// count that switched it off.
+func (h *AutoTopUpHandler) Update(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	var input struct {
+		Enabled         bool         `json:"enabled"`
+		Threshold       models.Money `json:"threshold" binding:"gte=0"`
+		Amount          models.Money `json:"amount" binding:"required,gt=0"`
+		MonthlyCap      models.Money `json:"monthly_cap" binding:"required,gt=0"`
+		PaymentMethodID *uuid.UUID   `json:"payment_method_id"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid"})
+		return
+	}
+	if input.Amount.Minor()%100 != 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nominal top up harus dalam rupiah bulat"})
+		return
+	}
+	if input.MonthlyCap < input.Amount {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Batas bulanan tidak boleh lebih kecil dari nominal top up"})
+		return
+	}
+	if input.Enabled && input.PaymentMethodID == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Pilih metode pembayaran untuk top up otomatis"})
+		return
+	}
+	if input.PaymentMethodID != nil {
+		var method models.SavedPaymentMethod
+		if err := h.DB.First(&method, "id = ? AND user_id = ?", *input.PaymentMethodID, userID).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Metode pembayaran tidak ditemukan"})
+			return
+		}
+	}
+
+	var setting models.AutoTopUp
+	if err := h.DB.First(&setting, "user_id = ?", userID).Error; err != nil && err != gorm.ErrRecordNotFound {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil pengaturan top up otomatis"})
+		return
+	}
+	if input.Enabled && !setting.Enabled {
+		setting.FailureCount = 0
+		setting.LastError = ""
+	}
+	setting.UserID = userID
+	setting.Enabled = input.Enabled
+	setting.Threshold = input.Threshold
+	setting.Amount = input.Amount
+	setting.MonthlyCap = input.MonthlyCap
+	setting.PaymentMethodID = input.PaymentMethodID
+
+	if err := h.DB.Omit("PaymentMethod").Save(&setting).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menyimpan pengaturan top up otomatis"})
+		return
+	}
+	h.DB.Preload("PaymentMethod").First(&setting, "id = ?", setting.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Pengaturan top up otomatis disimpan",
+		"setting": setting,
+	})
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
+	"github.com/Julianarwansah/sistemcharging/backend/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type EstimateHandler struct {
+	DB *gorm.DB
+}
+
+// EstimateRequest describes a charge to estimate. The target is a SoC, an
+// amount of energy, or both, in which case the smaller one counts.
+type EstimateRequest struct {
+	// A connector, or a station and connector type to use that station's
+	// most powerful connector of the type
+	ConnectorID   string `json:"connector_id"`
+	StationID     string `json:"station_id"`
+	ConnectorType string `json:"connector_type"`
+
+	// A registered vehicle, or the battery capacity and power limit of one
+	VehicleID  string  `json:"vehicle_id"`
+	BatteryKWH float64 `json:"battery_kwh" binding:"omitempty,gt=0,lte=500"`
+	MaxPowerKW float64 `json:"max_power_kw" binding:"omitempty,gte=1,lte=1000"`
+
+	CurrentSoC int     `json:"current_soc" binding:"min=0,max=99"`
+	TargetSoC  int     `json:"target_soc" binding:"omitempty,min=1,max=100"`
+	TargetKWH  float64 `json:"target_kwh" binding:"omitempty,gt=0,lte=500"`
+
+	// Time-of-use rates are priced from this time, by default now
+	StartAt *time.Time `json:"start_at"`
+}
+
+// Create estimates the energy, duration and cost of a charge without
+// creating anything.
+func (h *EstimateHandler) Create(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	var req EstimateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.TargetSoC == 0 && req.TargetKWH == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Tentukan target_soc atau target_kwh"})
+		return
+	}
+
+	connector, ok := h.connector(c, &req)
+	if !ok {
+		return
+	}
+
+	// The vehicle limits the power and its battery the energy
+	estimateConnector := connector
+	batteryKWH := req.BatteryKWH
+	if req.VehicleID != "" {
+		var vehicle models.Vehicle
+		if err := h.DB.First(&vehicle, "id = ? AND user_id = ?", req.VehicleID, userID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Kendaraan tidak ditemukan"})
+			return
+		}
+		if !vehicle.Supports(connector.ConnectorType) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":           services.ErrVehicleIncompatible.Error(),
+				"connector_type":  connector.ConnectorType,
+				"connector_types": vehicle.ConnectorTypes,
+			})
+			return
+		}
+		estimateConnector = services.VehicleConnector(connector, &vehicle)
+		batteryKWH = vehicle.BatteryKWH
+	} else if req.MaxPowerKW > 0 && req.MaxPowerKW < connector.PowerKW {
+		estimateConnector.PowerKW = req.MaxPowerKW
+	}
+
+	var energyKWH float64
+	if req.TargetSoC > 0 {
+		if batteryKWH == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "target_soc membutuhkan vehicle_id atau battery_kwh"})
+			return
+		}
+		if req.TargetSoC <= req.CurrentSoC {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "target_soc harus lebih besar dari current_soc"})
+			return
+		}
+		energyKWH = batteryKWH * float64(req.TargetSoC-req.CurrentSoC) / 100
+	}
+	if req.TargetKWH > 0 && (energyKWH == 0 || req.TargetKWH < energyKWH) {
+		energyKWH = req.TargetKWH
+	}
+	cappedAtBattery := false
+	if room := batteryKWH * float64(100-req.CurrentSoC) / 100; batteryKWH > 0 && energyKWH > room {
+		energyKWH = room
+		cappedAtBattery = true
+	}
+	energyKWH = math.Round(energyKWH*1000) / 1000
+
+	tariff, err := services.ResolveTariff(h.DB, connector)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memuat tarif"})
+		return
+	}
+
+	start := time.Now()
+	if req.StartAt != nil && req.StartAt.After(start) {
+		start = *req.StartAt
+	}
+
+	estimate := services.EstimateCharge(estimateConnector, tariff, services.LoadChargeRules(h.DB),
+		energyKWH, batteryKWH, req.CurrentSoC, start, services.TariffLocation(h.DB))
+
+	c.JSON(http.StatusOK, gin.H{
+		"connector":         connector,
+		"tariff":            tariff,
+		"battery_kwh":       batteryKWH,
+		"capped_at_battery": cappedAtBattery,
+		"estimate":          estimate,
+	})
+}
+
+// connector loads the connector of an estimate request, or picks the
+// station's most powerful connector of the requested type, preferring
+// available ones. It writes the error response when there is none.
+func (h *EstimateHandler) connector(c *gin.Context, req *EstimateRequest) (models.Connector, bool) {
+	var connector models.Connector
+	if req.ConnectorID != "" {
+		if err := h.DB.First(&connector, "id = ?", req.ConnectorID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Connector tidak ditemukan"})
+			return connector, false
+		}
+		return connector, true
+	}
+	if req.StationID == "" || req.ConnectorType == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Tentukan connector_id, atau station_id dan connector_type"})
+		return connector, false
+	}
+
+	var connectors []models.Connector
+	if err := h.DB.Where("station_id = ?", req.StationID).Find(&connectors).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Stasiun tidak ditemukan"})
+		return connector, false
+	}
+	found := false
+	want := models.NormalizeConnectorType(req.ConnectorType)
+	for _, candidate := range connectors {
+		if models.NormalizeConnectorType(candidate.ConnectorType) != want {
+			continue
+		}
+		available := candidate.Status == models.ConnectorAvailable
+		bestAvailable := found && connector.Status == models.ConnectorAvailable
+		if !found || available && !bestAvailable || available == bestAvailable && candidate.PowerKW > connector.PowerKW {
+			connector = candidate
+			found = true
+		}
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Stasiun tidak memiliki konektor " + req.ConnectorType})
+		return connector, false
+	}
+	return connector, true
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
+	"github.com/Julianarwansah/sistemcharging/backend/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Invoices lists the caller's organization invoices, newest first.
+func (h *OrganizationHandler) Invoices(c *gin.Context) {
+	manager, ok := h.membership(c, true)
+	if !ok {
+		return
+	}
+
+	var invoices []models.Invoice
+	if err := h.DB.Where("organization_id = ?", manager.OrganizationID).
+		Order("period_start desc").Find(&invoices).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil invoice"})
+		return
+	}
+	c.JSON(http.StatusOK, invoices)
+}
+
+// Invoice returns one of the caller's organization invoices with every
+// session on it.
+func (h *OrganizationHandler) Invoice(c *gin.Context) {
+	manager, ok := h.membership(c, true)
+	if !ok {
+		return
+	}
+
+	var invoice models.Invoice
+	if err := h.DB.Preload("Organization").Preload("Lines", func(db *gorm.DB) *gorm.DB {
+		return db.Order("driver_name, ended_at")
+	}).First(&invoice, "id = ? AND organization_id = ?", c.Param("invoiceId"), manager.OrganizationID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invoice tidak ditemukan"})
+		return
+	}
+	c.JSON(http.StatusOK, invoice)
+}
+
+// AdminInvoices lists invoices of all organizations, or of one
+// (organization_id), optionally only those with a status.
+func (h *OrganizationHandler) AdminInvoices(c *gin.Context) {
+	query := h.DB.Preload("Organization")
+	if v := c.Query("organization_id"); v != "" {
+		query = query.Where("organization_id = ?", v)
+	}
+	if v := c.Query("status"); v != "" {
+		query = query.Where("status = ?", v)
+	}
+
+	var invoices []models.Invoice
+	if err := query.Order("sequence desc").Limit(200).Find(&invoices).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil invoice"})
+		return
+	}
+	c.JSON(http.StatusOK, invoices)
+}
+
+// AdminInvoice returns an invoice with every session on it.
+func (h *OrganizationHandler) AdminInvoice(c *gin.Context) {
+	var invoice models.Invoice
+	if err := h.DB.Preload("Organization").Preload("Lines", func(db *gorm.DB) *gorm.DB {
+		return db.Order("driver_name, ended_at")
+	}).First(&invoice, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invoice tidak ditemukan"})
+		return
+	}
+	c.JSON(http.StatusOK, invoice)
+}
+
+// AdminGenerateInvoice issues an organization's invoice for the month
+// given as ?month=2006-01, by default the previous one. Invoices are also
+// issued automatically once a month has ended.
+func (h *OrganizationHandler) AdminGenerateInvoice(c *gin.Context) {
+	var org models.Organization
+	if err := h.DB.First(&org, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Organisasi tidak ditemukan"})
+		return
+	}
+
+	now := time.Now()
+	periodStart := services.MonthStart(h.DB, now).AddDate(0, -1, 0)
+	if v := c.Query("month"); v != "" {
+		month, err := time.ParseInLocation("2006-01", v, services.TariffLocation(h.DB))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Format bulan harus YYYY-MM"})
+			return
+		}
+		if !month.Before(services.MonthStart(h.DB, now)) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invoice hanya dapat dibuat untuk bulan yang sudah berakhir"})
+			return
+		}
+		periodStart = month
+	}
+
+	var invoice *models.Invoice
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		invoice, err = services.GenerateInvoice(tx, &org, periodStart, now)
+		return err
+	})
+	if errors.Is(err, services.ErrInvoiceExists) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal membuat invoice"})
+		return
+	}
+
+	logActivity(c, h.DB, "Buat Invoice", invoice.Number, "Admin membuat invoice "+org.Name+" periode "+periodStart.Format("2006-01"))
+	c.JSON(http.StatusCreated, invoice)
+}
+
+// AdminPayInvoice records the bank transfer paying a postpaid invoice.
+func (h *OrganizationHandler) AdminPayInvoice(c *gin.Context) {
+	invoiceID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID invoice tidak valid"})
+		return
+	}
+
+	var invoice *models.Invoice
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		invoice, err = services.PayInvoice(tx, invoiceID, time.Now())
+		return err
+	})
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invoice tidak ditemukan"})
+		return
+	case errors.Is(err, services.ErrInvoiceAlreadyPaid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mencatat pembayaran invoice"})
+		return
+	}
+
+	logActivity(c, h.DB, "Pelunasan Invoice", invoice.Number, "Admin mencatat pembayaran invoice Rp "+invoice.Total.String())
+	c.JSON(http.StatusOK, invoice)
+}
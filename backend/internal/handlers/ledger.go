@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
+	"github.com/Julianarwansah/sistemcharging/backend/internal/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type LedgerHandler struct {
+	DB *gorm.DB
+}
+
+// Accounts lists the platform accounts followed by user wallets.
+func (h *LedgerHandler) Accounts(c *gin.Context) {
+	var accounts []models.LedgerAccount
+	if err := h.DB.Order("user_id IS NOT NULL, organization_id IS NOT NULL, code").Find(&accounts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil akun ledger"})
+		return
+	}
+	c.JSON(http.StatusOK, accounts)
+}
+
+// Entries returns the latest entries of one account with their transaction.
+func (h *LedgerHandler) Entries(c *gin.Context) {
+	var account models.LedgerAccount
+	if err := h.DB.First(&account, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Akun ledger tidak ditemukan"})
+		return
+	}
+
+	var entries []struct {
+		models.LedgerEntry
+		Kind        models.LedgerTransactionKind `json:"kind"`
+		ReferenceID string                       `json:"reference_id"`
+		Description string                       `json:"description"`
+	}
+	if err := h.DB.Table("ledger_entries e").
+		Select("e.*, t.kind, t.reference_id, t.description").
+		Joins("JOIN ledger_transactions t ON t.id = e.transaction_id").
+		Where("e.account_id = ?", account.ID).
+		Order("e.created_at desc").Limit(100).
+		Scan(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil mutasi ledger"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"account": account,
+		"entries": entries,
+	})
+}
+
+// Reconcile proves the cached balances match the ledger.
+func (h *LedgerHandler) Reconcile(c *gin.Context) {
+	report, err := services.ReconcileLedger(h.DB, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal melakukan rekonsiliasi ledger"})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
+	mqttclient "github.com/Julianarwansah/sistemcharging/backend/internal/mqtt"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LocalAuthHandler manages the local authorization lists chargers use to
+// accept tokens while offline.
+type LocalAuthHandler struct {
+	DB   *gorm.DB
+	MQTT *mqttclient.MQTTClient
+}
+
+func (h *LocalAuthHandler) connector(c *gin.Context) (models.Connector, bool) {
+	var connector models.Connector
+	if err := h.DB.First(&connector, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Connector tidak ditemukan"})
+		return connector, false
+	}
+	return connector, true
+}
+
+// sync pushes list changes to the charger right away instead of waiting for
+// the scheduler.
+func (h *LocalAuthHandler) sync(connector models.Connector, force bool) {
+	if err := h.MQTT.SyncLocalAuthList(connector, force); err != nil {
+		log.Printf("⚠️  Failed to sync auth list of %s: %v", connector.MQTTTopic, err)
+	}
+}
+
+// Get returns the tokens on a connector's local list and the list version
+// last sent to and confirmed by the charger.
+func (h *LocalAuthHandler) Get(c *gin.Context) {
+	connector, ok := h.connector(c)
+	if !ok {
+		return
+	}
+
+	var entries []models.LocalAuthEntry
+	if err := h.DB.Preload("AuthToken.User").Where("connector_id = ?", connector.ID).
+		Order("created_at").Find(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil daftar otorisasi"})
+		return
+	}
+
+	var list models.LocalAuthList
+	h.DB.Where("connector_id = ?", connector.ID).Limit(1).Find(&list)
+
+	c.JSON(http.StatusOK, gin.H{
+		"entries": entries,
+		"list":    list,
+	})
+}
+
+// Add puts a token, by UID, on a connector's local list.
+func (h *LocalAuthHandler) Add(c *gin.Context) {
+	connector, ok := h.connector(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		UID string `json:"uid" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid"})
+		return
+	}
+
+	var token models.AuthToken
+	if err := h.DB.First(&token, "uid = ?", models.NormalizeTokenUID(input.UID)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Token tidak ditemukan"})
+		return
+	}
+
+	entry := models.LocalAuthEntry{ConnectorID: connector.ID, AuthTokenID: token.ID}
+	if err := h.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&entry).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menambahkan token ke daftar otorisasi"})
+		return
+	}
+
+	logActivity(c, h.DB, "Tambah Otorisasi Lokal", token.UID, "Admin menambahkan token "+token.UID+" ke daftar otorisasi "+connector.MQTTTopic)
+	h.sync(connector, false)
+	c.JSON(http.StatusCreated, gin.H{"message": "Token ditambahkan ke daftar otorisasi"})
+}
+
+// Remove takes a token off a connector's local list.
+func (h *LocalAuthHandler) Remove(c *gin.Context) {
+	connector, ok := h.connector(c)
+	if !ok {
+		return
+	}
+
+	result := h.DB.Where("connector_id = ? AND auth_token_id = ?", connector.ID, c.Param("tokenId")).
+		Delete(&models.LocalAuthEntry{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghapus token dari daftar otorisasi"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Token tidak ada di daftar otorisasi"})
+		return
+	}
+
+	logActivity(c, h.DB, "Hapus Otorisasi Lokal", c.Param("tokenId"), "Admin menghapus token dari daftar otorisasi "+connector.MQTTTopic)
+	h.sync(connector, false)
+	c.JSON(http.StatusOK, gin.H{"message": "Token dihapus dari daftar otorisasi"})
+}
+
+// Sync sends the charger its full list again, e.g. after it was replaced.
+func (h *LocalAuthHandler) Sync(c *gin.Context) {
+	connector, ok := h.connector(c)
+	if !ok {
+		return
+	}
+
+	if err := h.MQTT.SyncLocalAuthList(connector, true); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengirim daftar otorisasi ke charger"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Daftar otorisasi dikirim ke charger"})
+}
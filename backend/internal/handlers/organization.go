@@ -0,0 +1,461 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
+	"github.com/Julianarwansah/sistemcharging/backend/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type OrganizationHandler struct {
+	DB *gorm.DB
+}
+
+// OrganizationSummary adds the wallet state to an organization.
+type OrganizationSummary struct {
+	models.Organization
+	Balance     models.Money `json:"balance"`
+	Available   models.Money `json:"available"`
+	MemberCount int64        `json:"member_count"`
+}
+
+func (h *OrganizationHandler) summary(org models.Organization) (OrganizationSummary, error) {
+	result := OrganizationSummary{Organization: org}
+	var err error
+	if result.Balance, err = services.OrganizationBalance(h.DB, org.ID); err != nil {
+		return result, err
+	}
+	if result.Available, err = services.OrganizationAvailable(h.DB, &org); err != nil {
+		return result, err
+	}
+	err = h.DB.Model(&models.OrganizationMember{}).Where("organization_id = ?", org.ID).Count(&result.MemberCount).Error
+	return result, err
+}
+
+// membership returns the caller's active membership, answering 403 when
+// they have none or, with managerOnly, when they are not a manager.
+func (h *OrganizationHandler) membership(c *gin.Context, managerOnly bool) (*models.OrganizationMember, bool) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+	member, err := services.ActiveMembership(h.DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memuat keanggotaan organisasi"})
+		return nil, false
+	}
+	if member == nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Anda bukan anggota aktif organisasi"})
+		return nil, false
+	}
+	if managerOnly && member.Role != models.OrgRoleManager {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Hanya fleet manager yang dapat mengakses ini"})
+		return nil, false
+	}
+	return member, true
+}
+
+// Get returns the caller's organization and membership. Managers also see
+// the wallet.
+func (h *OrganizationHandler) Get(c *gin.Context) {
+	member, ok := h.membership(c, false)
+	if !ok {
+		return
+	}
+
+	spent, err := services.MemberMonthlySpend(h.DB, member, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghitung pemakaian bulan ini"})
+		return
+	}
+	response := gin.H{
+		"organization":     member.Organization,
+		"role":             member.Role,
+		"monthly_limit":    member.MonthlyLimit,
+		"spent_this_month": spent,
+	}
+	if member.Role == models.OrgRoleManager {
+		summary, err := h.summary(*member.Organization)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memuat saldo organisasi"})
+			return
+		}
+		response["organization"] = summary
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// MemberWithSpend adds this month's spending to a membership.
+type MemberWithSpend struct {
+	models.OrganizationMember
+	SpentThisMonth models.Money `json:"spent_this_month"`
+}
+
+// Members lists the organization's members with their spending this month.
+func (h *OrganizationHandler) Members(c *gin.Context) {
+	manager, ok := h.membership(c, true)
+	if !ok {
+		return
+	}
+
+	var members []models.OrganizationMember
+	if err := h.DB.Preload("User").Where("organization_id = ?", manager.OrganizationID).
+		Order("role, created_at").Find(&members).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil anggota organisasi"})
+		return
+	}
+
+	now := time.Now()
+	result := make([]MemberWithSpend, 0, len(members))
+	for _, m := range members {
+		spent, _ := services.MemberMonthlySpend(h.DB, &m, now)
+		result = append(result, MemberWithSpend{OrganizationMember: m, SpentThisMonth: spent})
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+type MemberInput struct {
+	Role         models.OrganizationRole `json:"role" binding:"omitempty,oneof=manager driver"`
+	MonthlyLimit models.Money            `json:"monthly_limit" binding:"min=0"`
+	Active       *bool                   `json:"active"`
+}
+
+// AddMember adds a registered user, found by email, to the organization.
+func (h *OrganizationHandler) AddMember(c *gin.Context) {
+	manager, ok := h.membership(c, true)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		MemberInput
+		Email string `json:"email" binding:"required,email"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid"})
+		return
+	}
+
+	member, status, msg := addMember(h.DB, manager.OrganizationID, input.Email, input.MemberInput)
+	if msg != "" {
+		c.JSON(status, gin.H{"error": msg})
+		return
+	}
+	c.JSON(http.StatusCreated, member)
+}
+
+// addMember makes the user with the given email a member of an
+// organization. It returns the HTTP status and message of a failure.
+func addMember(db *gorm.DB, orgID uuid.UUID, email string, input MemberInput) (*models.OrganizationMember, int, string) {
+	var user models.User
+	if err := db.First(&user, "email = ?", email).Error; err != nil {
+		return nil, http.StatusNotFound, "User dengan email tersebut tidak ditemukan"
+	}
+
+	var existing int64
+	db.Model(&models.OrganizationMember{}).Where("user_id = ?", user.ID).Count(&existing)
+	if existing > 0 {
+		return nil, http.StatusConflict, "User sudah menjadi anggota organisasi"
+	}
+
+	member := models.OrganizationMember{
+		OrganizationID: orgID,
+		UserID:         user.ID,
+		Role:           input.Role,
+		MonthlyLimit:   input.MonthlyLimit,
+		Active:         input.Active == nil || *input.Active,
+	}
+	if member.Role == "" {
+		member.Role = models.OrgRoleDriver
+	}
+	if err := db.Create(&member).Error; err != nil {
+		return nil, http.StatusInternalServerError, "Gagal menambahkan anggota organisasi"
+	}
+	member.User = &user
+	return &member, 0, ""
+}
+
+// UpdateMember changes a member's role, monthly limit or active state.
+// The last active manager cannot be demoted or deactivated.
+func (h *OrganizationHandler) UpdateMember(c *gin.Context) {
+	manager, ok := h.membership(c, true)
+	if !ok {
+		return
+	}
+
+	var input MemberInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid"})
+		return
+	}
+
+	var member models.OrganizationMember
+	if err := h.DB.First(&member, "id = ? AND organization_id = ?", c.Param("memberId"), manager.OrganizationID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Anggota tidak ditemukan"})
+		return
+	}
+
+	if input.Role != "" {
+		member.Role = input.Role
+	}
+	member.MonthlyLimit = input.MonthlyLimit
+	if input.Active != nil {
+		member.Active = *input.Active
+	}
+	if (member.Role != models.OrgRoleManager || !member.Active) && h.lastManager(member) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Organisasi harus memiliki minimal satu fleet manager aktif"})
+		return
+	}
+
+	if err := h.DB.Omit("User", "Organization").Save(&member).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memperbarui anggota organisasi"})
+		return
+	}
+	c.JSON(http.StatusOK, member)
+}
+
+// RemoveMember takes a member out of the organization. Their past sessions
+// stay on the organization's invoices.
+func (h *OrganizationHandler) RemoveMember(c *gin.Context) {
+	manager, ok := h.membership(c, true)
+	if !ok {
+		return
+	}
+
+	var member models.OrganizationMember
+	if err := h.DB.First(&member, "id = ? AND organization_id = ?", c.Param("memberId"), manager.OrganizationID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Anggota tidak ditemukan"})
+		return
+	}
+	if h.lastManager(member) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Organisasi harus memiliki minimal satu fleet manager aktif"})
+		return
+	}
+
+	if err := h.DB.Delete(&member).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghapus anggota organisasi"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Anggota dihapus dari organisasi"})
+}
+
+// lastManager reports whether member is the organization's only active
+// manager as stored.
+func (h *OrganizationHandler) lastManager(member models.OrganizationMember) bool {
+	var others int64
+	h.DB.Model(&models.OrganizationMember{}).
+		Where("organization_id = ? AND role = ? AND active AND id <> ?", member.OrganizationID, models.OrgRoleManager, member.ID).
+		Count(&others)
+	return others == 0
+}
+
+// Transactions returns the latest movements of the organization's wallet.
+func (h *OrganizationHandler) Transactions(c *gin.Context) {
+	manager, ok := h.membership(c, true)
+	if !ok {
+		return
+	}
+
+	var entries []struct {
+		models.LedgerEntry
+		Kind        models.LedgerTransactionKind `json:"kind"`
+		ReferenceID string                       `json:"reference_id"`
+		Description string                       `json:"description"`
+	}
+	if err := h.DB.Table("ledger_entries e").
+		Select("e.*, t.kind, t.reference_id, t.description").
+		Joins("JOIN ledger_transactions t ON t.id = e.transaction_id").
+		Joins("JOIN ledger_accounts a ON a.id = e.account_id").
+		Where("a.organization_id = ?", manager.OrganizationID).
+		Order("e.created_at desc").Limit(100).
+		Scan(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil mutasi dompet organisasi"})
+		return
+	}
+	c.JSON(http.StatusOK, entries)
+}
+
+// Sessions returns the latest sessions billed to the organization,
+// optionally of one member (user_id).
+func (h *OrganizationHandler) Sessions(c *gin.Context) {
+	manager, ok := h.membership(c, true)
+	if !ok {
+		return
+	}
+
+	query := h.DB.Preload("User").Preload("Connector.Station").
+		Where("organization_id = ?", manager.OrganizationID)
+	if v := c.Query("user_id"); v != "" {
+		query = query.Where("user_id = ?", v)
+	}
+
+	var sessions []models.ChargingSession
+	if err := query.Order("created_at desc").Limit(100).Find(&sessions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil sesi organisasi"})
+		return
+	}
+	c.JSON(http.StatusOK, sessions)
+}
+
+// OrganizationInput is what admins set on an organization.
+type OrganizationInput struct {
+	Name         string       `json:"name" binding:"required,max=100"`
+	BillingEmail string       `json:"billing_email" binding:"omitempty,email"`
+	CreditLimit  models.Money `json:"credit_limit" binding:"min=0"`
+	Status       string       `json:"status" binding:"omitempty,oneof=active suspended"`
+}
+
+// AdminList lists every organization with its wallet state.
+func (h *OrganizationHandler) AdminList(c *gin.Context) {
+	var orgs []models.Organization
+	if err := h.DB.Order("name").Find(&orgs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil data organisasi"})
+		return
+	}
+
+	result := make([]OrganizationSummary, 0, len(orgs))
+	for _, org := range orgs {
+		summary, err := h.summary(org)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memuat saldo organisasi"})
+			return
+		}
+		result = append(result, summary)
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// AdminCreate creates an organization with its first fleet manager.
+func (h *OrganizationHandler) AdminCreate(c *gin.Context) {
+	var input struct {
+		OrganizationInput
+		ManagerEmail string `json:"manager_email" binding:"required,email"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid: " + err.Error()})
+		return
+	}
+
+	org := models.Organization{
+		Name:         input.Name,
+		BillingEmail: input.BillingEmail,
+		CreditLimit:  input.CreditLimit,
+		Status:       "active",
+	}
+	var status int
+	var msg string
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&org).Error; err != nil {
+			return err
+		}
+		_, status, msg = addMember(tx, org.ID, input.ManagerEmail, MemberInput{Role: models.OrgRoleManager})
+		if msg != "" {
+			return errors.New(msg)
+		}
+		return nil
+	})
+	if msg != "" {
+		c.JSON(status, gin.H{"error": msg})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal membuat organisasi"})
+		return
+	}
+
+	logActivity(c, h.DB, "Tambah Organisasi", org.Name, "Admin membuat organisasi dengan manager "+input.ManagerEmail)
+	c.JSON(http.StatusCreated, org)
+}
+
+// AdminUpdate changes an organization's details, credit limit or status.
+// Suspended organizations cannot start new sessions.
+func (h *OrganizationHandler) AdminUpdate(c *gin.Context) {
+	var input OrganizationInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid: " + err.Error()})
+		return
+	}
+
+	var org models.Organization
+	if err := h.DB.First(&org, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Organisasi tidak ditemukan"})
+		return
+	}
+
+	org.Name = input.Name
+	org.BillingEmail = input.BillingEmail
+	org.CreditLimit = input.CreditLimit
+	if input.Status != "" {
+		org.Status = input.Status
+	}
+	if err := h.DB.Omit("Members").Save(&org).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memperbarui organisasi"})
+		return
+	}
+
+	logActivity(c, h.DB, "Update Organisasi", org.Name,
+		fmt.Sprintf("Admin memperbarui organisasi (batas kredit Rp %s, status %s)", org.CreditLimit, org.Status))
+	c.JSON(http.StatusOK, org)
+}
+
+// AdminAddMember adds a member to any organization.
+func (h *OrganizationHandler) AdminAddMember(c *gin.Context) {
+	var org models.Organization
+	if err := h.DB.First(&org, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Organisasi tidak ditemukan"})
+		return
+	}
+
+	var input struct {
+		MemberInput
+		Email string `json:"email" binding:"required,email"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid"})
+		return
+	}
+
+	member, status, msg := addMember(h.DB, org.ID, input.Email, input.MemberInput)
+	if msg != "" {
+		c.JSON(status, gin.H{"error": msg})
+		return
+	}
+
+	logActivity(c, h.DB, "Tambah Anggota Organisasi", org.Name, "Admin menambahkan "+input.Email+" sebagai "+string(member.Role))
+	c.JSON(http.StatusCreated, member)
+}
+
+// AdminTopUp credits a deposit the organization paid by bank transfer to
+// its wallet.
+func (h *OrganizationHandler) AdminTopUp(c *gin.Context) {
+	var input struct {
+		Amount    models.Money `json:"amount" binding:"required,gt=0"`
+		Reference string       `json:"reference" binding:"max=100"` // Bank transfer reference
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid"})
+		return
+	}
+
+	var org models.Organization
+	if err := h.DB.First(&org, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Organisasi tidak ditemukan"})
+		return
+	}
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		_, err := services.TopUpOrganization(tx, org.ID, input.Amount, input.Reference, "Deposit organisasi "+org.Name)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menambah saldo organisasi"})
+		return
+	}
+
+	balance, _ := services.OrganizationBalance(h.DB, org.ID)
+	logActivity(c, h.DB, "Top Up Organisasi", org.Name, fmt.Sprintf("Admin mencatat deposit Rp %s", input.Amount))
+	c.JSON(http.StatusOK, gin.H{"message": "Deposit organisasi dicatat", "balance": balance})
+}
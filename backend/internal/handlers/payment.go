@@ -2,11 +2,16 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
 	"time"
 
+	"github.com/Julianarwansah/sistemcharging/backend/internal/autotopup"
+	"github.com/Julianarwansah/sistemcharging/backend/internal/gateway"
 	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
 	mqttclient "github.com/Julianarwansah/sistemcharging/backend/internal/mqtt"
+	"github.com/Julianarwansah/sistemcharging/backend/internal/services"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
@@ -16,10 +21,20 @@ type PaymentHandler struct {
 	DB   *gorm.DB
 	MQTT *mqttclient.MQTTClient
 	Hub  *mqttclient.WebSocketHub
+	// Payments holds the enabled payment providers
+	Payments *gateway.Registry
+	// AutoTopUp records the outcome of auto top-ups paid by callback
+	AutoTopUp *autotopup.Service
 }
 
-// DummyPay simulates a payment completion (for development)
-func (h *PaymentHandler) DummyPay(c *gin.Context) {
+// Pay confirms a payment for the authenticated user. Charging sessions are
+// paid from the wallet at settlement, so confirming one starts (or
+// schedules) the session. Payments of the dummy provider, including
+// direct-pay sessions, are reported paid through it, which is only possible
+// in development.
+func (h *PaymentHandler) Pay(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
 	paymentID, err := uuid.Parse(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Payment ID tidak valid"})
@@ -27,7 +42,7 @@ func (h *PaymentHandler) DummyPay(c *gin.Context) {
 	}
 
 	var payment models.Payment
-	if err := h.DB.First(&payment, "id = ?", paymentID).Error; err != nil {
+	if err := h.DB.First(&payment, "id = ? AND user_id = ?", paymentID, userID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Pembayaran tidak ditemukan"})
 		return
 	}
@@ -37,28 +52,33 @@ func (h *PaymentHandler) DummyPay(c *gin.Context) {
 		return
 	}
 
+	if payment.PaymentGateway == "dummy" {
+		h.payDummy(c, &payment)
+		return
+	}
+	if payment.PaymentGateway != "wallet" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Pembayaran ini harus diselesaikan melalui payment gateway"})
+		return
+	}
+
 	// Mark payment as success
+	now := time.Now()
 	payment.Status = models.PaymentSuccess
-	h.DB.Save(&payment)
+	payment.PaidAt = &now
+	if err := h.DB.Save(&payment).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memproses pembayaran"})
+		return
+	}
 
-	// Update session to paid
 	var session models.ChargingSession
 	h.DB.Preload("Connector").First(&session, "id = ?", payment.SessionID)
-	session.Status = models.SessionPaid
-	now := time.Now()
-	session.StartedAt = &now
-	h.DB.Save(&session)
-
-	// Mark connector as in use
-	session.Connector.Status = models.ConnectorInUse
-	h.DB.Save(&session.Connector)
-
-	// Send START command via MQTT
-	err = h.MQTT.SendCommand(session.Connector.MQTTTopic, mqttclient.ChargerCommand{
-		Action:    "START",
-		SessionID: session.ID.String(),
-		TargetKWH: session.TargetKWH,
-	})
+
+	message, err := h.activateSession(&session)
+	if errors.Is(err, services.ErrConnectorUnavailable) {
+		h.cancelUnstartable(&session)
+		c.JSON(http.StatusConflict, gin.H{"error": "Connector sudah digunakan sesi lain, sesi dibatalkan"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Pembayaran berhasil tapi gagal mengirim perintah ke charger",
@@ -67,30 +87,224 @@ func (h *PaymentHandler) DummyPay(c *gin.Context) {
 		return
 	}
 
-	// Update session to charging
-	session.Status = models.SessionCharging
-	h.DB.Save(&session)
-
-	// Broadcast session update
-	wsData, _ := json.Marshal(map[string]interface{}{
-		"session_id": session.ID,
-		"status":     session.Status,
-		"user_id":    session.UserID,
-	})
-	h.Hub.Broadcast(session.ID.String(), wsData)
-	h.Hub.Broadcast(session.UserID.String(), wsData)
-	h.Hub.Broadcast("admin", wsData)
-
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Pembayaran berhasil! Charging dimulai.",
+		"message": message,
 		"payment": payment,
 		"session": session,
 	})
 }
 
-// Callback handles payment gateway callbacks (for future Midtrans/Xendit integration)
+// activateSession starts charging for a paid session, or holds the
+// connector until its scheduled start, and returns the message for the
+// user. The session must have its Connector loaded. It returns
+// services.ErrConnectorUnavailable when another session has taken the
+// connector.
+func (h *PaymentHandler) activateSession(session *models.ChargingSession) (string, error) {
+	// Scheduled sessions hold the connector until the scheduler starts them
+	if session.ScheduledAt != nil && session.ScheduledAt.After(time.Now()) {
+		err := h.DB.Transaction(func(tx *gorm.DB) error {
+			result := tx.Model(&models.ChargingSession{}).Where("id = ? AND status = ?", session.ID, models.SessionPending).
+				Update("status", models.SessionScheduled)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return services.ErrSessionNotWaiting
+			}
+
+			result = tx.Model(&models.Connector{}).Where("id = ? AND status = ?", session.ConnectorID, models.ConnectorAvailable).
+				Update("status", models.ConnectorReserved)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return services.ErrConnectorUnavailable
+			}
+			return nil
+		})
+		if err != nil {
+			return "", err
+		}
+		session.Status = models.SessionScheduled
+		session.Connector.Status = models.ConnectorReserved
+
+		h.MQTT.BroadcastSessionStatus(session)
+		return "Pembayaran berhasil! Charging akan dimulai sesuai jadwal.", nil
+	}
+
+	if err := h.MQTT.StartSession(session); err != nil {
+		return "", err
+	}
+	return "Pembayaran berhasil! Charging dimulai.", nil
+}
+
+// startDirectPaySession starts a direct-pay session once the provider
+// confirmed its payment. If the connector was taken while the customer was
+// paying, the session is cancelled instead; the payment is already in their
+// wallet either way.
+func (h *PaymentHandler) startDirectPaySession(payment *models.Payment) {
+	var session models.ChargingSession
+	if err := h.DB.Preload("Connector").First(&session, "id = ?", *payment.SessionID).Error; err != nil ||
+		session.Status != models.SessionPending {
+		return
+	}
+
+	_, err := h.activateSession(&session)
+	if errors.Is(err, services.ErrConnectorUnavailable) {
+		h.cancelUnstartable(&session)
+		return
+	}
+	if err != nil {
+		log.Printf("⚠️  Direct-pay session %s paid but not started: %v", session.ID, err)
+	}
+}
+
+// cancelUnstartable cancels a paid session whose connector another session
+// took first. Nothing has been charged for it: wallet sessions are billed at
+// settlement, and a direct payment stays in the wallet.
+func (h *PaymentHandler) cancelUnstartable(session *models.ChargingSession) {
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		return services.CancelSession(tx, session, time.Now())
+	})
+	if err != nil {
+		log.Printf("⚠️  Session %s without a connector not cancelled: %v", session.ID, err)
+		return
+	}
+	h.MQTT.BroadcastSessionStatus(session)
+}
+
+// payDummy settles a dummy provider payment as if the customer paid it.
+func (h *PaymentHandler) payDummy(c *gin.Context, payment *models.Payment) {
+	provider, err := h.Payments.Provider("dummy")
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Pembayaran dummy hanya tersedia di mode development"})
+		return
+	}
+	dummy := provider.(*gateway.Dummy)
+	h.applyStatus(c, provider, dummy.Pay(payment.ID.String(), payment.Amount), "")
+}
+
+// Methods lists the payment methods available for top-ups and the provider
+// taking each.
+func (h *PaymentHandler) Methods(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"methods": h.Payments.Methods()})
+}
+
+// Callback handles payment provider callbacks on /payments/callback/:provider;
+// the bare /payments/callback route is Midtrans. The callback must pass the
+// provider's authentication, and the state it reports is confirmed with the
+// provider's status API before anything changes, so only then is a paid
+// top-up credited to the wallet or a direct-pay session started. Repeated
+// callbacks for a processed payment are acknowledged without effect.
 func (h *PaymentHandler) Callback(c *gin.Context) {
-	// This endpoint will be implemented when integrating real payment gateways
-	// For now, use the /pay/:id endpoint for dummy payments
-	c.JSON(http.StatusOK, gin.H{"message": "Payment callback received"})
+	name := c.Param("provider")
+	if name == "" {
+		name = "midtrans"
+	}
+	provider, err := h.Payments.Provider(name)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment gateway tidak aktif"})
+		return
+	}
+
+	raw, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Notifikasi tidak valid"})
+		return
+	}
+	reported, err := provider.VerifyCallback(c.Request.Header, raw)
+	if errors.Is(err, gateway.ErrInvalidSignature) {
+		log.Printf("⚠️  Rejected %s callback: %v", name, err)
+		c.JSON(http.StatusForbidden, gin.H{"error": "Signature notifikasi tidak valid"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Notifikasi tidak valid"})
+		return
+	}
+
+	// Providers retry callbacks that are not answered with 2xx, so a failed
+	// status check is reported as a server error
+	confirmed, err := provider.Status(c.Request.Context(), reported.Reference)
+	if err != nil {
+		log.Printf("⚠️  %s status check for %s failed: %v", name, reported.OrderID, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Gagal memverifikasi status pembayaran"})
+		return
+	}
+	if confirmed.OrderID != reported.OrderID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Notifikasi tidak sesuai dengan status pembayaran"})
+		return
+	}
+
+	h.applyStatus(c, provider, confirmed, string(raw))
+}
+
+// applyStatus applies a confirmed provider state to its payment and tells
+// the user about it.
+func (h *PaymentHandler) applyStatus(c *gin.Context, provider gateway.Provider, status *gateway.Status, callbackData string) {
+	paymentID, err := uuid.Parse(status.OrderID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Pembayaran tidak ditemukan"})
+		return
+	}
+
+	var payment *models.Payment
+	var changed bool
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		payment, changed, err = services.CompletePayment(tx, paymentID, services.PaymentUpdate{
+			Gateway:      provider.Name(),
+			Status:       status.Result.PaymentStatus(),
+			Amount:       status.Amount,
+			Reference:    status.Reference,
+			CallbackData: callbackData,
+		}, time.Now())
+		return err
+	})
+	switch {
+	case errors.Is(err, services.ErrPaymentNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrPaymentAmountMismatch):
+		log.Printf("⚠️  %s reported %s paid for payment %s", provider.Name(), status.Amount, paymentID)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		log.Printf("⚠️  %s payment %s not applied: %v", provider.Name(), paymentID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memproses notifikasi pembayaran"})
+		return
+	}
+
+	if changed {
+		paymentData, _ := json.Marshal(map[string]interface{}{
+			"type":       "payment_update",
+			"payment_id": payment.ID,
+			"purpose":    payment.Purpose,
+			"status":     payment.Status,
+			"amount":     payment.Amount,
+		})
+		h.Hub.Broadcast(payment.UserID.String(), paymentData)
+
+		if payment.Purpose == models.PurposeSession && payment.Status == models.PaymentSuccess {
+			h.startDirectPaySession(payment)
+		}
+		if payment.Automatic {
+			h.AutoTopUp.Completed(payment)
+		}
+
+		credited := payment.Purpose == models.PurposeTopUp || payment.PrepaidAmount > 0
+		if credited && payment.PaidAt != nil {
+			var user models.User
+			h.DB.Select("balance").First(&user, "id = ?", payment.UserID)
+			balanceData, _ := json.Marshal(map[string]interface{}{
+				"type":    "balance_update",
+				"balance": user.Balance,
+				"user_id": payment.UserID,
+			})
+			h.Hub.Broadcast(payment.UserID.String(), balanceData)
+			h.Hub.Broadcast("admin", balanceData)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Notifikasi pembayaran diproses", "payment": payment})
 }
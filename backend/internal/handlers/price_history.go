@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
+	"github.com/Julianarwansah/sistemcharging/backend/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type PriceHistoryHandler struct {
+	DB *gorm.DB
+}
+
+type PriceChangeRequest struct {
+	PricePerKWH models.Money `json:"price_per_kwh" binding:"required,gt=0"`
+	TariffID    *uuid.UUID   `json:"tariff_id"`
+	EffectiveAt *time.Time   `json:"effective_at"` // Empty or past = apply now
+	Note        string       `json:"note"`
+}
+
+// List returns the applied and pending price changes of a connector, newest first.
+func (h *PriceHistoryHandler) List(c *gin.Context) {
+	connectorID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID konektor tidak valid"})
+		return
+	}
+
+	var changes []models.ConnectorPriceChange
+	if err := h.DB.Where("connector_id = ?", connectorID).
+		Order("effective_at desc").Find(&changes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil riwayat harga"})
+		return
+	}
+
+	c.JSON(http.StatusOK, changes)
+}
+
+// Schedule records a price change for a connector, applied immediately or
+// by the scheduler at effective_at.
+func (h *PriceHistoryHandler) Schedule(c *gin.Context) {
+	connectorID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID konektor tidak valid"})
+		return
+	}
+
+	var req PriceChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid: " + err.Error()})
+		return
+	}
+
+	var connector models.Connector
+	if err := h.DB.First(&connector, "id = ?", connectorID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Konektor tidak ditemukan"})
+		return
+	}
+
+	if req.TariffID != nil {
+		var count int64
+		h.DB.Model(&models.Tariff{}).Where("id = ?", *req.TariffID).Count(&count)
+		if count == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Tarif tidak ditemukan"})
+			return
+		}
+	}
+
+	now := time.Now()
+	change := models.ConnectorPriceChange{
+		ConnectorID: connectorID,
+		PricePerKWH: req.PricePerKWH,
+		TariffID:    req.TariffID,
+		EffectiveAt: now,
+		Note:        req.Note,
+		CreatedBy:   adminIDFrom(c),
+	}
+	if req.EffectiveAt != nil && req.EffectiveAt.After(now) {
+		change.EffectiveAt = *req.EffectiveAt
+	}
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&change).Error; err != nil {
+			return err
+		}
+		if !change.EffectiveAt.After(now) {
+			return services.ApplyPriceChange(tx, &change, now)
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menyimpan perubahan harga"})
+		return
+	}
+
+	logActivity(c, h.DB, "Jadwalkan Harga", connectorID.String(), "Admin menjadwalkan perubahan harga konektor mulai "+change.EffectiveAt.Format(time.RFC3339))
+	c.JSON(http.StatusCreated, change)
+}
+
+// Cancel removes a price change that has not been applied yet.
+func (h *PriceHistoryHandler) Cancel(c *gin.Context) {
+	changeID, err := uuid.Parse(c.Param("changeId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID perubahan harga tidak valid"})
+		return
+	}
+
+	result := h.DB.Where("id = ? AND connector_id = ? AND applied_at IS NULL", changeID, c.Param("id")).
+		Delete(&models.ConnectorPriceChange{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal membatalkan perubahan harga"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Perubahan harga terjadwal tidak ditemukan"})
+		return
+	}
+
+	logActivity(c, h.DB, "Batalkan Jadwal Harga", changeID.String(), "Admin membatalkan perubahan harga terjadwal")
+	c.JSON(http.StatusOK, gin.H{"message": "Perubahan harga terjadwal dibatalkan"})
+}
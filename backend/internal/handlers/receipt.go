@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Julianarwansah/sistemcharging/backend/internal/mailer"
+	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
+	"github.com/Julianarwansah/sistemcharging/backend/internal/receipt"
+	"github.com/Julianarwansah/sistemcharging/backend/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// receiptMailTimeout bounds sending a receipt by e-mail.
+const receiptMailTimeout = 30 * time.Second
+
+// ReceiptHandler serves PDF receipts of completed sessions.
+type ReceiptHandler struct {
+	DB     *gorm.DB
+	Mailer mailer.Mailer // Nil when e-mail is not configured
+}
+
+// document loads one of the user's sessions with everything its receipt
+// shows, issuing the receipt number on first request.
+func (h *ReceiptHandler) document(c *gin.Context) (*receipt.Document, bool) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	var session models.ChargingSession
+	if err := h.DB.Preload("User").Preload("Connector.Station").Preload("LineItems", orderLineItems).
+		First(&session, "id = ? AND user_id = ?", c.Param("id"), userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sesi tidak ditemukan"})
+		return nil, false
+	}
+
+	var issued *models.Receipt
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		issued, err = services.IssueReceipt(tx, &session, time.Now())
+		return err
+	})
+	if errors.Is(err, services.ErrReceiptUnavailable) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal membuat kwitansi"})
+		return nil, false
+	}
+
+	tariff, err := services.SessionTariff(h.DB, &session, session.Connector)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal membuat kwitansi"})
+		return nil, false
+	}
+
+	doc := &receipt.Document{
+		Issuer:   services.ReceiptIssuer(h.DB),
+		Receipt:  *issued,
+		Session:  session,
+		Tariff:   tariff,
+		Location: services.TariffLocation(h.DB),
+	}
+	var payment models.Payment
+	if err := h.DB.First(&payment, "session_id = ?", session.ID).Error; err == nil {
+		doc.Payment = &payment
+	}
+	if session.OrganizationID != nil {
+		var org models.Organization
+		if err := h.DB.Unscoped().First(&org, "id = ?", *session.OrganizationID).Error; err == nil {
+			doc.Organization = &org
+		}
+	}
+	return doc, true
+}
+
+// Download returns the receipt of one of the user's completed sessions as
+// a PDF.
+func (h *ReceiptHandler) Download(c *gin.Context) {
+	doc, ok := h.document(c)
+	if !ok {
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="`+doc.Filename()+`"`)
+	c.Data(http.StatusOK, "application/pdf", receipt.Render(*doc))
+}
+
+// Email sends the receipt of one of the user's completed sessions to an
+// address, by default the user's own.
+func (h *ReceiptHandler) Email(c *gin.Context) {
+	if h.Mailer == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Pengiriman e-mail belum diaktifkan"})
+		return
+	}
+
+	var input struct {
+		Email string `json:"email" binding:"omitempty,email"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Alamat e-mail tidak valid"})
+		return
+	}
+
+	doc, ok := h.document(c)
+	if !ok {
+		return
+	}
+	if input.Email == "" {
+		input.Email = doc.Session.User.Email
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), receiptMailTimeout)
+	defer cancel()
+	err := h.Mailer.Send(ctx, mailer.Message{
+		To:      input.Email,
+		Subject: "Kwitansi " + doc.Receipt.Number + " - " + doc.Issuer,
+		Body:    doc.Summary(),
+		Attachments: []mailer.Attachment{{
+			Filename:    doc.Filename(),
+			ContentType: "application/pdf",
+			Data:        receipt.Render(*doc),
+		}},
+	})
+	if errors.Is(err, mailer.ErrInvalidAddress) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Alamat e-mail tidak valid"})
+		return
+	}
+	if err != nil {
+		log.Printf("⚠️  Failed to e-mail receipt %s via %s: %v", doc.Receipt.Number, h.Mailer.Name(), err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Gagal mengirim kwitansi"})
+		return
+	}
+
+	now := time.Now()
+	h.DB.Model(&doc.Receipt).Updates(map[string]interface{}{"emailed_to": input.Email, "emailed_at": now})
+	doc.Receipt.EmailedTo, doc.Receipt.EmailedAt = input.Email, &now
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Kwitansi dikirim ke " + input.Email,
+		"receipt": doc.Receipt,
+	})
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Julianarwansah/sistemcharging/backend/internal/gateway"
+	"github.com/Julianarwansah/sistemcharging/backend/internal/reconcile"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// defaultReconcileDays is how far back payments and sessions are checked
+// unless the days parameter says otherwise.
+const defaultReconcileDays = 30
+
+type ReconciliationHandler struct {
+	DB *gorm.DB
+	// Payments holds the providers whose records payments are checked against
+	Payments *gateway.Registry
+}
+
+// Report cross-checks payments, sessions, wallet transactions and balances
+// without changing anything. Query parameters: days (default 30, 0 checks
+// everything) and gateway=false to skip the provider status queries.
+func (h *ReconciliationHandler) Report(c *gin.Context) {
+	h.run(c, false)
+}
+
+// Fix runs the same checks and applies the safe fixes.
+func (h *ReconciliationHandler) Fix(c *gin.Context) {
+	h.run(c, true)
+}
+
+func (h *ReconciliationHandler) run(c *gin.Context, fix bool) {
+	now := time.Now()
+	opts := reconcile.Options{Payments: h.Payments, Fix: fix}
+
+	days := defaultReconcileDays
+	if v := c.Query("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Parameter days tidak valid"})
+			return
+		}
+		days = n
+	}
+	if days > 0 {
+		opts.Since = now.AddDate(0, 0, -days)
+	}
+	if c.Query("gateway") == "false" {
+		opts.Payments = nil
+	}
+
+	report, err := reconcile.Run(c.Request.Context(), h.DB, opts, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal melakukan rekonsiliasi pembayaran"})
+		return
+	}
+
+	if fix {
+		logActivity(c, h.DB, "Rekonsiliasi Pembayaran", "Pembayaran",
+			fmt.Sprintf("Admin memperbaiki %d dari %d selisih pembayaran", report.Fixed, len(report.Issues)))
+	}
+
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
+	mqttclient "github.com/Julianarwansah/sistemcharging/backend/internal/mqtt"
+	"github.com/Julianarwansah/sistemcharging/backend/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type RefundHandler struct {
+	DB  *gorm.DB
+	Hub *mqttclient.WebSocketHub
+}
+
+// List returns the refunds of a session's payment, newest first.
+func (h *RefundHandler) List(c *gin.Context) {
+	sessionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID sesi tidak valid"})
+		return
+	}
+
+	var refunds []models.Refund
+	if err := h.DB.Where("session_id = ?", sessionID).Order("created_at desc").Find(&refunds).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil data refund"})
+		return
+	}
+	c.JSON(http.StatusOK, refunds)
+}
+
+// Create refunds part or all of a session's payment to the user's wallet.
+// Leaving out the amount refunds whatever has not been refunded yet.
+func (h *RefundHandler) Create(c *gin.Context) {
+	sessionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID sesi tidak valid"})
+		return
+	}
+
+	var input struct {
+		Amount models.Money `json:"amount" binding:"gte=0"`
+		Reason string       `json:"reason" binding:"required,max=255"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Alasan refund wajib diisi"})
+		return
+	}
+
+	var refund *models.Refund
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		refund, err = services.RefundSession(tx, sessionID, input.Amount, input.Reason, adminIDFrom(c))
+		return err
+	})
+	switch {
+	case errors.Is(err, services.ErrRefundNoPayment):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrRefundNotSettled), errors.Is(err, services.ErrRefundNotPaid),
+		errors.Is(err, services.ErrRefundInvalid), errors.Is(err, services.ErrRefundExceedsPaid),
+		errors.Is(err, services.ErrRefundNotWallet):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memproses refund"})
+		return
+	}
+
+	logActivity(c, h.DB, "Refund Sesi", sessionID.String(),
+		"Admin merefund Rp "+refund.Amount.String()+": "+refund.Reason)
+
+	// Let the user know the money is back
+	refundData, _ := json.Marshal(map[string]interface{}{
+		"type":       "refund",
+		"refund_id":  refund.ID,
+		"session_id": refund.SessionID,
+		"user_id":    refund.UserID,
+		"amount":     refund.Amount,
+		"reason":     refund.Reason,
+		"automatic":  refund.Automatic,
+	})
+	h.Hub.Broadcast(refund.UserID.String(), refundData)
+	h.Hub.Broadcast("admin", refundData)
+
+	var user models.User
+	h.DB.Select("balance").First(&user, "id = ?", refund.UserID)
+	balanceData, _ := json.Marshal(map[string]interface{}{
+		"type":    "balance_update",
+		"balance": user.Balance,
+		"user_id": refund.UserID,
+	})
+	h.Hub.Broadcast(refund.UserID.String(), balanceData)
+	h.Hub.Broadcast("admin", balanceData)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Refund berhasil diproses",
+		"refund":  refund,
+		"balance": user.Balance,
+	})
+}
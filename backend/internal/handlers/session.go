@@ -1,12 +1,19 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/Julianarwansah/sistemcharging/backend/internal/autotopup"
+	"github.com/Julianarwansah/sistemcharging/backend/internal/gateway"
 	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
 	mqttclient "github.com/Julianarwansah/sistemcharging/backend/internal/mqtt"
+	"github.com/Julianarwansah/sistemcharging/backend/internal/services"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
@@ -16,11 +23,47 @@ type SessionHandler struct {
 	DB   *gorm.DB
 	MQTT *mqttclient.MQTTClient
 	Hub  *mqttclient.WebSocketHub
+	// Payments takes direct QRIS payments for sessions
+	Payments      *gateway.Registry
+	PaymentExpiry time.Duration
+	// AutoTopUp tops up wallets below their threshold at session start
+	// and after settlement
+	AutoTopUp *autotopup.Service
 }
 
+// CreateSessionRequest accepts one or more stop limits; charging stops at
+// whichever is reached first.
 type CreateSessionRequest struct {
-	ConnectorID string  `json:"connector_id" binding:"required"`
-	TargetKWH   float64 `json:"target_kwh" binding:"required,gt=0"`
+	ConnectorID        string       `json:"connector_id" binding:"required"`
+	TargetKWH          float64      `json:"target_kwh" binding:"omitempty,gt=0,lte=500"`
+	MaxCost            models.Money `json:"max_cost" binding:"omitempty,gt=0"`
+	MaxDurationMinutes int          `json:"max_duration_minutes" binding:"omitempty,gt=0,lte=1440"`
+	TargetSoC          int          `json:"target_soc" binding:"omitempty,min=1,max=100"`
+
+	// Optional delayed start: either an explicit start time or a deadline
+	// by which charging should be finished
+	ScheduledStartAt *time.Time `json:"scheduled_start_at"`
+	ReadyBy          *time.Time `json:"ready_by"`
+
+	VoucherCode string `json:"voucher_code"`
+
+	// "wallet" (default) charges the wallet at settlement; "qris" pays the
+	// estimated cost upfront by QRIS, for customers without a balance
+	PaymentMethod string `json:"payment_method" binding:"omitempty,oneof=wallet qris"`
+
+	// Members of a fleet organization are billed to it unless they choose
+	// "personal"
+	BillTo       string `json:"bill_to" binding:"omitempty,oneof=organization personal"`
+	VehiclePlate string `json:"vehicle_plate" binding:"max=20"`
+
+	// One of the user's registered vehicles; checked against the connector
+	// and used to cap target_kwh and the charging power
+	VehicleID string `json:"vehicle_id"`
+}
+
+type ScheduleSessionRequest struct {
+	ScheduledStartAt *time.Time `json:"scheduled_start_at"`
+	ReadyBy          *time.Time `json:"ready_by"`
 }
 
 func (h *SessionHandler) Create(c *gin.Context) {
@@ -50,75 +93,349 @@ func (h *SessionHandler) Create(c *gin.Context) {
 		return
 	}
 
-	// Check user balance
-	var user models.User
-	if err := h.DB.First(&user, "id = ?", userID).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User tidak ditemukan"})
-		return
-	}
-
-	// Calculate estimated cost
-	estimatedCost := req.TargetKWH * connector.PricePerKWH
-
-	if user.Balance < estimatedCost {
-		c.JSON(http.StatusPaymentRequired, gin.H{
-			"error":   "Saldo tidak mencukupi",
-			"balance": user.Balance,
-			"needed":  estimatedCost,
-		})
-		return
-	}
-
 	// Check user doesn't have active session
 	var activeCount int64
 	h.DB.Model(&models.ChargingSession{}).
-		Where("user_id = ? AND status IN ?", userID, []string{"pending", "paid", "charging"}).
+		Where("user_id = ? AND status IN ?", userID, []string{"pending", "paid", "scheduled", "charging", "idle"}).
 		Count(&activeCount)
 	if activeCount > 0 {
 		c.JSON(http.StatusConflict, gin.H{"error": "Anda masih memiliki sesi charging aktif"})
 		return
 	}
 
-	// Create session
+	// Check user balance
+	var user models.User
+	if err := h.DB.First(&user, "id = ?", userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User tidak ditemukan"})
+		return
+	}
+
 	session := models.ChargingSession{
 		UserID:      userID,
 		ConnectorID: connectorID,
 		Status:      models.SessionPending,
 		TargetKWH:   req.TargetKWH,
-		TotalCost:   estimatedCost,
+		MaxCost:     req.MaxCost,
+		MaxDuration: req.MaxDurationMinutes,
+		TargetSoC:   req.TargetSoC,
+	}
+	session.VehiclePlate = strings.ToUpper(strings.TrimSpace(req.VehiclePlate))
+
+	// Estimates use the connector's power as limited by the vehicle
+	estimateConnector := connector
+	if req.VehicleID != "" {
+		var vehicle models.Vehicle
+		if err := h.DB.First(&vehicle, "id = ? AND user_id = ?", req.VehicleID, userID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Kendaraan tidak ditemukan"})
+			return
+		}
+		estimateConnector, err = services.ApplyVehicle(&session, connector, &vehicle)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":           err.Error(),
+				"connector_type":  connector.ConnectorType,
+				"connector_types": vehicle.ConnectorTypes,
+			})
+			return
+		}
+	}
+
+	if !services.HasStopLimit(&session) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Tentukan minimal satu batas: target_kwh, max_cost, max_duration_minutes, atau target_soc"})
+		return
+	}
+
+	// Direct pay collects the estimate upfront through the QRIS provider
+	directPay := req.PaymentMethod == gateway.MethodQRIS
+	var provider gateway.Provider
+	if directPay {
+		provider, _, err = h.Payments.ForMethod(gateway.MethodQRIS)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Pembayaran QRIS tidak tersedia"})
+			return
+		}
+	}
+
+	// What the session may cost: the wallet balance, or for fleet sessions
+	// what the organization has left within the member's monthly limit
+	available := user.Balance
+	var member *models.OrganizationMember
+	if req.BillTo != "personal" {
+		member, err = services.ActiveMembership(h.DB, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memuat keanggotaan organisasi"})
+			return
+		}
+		if member == nil && req.BillTo == "organization" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Anda bukan anggota aktif organisasi"})
+			return
+		}
+	}
+	if member != nil && directPay {
+		if req.BillTo == "organization" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Sesi organisasi tidak dapat dibayar dengan QRIS"})
+			return
+		}
+		member = nil
+	}
+	if member != nil {
+		available, err = services.MemberAllowance(h.DB, member, time.Now())
+		if errors.Is(err, services.ErrOrgSuspended) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memuat saldo organisasi"})
+			return
+		}
+		session.OrganizationID = &member.OrganizationID
+	}
+
+	tariff, err := services.ResolveTariff(h.DB, connector)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memuat tarif"})
+		return
+	}
+	if tariff.ID != uuid.Nil {
+		session.TariffID = &tariff.ID
+	}
+	session.Tariff = &tariff
+
+	if session.MaxCost > 0 && tariff.MinPrice > session.MaxCost {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "max_cost lebih kecil dari harga minimum sesi", "min_price": tariff.MinPrice})
+		return
+	}
+
+	if err := services.ResolveSchedule(&session, estimateConnector, tariff, req.ScheduledStartAt, req.ReadyBy, time.Now()); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Calculate estimated cost under the tariff in force at the start time
+	start := time.Now()
+	if session.ScheduledAt != nil {
+		start = *session.ScheduledAt
 	}
+	estimatedCost := services.EstimateSessionCost(&session, estimateConnector, tariff, start, services.TariffLocation(h.DB))
 
-	if err := h.DB.Create(&session).Error; err != nil {
+	// A SoC-only session cannot be priced upfront, so cap it at what is
+	// available
+	balanceCapped := estimatedCost == 0
+	if balanceCapped && directPay {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Pembayaran QRIS memerlukan batas target_kwh, max_cost, atau max_duration_minutes"})
+		return
+	}
+	if balanceCapped {
+		session.MaxCost = available
+		estimatedCost = available
+	}
+
+	// Apply voucher; the discount is final only at settlement
+	var voucher *models.Voucher
+	var estimatedDiscount models.Money
+	if req.VoucherCode != "" {
+		voucher, err = services.FindVoucher(h.DB, req.VoucherCode, userID, time.Now(), false)
+		if err == nil {
+			err = services.CheckVoucherForConnector(voucher, connector)
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		session.VoucherID = &voucher.ID
+		if !balanceCapped {
+			estimatedDiscount = services.VoucherDiscount(voucher, estimatedCost, session.TargetKWH, estimatedCost)
+			estimatedCost -= estimatedDiscount
+		}
+	}
+
+	// Add service fee and tax. A max_cost limit already includes them, since
+	// charging stops once the cost after discount, fee and tax reaches it.
+	_, _, estimatedCost = services.LoadChargeRules(h.DB).Gross(estimatedCost)
+	if session.MaxCost > 0 && estimatedCost > session.MaxCost {
+		estimatedCost = session.MaxCost
+	}
+
+	// The QRIS amount is in whole rupiah, and charging stops once the cost
+	// reaches what was paid
+	if directPay {
+		if fraction := estimatedCost.Minor() % 100; fraction != 0 {
+			estimatedCost += models.Money(100 - fraction)
+		}
+		if session.MaxCost == 0 || session.MaxCost > estimatedCost {
+			session.MaxCost = estimatedCost
+		}
+	}
+
+	// A shortfall may be covered by auto top-up before giving up. This
+	// charges the saved card, so every other check must come before it.
+	var autoTopUp *models.Payment
+	if !directPay && member == nil && !balanceCapped && available < estimatedCost {
+		autoTopUp, err = h.AutoTopUp.Check(c.Request.Context(), userID, estimatedCost, autotopup.TriggerSessionStart)
+		if err != nil {
+			log.Printf("⚠️  Auto top-up for user %s failed: %v", userID, err)
+		}
+		if autoTopUp != nil && autoTopUp.Status == models.PaymentSuccess {
+			if balance, err := services.WalletBalance(h.DB, userID); err == nil {
+				available = balance
+			}
+		}
+	}
+
+	if !directPay && (available <= 0 || available < estimatedCost) {
+		response := gin.H{
+			"error":   "Saldo tidak mencukupi",
+			"balance": available,
+			"needed":  estimatedCost,
+		}
+		if member != nil {
+			response["error"] = services.ErrOrgCreditExceeded.Error()
+			if member.MonthlyLimit > 0 {
+				response["error"] = "Saldo organisasi atau sisa batas pemakaian bulanan Anda tidak mencukupi"
+			}
+		}
+		if autoTopUp != nil {
+			response["auto_topup"] = autoTopUp
+		}
+		c.JSON(http.StatusPaymentRequired, response)
+		return
+	}
+
+	// Create session
+	session.TotalCost = estimatedCost
+
+	var voucherErr error
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&session).Error; err != nil {
+			return err
+		}
+		if voucher == nil {
+			return nil
+		}
+
+		// Re-check the limits under a row lock before reserving the use
+		locked, err := services.FindVoucher(tx, voucher.Code, userID, time.Now(), true)
+		if err != nil {
+			voucherErr = err
+			return err
+		}
+		return services.ReserveSessionVoucher(tx, locked, &session)
+	})
+	if voucherErr != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": voucherErr.Error()})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal membuat sesi charging"})
 		return
 	}
 
-	// Create dummy payment
+	// Sessions are paid from the wallet at settlement; the user confirms
+	// the payment to start charging
 	payment := models.Payment{
-		SessionID:      session.ID,
-		PaymentMethod:  "dummy",
-		PaymentGateway: "dummy",
-		ExternalID:     "DUMMY-" + session.ID.String()[:8],
+		UserID:         userID,
+		Purpose:        models.PurposeSession,
+		SessionID:      &session.ID,
+		PaymentMethod:  "wallet",
+		PaymentGateway: "wallet",
+		ExternalID:     "WALLET-" + session.ID.String()[:8],
 		Amount:         estimatedCost,
+		Discount:       estimatedDiscount,
 		Status:         models.PaymentPending,
 	}
 
+	if member != nil {
+		payment.PaymentMethod = "organization"
+	}
+
+	// Direct-pay sessions are paid by QRIS first; the payment is credited
+	// to the wallet and the session is then settled from it like any other
+	if directPay {
+		payment.PaymentMethod = gateway.MethodQRIS
+		payment.PaymentGateway = provider.Name()
+		payment.ExternalID = ""
+		payment.PrepaidAmount = estimatedCost
+	}
+
 	if err := h.DB.Create(&payment).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal membuat pembayaran"})
 		return
 	}
 
+	if directPay {
+		h.createDirectCharge(c, provider, &session, &payment, user, estimatedCost, estimatedDiscount)
+		return
+	}
+
+	// Top up in the background if the balance is already below the
+	// user's threshold
+	if autoTopUp == nil && member == nil {
+		go h.AutoTopUp.Check(context.Background(), userID, 0, autotopup.TriggerSessionStart)
+	}
+
 	// Load relations
 	h.DB.Preload("Connector").Preload("Payment").First(&session, "id = ?", session.ID)
 
 	c.JSON(http.StatusCreated, gin.H{
 		"session":        session,
 		"estimated_cost": estimatedCost,
+		"discount":       estimatedDiscount,
 		"payment_url":    "/api/v1/payments/pay/" + payment.ID.String(),
 		"message":        "Sesi dibuat. Silakan lakukan pembayaran.",
 	})
 }
 
+// createDirectCharge creates the QRIS charge of a direct-pay session and
+// returns the QR payload to the user. Charging starts once the provider
+// confirms the payment on the callback. A session whose charge could not be
+// created is cancelled.
+func (h *SessionHandler) createDirectCharge(c *gin.Context, provider gateway.Provider, session *models.ChargingSession,
+	payment *models.Payment, user models.User, estimatedCost, estimatedDiscount models.Money) {
+	charge, err := provider.CreateCharge(c.Request.Context(), gateway.ChargeRequest{
+		OrderID:     payment.ID.String(),
+		Amount:      payment.Amount,
+		Method:      gateway.MethodQRIS,
+		Description: "Sesi charging SistemCharging",
+		Customer:    gateway.Customer{Name: user.Name, Email: user.Email, Phone: user.Phone},
+		Expiry:      h.PaymentExpiry,
+	})
+	if err != nil {
+		log.Printf("⚠️  %s QRIS charge for payment %s failed: %v", provider.Name(), payment.ID, err)
+		h.DB.Transaction(func(tx *gorm.DB) error {
+			return services.CancelSession(tx, session, time.Now())
+		})
+		h.DB.Model(payment).Update("status", models.PaymentFailed)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Gagal menghubungi payment gateway"})
+		return
+	}
+
+	payment.ExternalID = charge.Reference
+	payment.PaymentURL = charge.QRImageURL
+	payment.QRString = charge.QRString
+	payment.ExpiresAt = charge.ExpiresAt
+	h.DB.Model(payment).Updates(map[string]interface{}{
+		"external_id": payment.ExternalID,
+		"payment_url": payment.PaymentURL,
+		"qr_string":   payment.QRString,
+		"expires_at":  payment.ExpiresAt,
+	})
+
+	// Load relations
+	h.DB.Preload("Connector").Preload("Payment").First(session, "id = ?", session.ID)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"session":        session,
+		"estimated_cost": estimatedCost,
+		"discount":       estimatedDiscount,
+		"charge":         charge,
+		"message":        "Sesi dibuat. Pindai kode QRIS untuk membayar; charging dimulai setelah pembayaran diterima.",
+	})
+}
+
+func orderLineItems(db *gorm.DB) *gorm.DB {
+	return db.Order("position")
+}
+
 func (h *SessionHandler) Get(c *gin.Context) {
 	userID := c.MustGet("user_id").(uuid.UUID)
 
@@ -129,12 +446,17 @@ func (h *SessionHandler) Get(c *gin.Context) {
 	}
 
 	var session models.ChargingSession
-	if err := h.DB.Preload("Connector.Station").Preload("Payment").
+	if err := h.DB.Preload("Connector.Station").Preload("Payment").Preload("LineItems", orderLineItems).
 		First(&session, "id = ? AND user_id = ?", sessionID, userID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Sesi tidak ditemukan"})
 		return
 	}
 
+	// Line items are stored at settlement; show the running bill until then
+	if len(session.LineItems) == 0 && (session.Status == models.SessionCharging || session.Status == models.SessionIdle) {
+		session.LineItems = services.BuildLineItems(&session, services.LoadChargeRules(h.DB))
+	}
+
 	c.JSON(http.StatusOK, session)
 }
 
@@ -154,68 +476,36 @@ func (h *SessionHandler) Stop(c *gin.Context) {
 		return
 	}
 
-	if session.Status != models.SessionCharging {
+	if session.Status != models.SessionCharging && session.Status != models.SessionIdle {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Sesi tidak sedang dalam proses charging"})
 		return
 	}
 
-	// Send STOP command via MQTT
-	err = h.MQTT.SendCommand(session.Connector.MQTTTopic, mqttclient.ChargerCommand{
-		Action:    "STOP",
-		SessionID: session.ID.String(),
-	})
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengirim perintah stop"})
-		return
-	}
-
-	// Update session and balance in transaction
-	err = h.DB.Transaction(func(tx *gorm.DB) error {
-		now := time.Now()
-		session.Status = models.SessionCompleted
-		session.EndedAt = &now
-		session.TotalCost = session.EnergyKWH * session.Connector.PricePerKWH
-
-		// Update session and balance in transaction
-		if err := tx.Save(&session).Error; err != nil {
-			return err
-		}
-
-		// Update payment record with final cost
-		if err := tx.Model(&models.Payment{}).Where("session_id = ?", session.ID).
-			Updates(map[string]interface{}{
-				"amount": session.TotalCost,
-				"status": models.PaymentSuccess,
-			}).Error; err != nil {
-			return err
-		}
-
-		// Deduct balance
-		if err := tx.Model(&models.User{}).Where("id = ?", userID).Update("balance", gorm.Expr("balance - ?", session.TotalCost)).Error; err != nil {
-			return err
-		}
-
-		// Create transaction record
-		transaction := models.WalletTransaction{
-			UserID:          userID,
-			Amount:          session.TotalCost,
-			TransactionType: models.TransactionDeduction,
-			ReferenceID:     session.ID.String(),
-			Description:     "Pembayaran pengisian daya",
-		}
-		if err := tx.Create(&transaction).Error; err != nil {
-			return err
+	// Send STOP command via MQTT (an idle session has already stopped drawing power)
+	if session.Status == models.SessionCharging {
+		err = h.MQTT.SendCommand(session.Connector.MQTTTopic, mqttclient.ChargerCommand{
+			Action:    "STOP",
+			SessionID: session.ID.String(),
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengirim perintah stop"})
+			return
 		}
+	}
 
-		// Free connector
-		session.Connector.Status = models.ConnectorAvailable
-		if err := tx.Save(&session.Connector).Error; err != nil {
-			return err
-		}
+	if session.StopReason == "" {
+		session.StopReason = models.StopUser
+	}
 
-		return nil
+	// Settle energy cost and idle fee, deduct balance and free connector
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		return services.SettleSession(tx, &session, time.Now())
 	})
 
+	if errors.Is(err, services.ErrSessionClosed) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Sesi sudah diselesaikan oleh charger"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menyelesaikan sesi dan memotong saldo"})
 		return
@@ -232,10 +522,149 @@ func (h *SessionHandler) Stop(c *gin.Context) {
 	h.Hub.Broadcast(userID.String(), balanceData)
 	h.Hub.Broadcast("admin", balanceData)
 
+	go h.AutoTopUp.Check(context.Background(), userID, 0, autotopup.TriggerSettlement)
+
+	response := gin.H{
+		"message":          "Charging berhasil dihentikan",
+		"session":          session,
+		"energy_cost":      session.EnergyCost,
+		"time_cost":        session.TimeCost,
+		"start_fee":        session.StartFee,
+		"price_adjustment": session.Adjustment,
+		"idle_fee":         session.IdleFee,
+		"discount":         session.Discount,
+		"service_fee":      session.ServiceFee,
+		"tax":              session.Tax,
+		"total_cost":       session.TotalCost,
+		"line_items":       session.LineItems,
+		"receipt_url":      "/api/v1/sessions/" + session.ID.String() + "/receipt",
+	}
+
+	// What a direct-pay session did not use stays in the wallet
+	var payment models.Payment
+	if err := h.DB.Select("prepaid_amount").First(&payment, "session_id = ?", session.ID).Error; err == nil &&
+		payment.PrepaidAmount > 0 {
+		response["prepaid_amount"] = payment.PrepaidAmount
+		if unused := payment.PrepaidAmount - session.TotalCost; unused > 0 {
+			response["credited_to_wallet"] = unused
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// Cancel cancels a session that has not started charging yet and releases
+// a connector held for a scheduled start.
+func (h *SessionHandler) Cancel(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	sessionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Session ID tidak valid"})
+		return
+	}
+
+	var session models.ChargingSession
+	if err := h.DB.First(&session, "id = ? AND user_id = ?", sessionID, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sesi tidak ditemukan"})
+		return
+	}
+
+	if session.Status != models.SessionPending && session.Status != models.SessionScheduled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Hanya sesi yang belum dimulai yang dapat dibatalkan"})
+		return
+	}
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		return services.CancelSession(tx, &session, time.Now())
+	})
+	if errors.Is(err, services.ErrSessionNotWaiting) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Hanya sesi yang belum dimulai yang dapat dibatalkan"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal membatalkan sesi"})
+		return
+	}
+
+	h.MQTT.BroadcastSessionStatus(&session)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Sesi berhasil dibatalkan",
+		"session": session,
+	})
+}
+
+// Reschedule changes the start time or ready-by deadline of a session that
+// has not started charging yet.
+func (h *SessionHandler) Reschedule(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	sessionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Session ID tidak valid"})
+		return
+	}
+
+	var req ScheduleSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.ScheduledStartAt == nil && req.ReadyBy == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Tentukan scheduled_start_at atau ready_by"})
+		return
+	}
+
+	var session models.ChargingSession
+	if err := h.DB.Preload("Connector").Preload("Vehicle").
+		First(&session, "id = ? AND user_id = ?", sessionID, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sesi tidak ditemukan"})
+		return
+	}
+
+	if session.Status != models.SessionPending && session.Status != models.SessionScheduled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Hanya sesi yang belum dimulai yang dapat dijadwalkan ulang"})
+		return
+	}
+
+	tariff, err := services.SessionTariff(h.DB, &session, session.Connector)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memuat tarif"})
+		return
+	}
+
+	if err := services.ResolveSchedule(&session, services.VehicleConnector(session.Connector, session.Vehicle), tariff, req.ScheduledStartAt, req.ReadyBy, time.Now()); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// A deadline too close to honour starts a paid session right away
+	if session.Status == models.SessionScheduled && session.ScheduledAt == nil {
+		if err := h.MQTT.StartSession(&session); errors.Is(err, services.ErrSessionNotWaiting) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Hanya sesi yang belum dimulai yang dapat dijadwalkan ulang"})
+			return
+		} else if errors.Is(err, services.ErrConnectorUnavailable) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Connector sedang tidak tersedia"})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengirim perintah ke charger"})
+			return
+		}
+	} else {
+		if err := h.DB.Model(&session).Updates(map[string]interface{}{
+			"scheduled_at": session.ScheduledAt,
+			"ready_by":     session.ReadyBy,
+		}).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menjadwalkan ulang sesi"})
+			return
+		}
+		h.MQTT.BroadcastSessionStatus(&session)
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"message":    "Charging berhasil dihentikan",
-		"session":    session,
-		"total_cost": session.TotalCost,
+		"message": "Jadwal sesi berhasil diperbarui",
+		"session": session,
 	})
 }
 
@@ -243,7 +672,7 @@ func (h *SessionHandler) History(c *gin.Context) {
 	userID := c.MustGet("user_id").(uuid.UUID)
 
 	var sessions []models.ChargingSession
-	if err := h.DB.Preload("Connector.Station").Preload("Payment").
+	if err := h.DB.Preload("Connector.Station").Preload("Payment").Preload("LineItems", orderLineItems).
 		Where("user_id = ?", userID).
 		Order("created_at DESC").
 		Find(&sessions).Error; err != nil {
@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
+	mqttclient "github.com/Julianarwansah/sistemcharging/backend/internal/mqtt"
+	"github.com/Julianarwansah/sistemcharging/backend/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"gorm.io/gorm"
+)
+
+// shareCheckInterval is how often an open public stream checks that its
+// link is still valid.
+const shareCheckInterval = 30 * time.Second
+
+type SessionShareHandler struct {
+	DB  *gorm.DB
+	Hub *mqttclient.WebSocketHub
+}
+
+// Create makes a share link for one of the user's sessions, valid for
+// expires_in_minutes (default 3 hours, at most 24).
+func (h *SessionShareHandler) Create(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	var input struct {
+		ExpiresInMinutes int `json:"expires_in_minutes" binding:"omitempty,min=5,max=1440"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.ExpiresInMinutes == 0 {
+		input.ExpiresInMinutes = 180
+	}
+
+	var session models.ChargingSession
+	if err := h.DB.First(&session, "id = ? AND user_id = ?", c.Param("id"), userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sesi tidak ditemukan"})
+		return
+	}
+	if services.IsSessionClosed(session.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Sesi sudah selesai"})
+		return
+	}
+
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal membuat link berbagi"})
+		return
+	}
+	share := models.SessionShare{
+		SessionID: session.ID,
+		UserID:    userID,
+		Token:     base64.RawURLEncoding.EncodeToString(b),
+		ExpiresAt: time.Now().Add(time.Duration(input.ExpiresInMinutes) * time.Minute),
+	}
+	if err := h.DB.Create(&share).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal membuat link berbagi"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"share":  share,
+		"url":    "/api/v1/public/sessions/" + share.Token,
+		"ws_url": "/api/v1/public/sessions/" + share.Token + "/ws",
+	})
+}
+
+// List returns the share links of one of the user's sessions.
+func (h *SessionShareHandler) List(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	var shares []models.SessionShare
+	if err := h.DB.Where("session_id = ? AND user_id = ?", c.Param("id"), userID).
+		Order("created_at desc").Find(&shares).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil link berbagi"})
+		return
+	}
+	c.JSON(http.StatusOK, shares)
+}
+
+// Revoke ends a share link right away; open streams close within
+// shareCheckInterval.
+func (h *SessionShareHandler) Revoke(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	result := h.DB.Model(&models.SessionShare{}).
+		Where("id = ? AND session_id = ? AND user_id = ? AND revoked_at IS NULL", c.Param("shareId"), c.Param("id"), userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mencabut link berbagi"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Link berbagi tidak ditemukan"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Link berbagi dicabut"})
+}
+
+// share loads the link of the request's token and writes the error
+// response when it is unknown, expired or revoked.
+func (h *SessionShareHandler) share(c *gin.Context) (*models.SessionShare, bool) {
+	var share models.SessionShare
+	if err := h.DB.First(&share, "token = ?", c.Param("token")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Link tidak ditemukan"})
+		return nil, false
+	}
+	if !share.Active(time.Now()) {
+		c.JSON(http.StatusGone, gin.H{"error": "Link sudah kedaluwarsa atau dicabut"})
+		return nil, false
+	}
+	return &share, true
+}
+
+// progress returns what a share link shows of its session: charging
+// progress and where, but no cost or personal data. The vehicle is never
+// loaded.
+func (h *SessionShareHandler) progress(share *models.SessionShare) (*models.ChargingSession, gin.H, error) {
+	var session models.ChargingSession
+	if err := h.DB.Preload("Connector.Station").
+		First(&session, "id = ?", share.SessionID).Error; err != nil {
+		return nil, nil, err
+	}
+
+	station := session.Connector.Station
+	return &session, gin.H{
+		"type":                    "progress",
+		"status":                  session.Status,
+		"energy_kwh":              session.EnergyKWH,
+		"power_kw":                session.PowerKW,
+		"progress":                session.Progress,
+		"soc":                     session.SoC,
+		"target_soc":              session.TargetSoC,
+		"target_kwh":              session.TargetKWH,
+		"started_at":              session.StartedAt,
+		"charged_at":              session.ChargedAt,
+		"ended_at":                session.EndedAt,
+		"estimated_completion_at": services.EstimatedCompletion(&session, session.Connector, time.Now()),
+		"connector_type":          session.Connector.ConnectorType,
+		"station": gin.H{
+			"name":      station.Name,
+			"address":   station.Address,
+			"latitude":  station.Latitude,
+			"longitude": station.Longitude,
+		},
+		"expires_at": share.ExpiresAt,
+	}, nil
+}
+
+// PublicProgress shows a shared session's progress without logging in.
+func (h *SessionShareHandler) PublicProgress(c *gin.Context) {
+	share, ok := h.share(c)
+	if !ok {
+		return
+	}
+
+	_, view, err := h.progress(share)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sesi tidak ditemukan"})
+		return
+	}
+	c.JSON(http.StatusOK, view)
+}
+
+// PublicStream streams a shared session's progress without logging in. It
+// sends the same view as PublicProgress on every update of the session and
+// closes once the session is over or the link expires or is revoked.
+func (h *SessionShareHandler) PublicStream(c *gin.Context) {
+	share, ok := h.share(c)
+	if !ok {
+		return
+	}
+
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Printf("WebSocket upgrade failed: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	// Updates of the session only trigger a fresh view; the raw messages
+	// carry cost data and are never forwarded
+	topic := share.SessionID.String()
+	ch := h.Hub.Subscribe(topic)
+	defer h.Hub.Unsubscribe(topic, ch)
+
+	ticker := time.NewTicker(shareCheckInterval)
+	defer ticker.Stop()
+
+	// Stop as soon as the viewer goes away rather than at the next write
+	closed := readUntilClosed(conn)
+
+	send := func() bool {
+		session, view, err := h.progress(share)
+		if err != nil {
+			return false
+		}
+		data, _ := json.Marshal(view)
+		if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+			return false
+		}
+		return !services.IsSessionClosed(session.Status)
+	}
+
+	for open := send(); open; {
+		select {
+		case _, ok := <-ch:
+			open = ok && send()
+		case <-closed:
+			open = false
+		case <-ticker.C:
+			if err := h.DB.First(share, "id = ?", share.ID).Error; err != nil || !share.Active(time.Now()) {
+				conn.WriteJSON(gin.H{"type": "expired"})
+				open = false
+			}
+		}
+	}
+}
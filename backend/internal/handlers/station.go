@@ -1,10 +1,14 @@
 package handlers
 
 import (
+	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
+	"github.com/Julianarwansah/sistemcharging/backend/internal/services"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
@@ -36,7 +40,7 @@ func (h *StationHandler) Get(c *gin.Context) {
 	}
 
 	var station models.Station
-	if err := h.DB.Preload("Connectors").First(&station, "id = ?", id).Error; err != nil {
+	if err := h.DB.Preload("Connectors.Tariff.Bands").Preload("Tariff.Bands").First(&station, "id = ?", id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Stasiun tidak ditemukan"})
 		return
 	}
@@ -52,7 +56,7 @@ func (h *StationHandler) GetByQR(c *gin.Context) {
 	}
 
 	var station models.Station
-	if err := h.DB.Preload("Connectors").Where("qr_code = ?", qrCode).First(&station).Error; err != nil {
+	if err := h.DB.Preload("Connectors.Tariff.Bands").Preload("Tariff.Bands").Where("qr_code = ?", qrCode).First(&station).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Stasiun dengan QR code tersebut tidak ditemukan"})
 		return
 	}
@@ -117,15 +121,19 @@ func (h *StationHandler) Delete(c *gin.Context) {
 func (h *StationHandler) Create(c *gin.Context) {
 	log.Println("DEBUG: Create station request received")
 	var input struct {
-		Name       string  `json:"name" binding:"required"`
-		Address    string  `json:"address" binding:"required"`
-		Latitude   float64 `json:"latitude"`
-		Longitude  float64 `json:"longitude"`
-		QRCode     string  `json:"qr_code" binding:"required"`
+		Name       string               `json:"name" binding:"required"`
+		Address    string               `json:"address" binding:"required"`
+		Latitude   float64              `json:"latitude"`
+		Longitude  float64              `json:"longitude"`
+		QRCode     string               `json:"qr_code" binding:"required"`
+		IdleFee    models.IdleFeePolicy `json:"idle_fee"`
+		TariffID   *uuid.UUID           `json:"tariff_id"`
 		Connectors []struct {
-			ConnectorType string  `json:"connector_type" binding:"required"`
-			PowerKW       float64 `json:"power_kw" binding:"required"`
-			PricePerKWH   float64 `json:"price_per_kwh" binding:"required"`
+			ConnectorType string               `json:"connector_type" binding:"required"`
+			PowerKW       float64              `json:"power_kw" binding:"required"`
+			PricePerKWH   models.Money         `json:"price_per_kwh" binding:"required"`
+			IdleFee       models.IdleFeePolicy `json:"idle_fee"`
+			TariffID      *uuid.UUID           `json:"tariff_id"`
 		} `json:"connectors" binding:"required"`
 	}
 
@@ -141,6 +149,8 @@ func (h *StationHandler) Create(c *gin.Context) {
 		Longitude: input.Longitude,
 		QRCode:    input.QRCode,
 		Status:    models.StationActive,
+		IdleFee:   input.IdleFee,
+		TariffID:  input.TariffID,
 	}
 
 	err := h.DB.Transaction(func(tx *gorm.DB) error {
@@ -156,10 +166,15 @@ func (h *StationHandler) Create(c *gin.Context) {
 				PricePerKWH:   connInput.PricePerKWH,
 				Status:        models.ConnectorAvailable,
 				MQTTTopic:     "charger/" + station.ID.String() + "/connector",
+				IdleFee:       connInput.IdleFee,
+				TariffID:      connInput.TariffID,
 			}
 			if err := tx.Create(&connector).Error; err != nil {
 				return err
 			}
+			if err := services.RecordPriceChange(tx, connector, adminIDFrom(c), "Harga awal", time.Now()); err != nil {
+				return err
+			}
 		}
 		return nil
 	})
@@ -182,17 +197,21 @@ func (h *StationHandler) Update(c *gin.Context) {
 	}
 
 	var input struct {
-		Name       string  `json:"name" binding:"required"`
-		Address    string  `json:"address" binding:"required"`
-		Latitude   float64 `json:"latitude"`
-		Longitude  float64 `json:"longitude"`
-		QRCode     string  `json:"qr_code" binding:"required"`
-		Status     string  `json:"status"`
+		Name       string                         `json:"name" binding:"required"`
+		Address    string                         `json:"address" binding:"required"`
+		Latitude   float64                        `json:"latitude"`
+		Longitude  float64                        `json:"longitude"`
+		QRCode     string                         `json:"qr_code" binding:"required"`
+		Status     string                         `json:"status"`
+		IdleFee    optional[models.IdleFeePolicy] `json:"idle_fee"`
+		TariffID   optional[*uuid.UUID]           `json:"tariff_id"`
 		Connectors []struct {
-			ID            uuid.UUID `json:"id"`
-			ConnectorType string    `json:"connector_type" binding:"required"`
-			PowerKW       float64   `json:"power_kw" binding:"required"`
-			PricePerKWH   float64   `json:"price_per_kwh" binding:"required"`
+			ID            uuid.UUID                      `json:"id"`
+			ConnectorType string                         `json:"connector_type" binding:"required"`
+			PowerKW       float64                        `json:"power_kw" binding:"required"`
+			PricePerKWH   models.Money                   `json:"price_per_kwh" binding:"required"`
+			IdleFee       optional[models.IdleFeePolicy] `json:"idle_fee"`
+			TariffID      optional[*uuid.UUID]           `json:"tariff_id"`
 		} `json:"connectors" binding:"required"`
 	}
 
@@ -201,6 +220,7 @@ func (h *StationHandler) Update(c *gin.Context) {
 		return
 	}
 
+	var cancelledChanges int64
 	err = h.DB.Transaction(func(tx *gorm.DB) error {
 		var station models.Station
 		if err := tx.First(&station, "id = ?", id).Error; err != nil {
@@ -212,6 +232,14 @@ func (h *StationHandler) Update(c *gin.Context) {
 		station.Latitude = input.Latitude
 		station.Longitude = input.Longitude
 		station.QRCode = input.QRCode
+		// The idle fee and tariff are left alone unless the request has them,
+		// since the station form does not edit them
+		if input.IdleFee.Set {
+			station.IdleFee = input.IdleFee.Value
+		}
+		if input.TariffID.Set {
+			station.TariffID = input.TariffID.Value
+		}
 		if input.Status != "" {
 			station.Status = models.StationStatus(input.Status)
 		}
@@ -232,6 +260,12 @@ func (h *StationHandler) Update(c *gin.Context) {
 		for _, connInput := range input.Connectors {
 			if connInput.ID != uuid.Nil {
 				inputConnectorIDs[connInput.ID] = true
+
+				var previous models.Connector
+				if err := tx.First(&previous, "id = ?", connInput.ID).Error; err != nil {
+					return err
+				}
+
 				// Update existing connector
 				connector := models.Connector{
 					ID:            connInput.ID,
@@ -239,14 +273,38 @@ func (h *StationHandler) Update(c *gin.Context) {
 					ConnectorType: connInput.ConnectorType,
 					PowerKW:       connInput.PowerKW,
 					PricePerKWH:   connInput.PricePerKWH,
+					TariffID:      previous.TariffID,
 				}
-				if err := tx.Model(&connector).Updates(map[string]interface{}{
+				updates := map[string]interface{}{
 					"connector_type": connInput.ConnectorType,
 					"power_kw":       connInput.PowerKW,
 					"price_per_kwh":  connInput.PricePerKWH,
-				}).Error; err != nil {
+				}
+				if connInput.IdleFee.Set {
+					updates["idle_grace_minutes"] = connInput.IdleFee.Value.GraceMinutes
+					updates["idle_fee_per_minute"] = connInput.IdleFee.Value.FeePerMinute
+					updates["idle_max_fee"] = connInput.IdleFee.Value.MaxFee
+				}
+				if connInput.TariffID.Set {
+					updates["tariff_id"] = connInput.TariffID.Value
+					connector.TariffID = connInput.TariffID.Value
+				}
+				if err := tx.Model(&connector).Updates(updates).Error; err != nil {
 					return err
 				}
+
+				// Keep the connector's price history in step with direct edits,
+				// which supersede changes scheduled before them
+				if previous.PricePerKWH != connInput.PricePerKWH || !sameTariff(previous.TariffID, connector.TariffID) {
+					if err := services.RecordPriceChange(tx, connector, adminIDFrom(c), "Diubah melalui update stasiun", time.Now()); err != nil {
+						return err
+					}
+					cancelled, err := services.CancelPendingPriceChanges(tx, connector.ID)
+					if err != nil {
+						return err
+					}
+					cancelledChanges += cancelled
+				}
 			} else {
 				// Create new connector
 				newConnector := models.Connector{
@@ -256,10 +314,15 @@ func (h *StationHandler) Update(c *gin.Context) {
 					PricePerKWH:   connInput.PricePerKWH,
 					Status:        models.ConnectorAvailable,
 					MQTTTopic:     "charger/" + station.ID.String() + "/connector",
+					IdleFee:       connInput.IdleFee.Value,
+					TariffID:      connInput.TariffID.Value,
 				}
 				if err := tx.Create(&newConnector).Error; err != nil {
 					return err
 				}
+				if err := services.RecordPriceChange(tx, newConnector, adminIDFrom(c), "Harga awal", time.Now()); err != nil {
+					return err
+				}
 			}
 		}
 
@@ -282,6 +345,32 @@ func (h *StationHandler) Update(c *gin.Context) {
 		return
 	}
 
-	logActivity(c, h.DB, "Update Stasiun", input.Name, "Admin memperbarui data stasiun")
-	c.JSON(http.StatusOK, gin.H{"message": "Stasiun berhasil diperbarui"})
+	detail := "Admin memperbarui data stasiun"
+	if cancelledChanges > 0 {
+		detail += fmt.Sprintf(", %d perubahan harga terjadwal dibatalkan", cancelledChanges)
+	}
+	logActivity(c, h.DB, "Update Stasiun", input.Name, detail)
+	c.JSON(http.StatusOK, gin.H{
+		"message":                 "Stasiun berhasil diperbarui",
+		"cancelled_price_changes": cancelledChanges,
+	})
+}
+
+// optional is a request field that may be left out. Set tells a missing
+// field apart from an explicit null, which clears the value.
+type optional[T any] struct {
+	Set   bool
+	Value T
+}
+
+func (o *optional[T]) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	return json.Unmarshal(data, &o.Value)
+}
+
+func sameTariff(a, b *uuid.UUID) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
 }
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newMockDB(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	t.Helper()
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{
+		SkipDefaultTransaction: true,
+		Logger:                 logger.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, mock
+}
+
+func TestOptionalUnmarshal(t *testing.T) {
+	tariffID := uuid.New()
+
+	tests := []struct {
+		name      string
+		body      string
+		wantSet   bool
+		wantValue *uuid.UUID
+	}{
+		{"left out", `{}`, false, nil},
+		{"explicit null", `{"tariff_id":null}`, true, nil},
+		{"value", `{"tariff_id":"` + tariffID.String() + `"}`, true, &tariffID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var input struct {
+				TariffID optional[*uuid.UUID] `json:"tariff_id"`
+			}
+			if err := json.Unmarshal([]byte(tt.body), &input); err != nil {
+				t.Fatal(err)
+			}
+			if input.TariffID.Set != tt.wantSet || !sameTariff(input.TariffID.Value, tt.wantValue) {
+				t.Errorf("got set %v, value %v; want set %v, value %v",
+					input.TariffID.Set, input.TariffID.Value, tt.wantSet, tt.wantValue)
+			}
+		})
+	}
+}
+
+// TestStationUpdateKeepsIdleFeeAndTariff sends the body of the admin station
+// form, which has no idle fee or tariff fields, and checks that neither is
+// cleared and no price change is recorded.
+func TestStationUpdateKeepsIdleFeeAndTariff(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, mock := newMockDB(t)
+
+	stationID, connectorID, tariffID := uuid.New(), uuid.New(), uuid.New()
+	idleColumns := []string{"idle_grace_minutes", "idle_fee_per_minute", "idle_max_fee", "tariff_id"}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "stations" WHERE id = \$1`).
+		WillReturnRows(sqlmock.NewRows(append([]string{"id", "name", "status"}, idleColumns...)).
+			AddRow(stationID, "SPKLU Lama", "active", 10, int64(50000), int64(0), tariffID))
+	mock.ExpectExec(`UPDATE "stations" SET "name"=\$1,"address"=\$2,"latitude"=\$3,"longitude"=\$4,"qr_code"=\$5,"status"=\$6,"idle_grace_minutes"=\$7,"idle_fee_per_minute"=\$8,"idle_max_fee"=\$9,"tariff_id"=\$10,`).
+		WithArgs("SPKLU Baru", "Jl. Sudirman 1", 0.0, 0.0, "QR-1", "active", int64(10), int64(50000), int64(0), tariffID.String(),
+			sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), stationID.String()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT "id" FROM "connectors" WHERE station_id = \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(connectorID))
+	mock.ExpectQuery(`SELECT \* FROM "connectors" WHERE id = \$1`).
+		WillReturnRows(sqlmock.NewRows(append([]string{"id", "station_id", "price_per_kwh"}, idleColumns...)).
+			AddRow(connectorID, stationID, int64(250000), 5, int64(20000), int64(0), tariffID))
+	// Only the fields the form edits; no price change since the price and
+	// tariff stay the same
+	mock.ExpectExec(`UPDATE "connectors" SET "connector_type"=\$1,"power_kw"=\$2,"price_per_kwh"=\$3,"updated_at"=\$4 WHERE`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	router := gin.New()
+	router.PUT("/admin/stations/:id", (&StationHandler{DB: db}).Update)
+
+	body := `{"name":"SPKLU Baru","address":"Jl. Sudirman 1","latitude":0,"longitude":0,"qr_code":"QR-1",
+		"connectors":[{"id":"` + connectorID.String() + `","connector_type":"CCS","power_kw":50,"price_per_kwh":2500}]}`
+	req := httptest.NewRequest(http.MethodPut, "/admin/stations/"+stationID.String(), strings.NewReader(body))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body %s)", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type TariffHandler struct {
+	DB *gorm.DB
+}
+
+type TariffBandInput struct {
+	Name           string       `json:"name"`
+	Weekdays       string       `json:"weekdays"`
+	StartHour      int          `json:"start_hour" binding:"min=0,max=23"`
+	EndHour        int          `json:"end_hour" binding:"min=1,max=24"`
+	PricePerKWH    models.Money `json:"price_per_kwh" binding:"min=0"`
+	PricePerMinute models.Money `json:"price_per_minute" binding:"min=0"`
+}
+
+type TariffInput struct {
+	Name           string            `json:"name" binding:"required"`
+	Description    string            `json:"description"`
+	PricePerKWH    models.Money      `json:"price_per_kwh" binding:"min=0"`
+	PricePerMinute models.Money      `json:"price_per_minute" binding:"min=0"`
+	StartFee       models.Money      `json:"start_fee" binding:"min=0"`
+	MinPrice       models.Money      `json:"min_price" binding:"min=0"`
+	MaxPrice       models.Money      `json:"max_price" binding:"min=0"`
+	Bands          []TariffBandInput `json:"bands" binding:"dive"`
+}
+
+// validate checks what the binding tags cannot and returns the error
+// message, or "" when the input is valid.
+func (in TariffInput) validate() string {
+	if in.MaxPrice > 0 && in.MinPrice > in.MaxPrice {
+		return "Harga minimum tidak boleh melebihi harga maksimum"
+	}
+	for _, b := range in.Bands {
+		// A band covering the whole day is written 0-24
+		if b.StartHour == b.EndHour {
+			return "Jam mulai dan jam selesai band tarif tidak boleh sama"
+		}
+	}
+	return ""
+}
+
+func (in TariffInput) bands(tariffID uuid.UUID) []models.TariffBand {
+	bands := make([]models.TariffBand, 0, len(in.Bands))
+	for _, b := range in.Bands {
+		bands = append(bands, models.TariffBand{
+			TariffID:       tariffID,
+			Name:           b.Name,
+			Weekdays:       b.Weekdays,
+			StartHour:      b.StartHour,
+			EndHour:        b.EndHour,
+			PricePerKWH:    b.PricePerKWH,
+			PricePerMinute: b.PricePerMinute,
+		})
+	}
+	return bands
+}
+
+func (h *TariffHandler) List(c *gin.Context) {
+	var tariffs []models.Tariff
+	if err := h.DB.Preload("Bands").Order("created_at desc").Find(&tariffs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil data tarif"})
+		return
+	}
+	c.JSON(http.StatusOK, tariffs)
+}
+
+func (h *TariffHandler) Get(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID tarif tidak valid"})
+		return
+	}
+
+	var tariff models.Tariff
+	if err := h.DB.Preload("Bands").First(&tariff, "id = ?", id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tarif tidak ditemukan"})
+		return
+	}
+	c.JSON(http.StatusOK, tariff)
+}
+
+func (h *TariffHandler) Create(c *gin.Context) {
+	var input TariffInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid: " + err.Error()})
+		return
+	}
+	if msg := input.validate(); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	tariff := models.Tariff{
+		Name:           input.Name,
+		Description:    input.Description,
+		PricePerKWH:    input.PricePerKWH,
+		PricePerMinute: input.PricePerMinute,
+		StartFee:       input.StartFee,
+		MinPrice:       input.MinPrice,
+		MaxPrice:       input.MaxPrice,
+	}
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&tariff).Error; err != nil {
+			return err
+		}
+		if bands := input.bands(tariff.ID); len(bands) > 0 {
+			if err := tx.Create(&bands).Error; err != nil {
+				return err
+			}
+			tariff.Bands = bands
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menyimpan tarif: " + err.Error()})
+		return
+	}
+
+	logActivity(c, h.DB, "Tambah Tarif", tariff.Name, "Admin membuat tarif baru")
+	c.JSON(http.StatusCreated, tariff)
+}
+
+func (h *TariffHandler) Update(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID tarif tidak valid"})
+		return
+	}
+
+	var input TariffInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid: " + err.Error()})
+		return
+	}
+	if msg := input.validate(); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	var tariff models.Tariff
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&tariff, "id = ?", id).Error; err != nil {
+			return err
+		}
+
+		tariff.Name = input.Name
+		tariff.Description = input.Description
+		tariff.PricePerKWH = input.PricePerKWH
+		tariff.PricePerMinute = input.PricePerMinute
+		tariff.StartFee = input.StartFee
+		tariff.MinPrice = input.MinPrice
+		tariff.MaxPrice = input.MaxPrice
+		if err := tx.Save(&tariff).Error; err != nil {
+			return err
+		}
+
+		// Bands are replaced as a whole
+		if err := tx.Where("tariff_id = ?", id).Delete(&models.TariffBand{}).Error; err != nil {
+			return err
+		}
+		if bands := input.bands(tariff.ID); len(bands) > 0 {
+			if err := tx.Create(&bands).Error; err != nil {
+				return err
+			}
+			tariff.Bands = bands
+		}
+		return nil
+	})
+	if err == gorm.ErrRecordNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tarif tidak ditemukan"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memperbarui tarif: " + err.Error()})
+		return
+	}
+
+	logActivity(c, h.DB, "Update Tarif", tariff.Name, "Admin memperbarui tarif")
+	c.JSON(http.StatusOK, tariff)
+}
+
+func (h *TariffHandler) Delete(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID tarif tidak valid"})
+		return
+	}
+
+	// Stations and connectors using this tariff fall back to their flat price
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Connector{}).Where("tariff_id = ?", id).Update("tariff_id", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Station{}).Where("tariff_id = ?", id).Update("tariff_id", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("tariff_id = ?", id).Delete(&models.TariffBand{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.Tariff{}, "id = ?", id).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghapus tarif: " + err.Error()})
+		return
+	}
+
+	logActivity(c, h.DB, "Hapus Tarif", id.String(), "Admin menghapus tarif")
+	c.JSON(http.StatusOK, gin.H{"message": "Tarif berhasil dihapus"})
+}
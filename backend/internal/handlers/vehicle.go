@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type VehicleHandler struct {
+	DB *gorm.DB
+}
+
+type VehicleInput struct {
+	Make           string   `json:"make" binding:"required,max=50"`
+	Model          string   `json:"model" binding:"required,max=50"`
+	Plate          string   `json:"plate" binding:"max=20"`
+	BatteryKWH     float64  `json:"battery_kwh" binding:"required,gt=0,lte=500"`
+	ConnectorTypes []string `json:"connector_types" binding:"required,min=1,dive,required,max=50"`
+	MaxACKW        float64  `json:"max_ac_kw" binding:"gte=0"`
+	MaxDCKW        float64  `json:"max_dc_kw" binding:"gte=0"`
+}
+
+func (in VehicleInput) apply(vehicle *models.Vehicle) {
+	vehicle.Make = strings.TrimSpace(in.Make)
+	vehicle.Model = strings.TrimSpace(in.Model)
+	vehicle.Plate = strings.ToUpper(strings.TrimSpace(in.Plate))
+	vehicle.BatteryKWH = in.BatteryKWH
+	vehicle.ConnectorTypes = in.ConnectorTypes
+	vehicle.MaxACKW = in.MaxACKW
+	vehicle.MaxDCKW = in.MaxDCKW
+}
+
+// List returns the user's registered vehicles.
+func (h *VehicleHandler) List(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	var vehicles []models.Vehicle
+	if err := h.DB.Where("user_id = ?", userID).Order("created_at").Find(&vehicles).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil data kendaraan"})
+		return
+	}
+	c.JSON(http.StatusOK, vehicles)
+}
+
+// Create registers a vehicle for the user.
+func (h *VehicleHandler) Create(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	var input VehicleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	vehicle := models.Vehicle{UserID: userID}
+	input.apply(&vehicle)
+	if err := h.DB.Create(&vehicle).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menyimpan kendaraan"})
+		return
+	}
+	c.JSON(http.StatusCreated, vehicle)
+}
+
+// Update replaces the details of one of the user's vehicles. Sessions
+// already created keep the target they were capped at.
+func (h *VehicleHandler) Update(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	var vehicle models.Vehicle
+	if err := h.DB.First(&vehicle, "id = ? AND user_id = ?", c.Param("id"), userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Kendaraan tidak ditemukan"})
+		return
+	}
+
+	var input VehicleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	input.apply(&vehicle)
+	if err := h.DB.Save(&vehicle).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memperbarui kendaraan"})
+		return
+	}
+	c.JSON(http.StatusOK, vehicle)
+}
+
+// Delete removes one of the user's vehicles. Past sessions still refer to
+// it.
+func (h *VehicleHandler) Delete(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	result := h.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).Delete(&models.Vehicle{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghapus kendaraan"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Kendaraan tidak ditemukan"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Kendaraan dihapus"})
+}
@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type VoucherHandler struct {
+	DB *gorm.DB
+}
+
+type VoucherInput struct {
+	Code          string             `json:"code" binding:"required,max=50"`
+	Description   string             `json:"description"`
+	Type          models.VoucherType `json:"type" binding:"required,oneof=percentage fixed free_kwh credit"`
+	Amount        models.Money       `json:"amount" binding:"min=0"`
+	Percent       float64            `json:"percent" binding:"gte=0,lte=100"`
+	FreeKWH       float64            `json:"free_kwh" binding:"gte=0"`
+	MaxDiscount   models.Money       `json:"max_discount" binding:"min=0"`
+	UsageLimit    int                `json:"usage_limit" binding:"min=0"`
+	PerUserLimit  int                `json:"per_user_limit" binding:"min=0"`
+	ValidFrom     *time.Time         `json:"valid_from"`
+	ValidUntil    *time.Time         `json:"valid_until"`
+	StationID     *uuid.UUID         `json:"station_id"`
+	ConnectorType string             `json:"connector_type"`
+	IsActive      *bool              `json:"is_active"`
+}
+
+func (in VoucherInput) validate() string {
+	if in.value() <= 0 {
+		return "Nilai voucher harus lebih dari 0"
+	}
+	if in.ValidFrom != nil && in.ValidUntil != nil && !in.ValidUntil.After(*in.ValidFrom) {
+		return "Masa berlaku voucher tidak valid"
+	}
+	return ""
+}
+
+// value returns the input field that holds the value for the voucher type.
+func (in VoucherInput) value() float64 {
+	switch in.Type {
+	case models.VoucherPercentage:
+		return in.Percent
+	case models.VoucherFreeKWH:
+		return in.FreeKWH
+	default:
+		return float64(in.Amount)
+	}
+}
+
+func (in VoucherInput) apply(v *models.Voucher) {
+	v.Code = strings.ToUpper(strings.TrimSpace(in.Code))
+	v.Description = in.Description
+	v.Type = in.Type
+	// Only the field for the voucher type is kept, so a voucher changed to
+	// another type cannot carry over a stale value
+	v.Amount, v.Percent, v.FreeKWH = 0, 0, 0
+	switch in.Type {
+	case models.VoucherPercentage:
+		v.Percent = in.Percent
+	case models.VoucherFreeKWH:
+		v.FreeKWH = in.FreeKWH
+	default:
+		v.Amount = in.Amount
+	}
+	v.MaxDiscount = in.MaxDiscount
+	v.UsageLimit = in.UsageLimit
+	v.PerUserLimit = in.PerUserLimit
+	v.ValidFrom = in.ValidFrom
+	v.ValidUntil = in.ValidUntil
+	v.StationID = in.StationID
+	v.ConnectorType = in.ConnectorType
+	if in.IsActive != nil {
+		v.IsActive = *in.IsActive
+	}
+}
+
+// VoucherWithUsage adds the number of redemptions to a voucher for the admin list.
+type VoucherWithUsage struct {
+	models.Voucher
+	UsedCount int64 `json:"used_count"`
+}
+
+func (h *VoucherHandler) List(c *gin.Context) {
+	var vouchers []models.Voucher
+	if err := h.DB.Order("created_at desc").Find(&vouchers).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil data voucher"})
+		return
+	}
+
+	result := make([]VoucherWithUsage, 0, len(vouchers))
+	for _, v := range vouchers {
+		var used int64
+		h.DB.Model(&models.VoucherRedemption{}).Where("voucher_id = ?", v.ID).Count(&used)
+		result = append(result, VoucherWithUsage{Voucher: v, UsedCount: used})
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+func (h *VoucherHandler) Create(c *gin.Context) {
+	var input VoucherInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid: " + err.Error()})
+		return
+	}
+	if msg := input.validate(); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	voucher := models.Voucher{IsActive: true}
+	input.apply(&voucher)
+
+	var count int64
+	h.DB.Unscoped().Model(&models.Voucher{}).Where("UPPER(code) = ?", voucher.Code).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Kode voucher sudah digunakan"})
+		return
+	}
+
+	if err := h.DB.Create(&voucher).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menyimpan voucher: " + err.Error()})
+		return
+	}
+
+	logActivity(c, h.DB, "Tambah Voucher", voucher.Code, "Admin membuat voucher baru")
+	c.JSON(http.StatusCreated, voucher)
+}
+
+func (h *VoucherHandler) Update(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID voucher tidak valid"})
+		return
+	}
+
+	var input VoucherInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid: " + err.Error()})
+		return
+	}
+	if msg := input.validate(); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	var voucher models.Voucher
+	if err := h.DB.First(&voucher, "id = ?", id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Voucher tidak ditemukan"})
+		return
+	}
+
+	input.apply(&voucher)
+
+	var count int64
+	h.DB.Unscoped().Model(&models.Voucher{}).Where("UPPER(code) = ? AND id <> ?", voucher.Code, id).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Kode voucher sudah digunakan"})
+		return
+	}
+
+	if err := h.DB.Save(&voucher).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memperbarui voucher: " + err.Error()})
+		return
+	}
+
+	logActivity(c, h.DB, "Update Voucher", voucher.Code, "Admin memperbarui voucher")
+	c.JSON(http.StatusOK, voucher)
+}
+
+// Delete removes a voucher. Its redemptions are kept so past sessions still
+// show where their discount came from.
+func (h *VoucherHandler) Delete(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID voucher tidak valid"})
+		return
+	}
+
+	result := h.DB.Delete(&models.Voucher{}, "id = ?", id)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghapus voucher"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Voucher tidak ditemukan"})
+		return
+	}
+
+	logActivity(c, h.DB, "Hapus Voucher", id.String(), "Admin menghapus voucher")
+	c.JSON(http.StatusOK, gin.H{"message": "Voucher berhasil dihapus"})
+}
@@ -1,11 +1,19 @@
 package handlers
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/Julianarwansah/sistemcharging/backend/internal/gateway"
 	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
 	mqttclient "github.com/Julianarwansah/sistemcharging/backend/internal/mqtt"
+	"github.com/Julianarwansah/sistemcharging/backend/internal/services"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
@@ -14,6 +22,11 @@ import (
 type WalletHandler struct {
 	DB  *gorm.DB
 	Hub *mqttclient.WebSocketHub
+	// Payments picks the provider taking a top-up's payment method
+	Payments      *gateway.Registry
+	PaymentExpiry time.Duration
+	// TransferLimits bounds wallet-to-wallet transfers
+	TransferLimits services.TransferLimits
 }
 
 func (h *WalletHandler) GetBalance(c *gin.Context) {
@@ -28,7 +41,140 @@ func (h *WalletHandler) GetBalance(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"balance": user.Balance})
 }
 
-func (h *WalletHandler) broadcastBalance(userID uuid.UUID, balance float64) {
+const (
+	defaultTransactionPageSize = 20
+	maxTransactionPageSize     = 100
+)
+
+// encodeTransactionCursor builds the opaque cursor pointing after the given
+// entry in newest-first order.
+func encodeTransactionCursor(t models.WalletTransaction) string {
+	raw := t.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + t.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeTransactionCursor(cursor string) (time.Time, uuid.UUID, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, uuid.Nil, err
+	}
+	at, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return time.Time{}, uuid.Nil, errors.New("invalid cursor")
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, at)
+	if err != nil {
+		return time.Time{}, uuid.Nil, err
+	}
+	txID, err := uuid.Parse(id)
+	if err != nil {
+		return time.Time{}, uuid.Nil, err
+	}
+	return createdAt, txID, nil
+}
+
+// parseDateParam accepts a date (YYYY-MM-DD, in the system timezone) or an
+// RFC3339 timestamp. endOfDay moves a plain date to the start of the next day
+// so that the whole day is included.
+func parseDateParam(value string, loc *time.Location, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, loc)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// Transactions returns the user's wallet statement, newest first, with the
+// balance after each entry. Supports ?type=topup,deduction,refund,promo,
+// ?from= and ?to= (date or RFC3339), ?limit= and ?cursor= from next_cursor.
+func (h *WalletHandler) Transactions(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	limit := defaultTransactionPageSize
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Parameter limit tidak valid"})
+			return
+		}
+		limit = min(n, maxTransactionPageSize)
+	}
+
+	// Fleet sessions are paid from the organization's wallet, not this one
+	query := h.DB.Model(&models.WalletTransaction{}).Where("user_id = ? AND organization_id IS NULL", userID)
+
+	if v := c.Query("type"); v != "" {
+		var types []models.TransactionType
+		for _, t := range strings.Split(v, ",") {
+			switch tt := models.TransactionType(strings.TrimSpace(t)); tt {
+			case models.TransactionTopUp, models.TransactionAutoTopUp, models.TransactionDeduction, models.TransactionRefund, models.TransactionPromo,
+				models.TransactionTransferOut, models.TransactionTransferIn:
+				types = append(types, tt)
+			default:
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Tipe transaksi tidak valid: " + t})
+				return
+			}
+		}
+		query = query.Where("transaction_type IN ?", types)
+	}
+
+	loc := services.TariffLocation(h.DB)
+	if v := c.Query("from"); v != "" {
+		from, err := parseDateParam(v, loc, false)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Parameter from tidak valid"})
+			return
+		}
+		query = query.Where("created_at >= ?", from)
+	}
+	if v := c.Query("to"); v != "" {
+		to, err := parseDateParam(v, loc, true)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Parameter to tidak valid"})
+			return
+		}
+		query = query.Where("created_at < ?", to)
+	}
+
+	if v := c.Query("cursor"); v != "" {
+		createdAt, id, err := decodeTransactionCursor(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Cursor tidak valid"})
+			return
+		}
+		query = query.Where("(created_at, id) < (?, ?)", createdAt, id)
+	}
+
+	// Fetch one extra row to know whether there is a next page
+	var transactions []models.WalletTransaction
+	if err := query.Preload("Session.Connector.Station").
+		Order("created_at desc, id desc").
+		Limit(limit + 1).
+		Find(&transactions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil riwayat transaksi"})
+		return
+	}
+
+	var nextCursor *string
+	if len(transactions) > limit {
+		transactions = transactions[:limit]
+		cursor := encodeTransactionCursor(transactions[limit-1])
+		nextCursor = &cursor
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"transactions": transactions,
+		"next_cursor":  nextCursor,
+	})
+}
+
+func (h *WalletHandler) broadcastBalance(userID uuid.UUID, balance models.Money) {
 	data, _ := json.Marshal(map[string]interface{}{
 		"type":    "balance_update",
 		"balance": balance,
@@ -37,12 +183,16 @@ func (h *WalletHandler) broadcastBalance(userID uuid.UUID, balance float64) {
 	h.Hub.Broadcast("admin", data) // Also notify admin for list updates
 }
 
-// TopUp (Mock for development)
+// TopUp starts a wallet top-up through the payment provider of the chosen
+// method. It only creates a pending payment and returns the payment page,
+// virtual account or e-wallet link; the wallet is credited once the provider
+// confirms the payment on the callback.
 func (h *WalletHandler) TopUp(c *gin.Context) {
 	userID := c.MustGet("user_id").(uuid.UUID)
 
 	var input struct {
-		Amount float64 `json:"amount" binding:"required,gt=0"`
+		Amount models.Money `json:"amount" binding:"required,gt=0"`
+		Method string       `json:"method"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -50,44 +200,200 @@ func (h *WalletHandler) TopUp(c *gin.Context) {
 		return
 	}
 
-	err := h.DB.Transaction(func(tx *gorm.DB) error {
-		// 1. Update user balance
-		if err := tx.Model(&models.User{}).Where("id = ?", userID).Update("balance", gorm.Expr("balance + ?", input.Amount)).Error; err != nil {
-			return err
-		}
+	provider, method, err := h.Payments.ForMethod(input.Method)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Metode pembayaran tidak tersedia",
+			"methods": h.Payments.Methods(),
+		})
+		return
+	}
+	if input.Amount.Minor()%100 != 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nominal top up harus dalam rupiah bulat"})
+		return
+	}
 
-		// 2. Create transaction record
-		transaction := models.WalletTransaction{
-			UserID:          userID,
-			Amount:          input.Amount,
-			TransactionType: models.TransactionTopUp,
-			Description:     "Top up saldo",
-		}
-		if err := tx.Create(&transaction).Error; err != nil {
-			return err
-		}
+	var user models.User
+	if err := h.DB.First(&user, "id = ?", userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User tidak ditemukan"})
+		return
+	}
 
-		return nil
+	payment := models.Payment{
+		UserID:         userID,
+		Purpose:        models.PurposeTopUp,
+		PaymentMethod:  method,
+		PaymentGateway: provider.Name(),
+		Amount:         input.Amount,
+		Status:         models.PaymentPending,
+	}
+	if err := h.DB.Create(&payment).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal membuat pembayaran"})
+		return
+	}
+
+	charge, err := provider.CreateCharge(c.Request.Context(), gateway.ChargeRequest{
+		OrderID:     payment.ID.String(),
+		Amount:      payment.Amount,
+		Method:      method,
+		Description: "Top up saldo SistemCharging",
+		Customer:    gateway.Customer{Name: user.Name, Email: user.Email, Phone: user.Phone},
+		Expiry:      h.PaymentExpiry,
+	})
+	if err != nil {
+		log.Printf("⚠️  %s charge for payment %s failed: %v", provider.Name(), payment.ID, err)
+		h.DB.Model(&payment).Update("status", models.PaymentFailed)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Gagal menghubungi payment gateway"})
+		return
+	}
+
+	payment.ExternalID = charge.Reference
+	payment.PaymentURL = charge.RedirectURL
+	payment.VABank = charge.Bank
+	payment.VANumber = charge.VANumber
+	payment.ExpiresAt = charge.ExpiresAt
+	h.DB.Model(&payment).Updates(map[string]interface{}{
+		"external_id": payment.ExternalID,
+		"payment_url": payment.PaymentURL,
+		"va_bank":     payment.VABank,
+		"va_number":   payment.VANumber,
+		"expires_at":  payment.ExpiresAt,
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Silakan selesaikan pembayaran untuk menambah saldo",
+		"payment": payment,
+		"charge":  charge,
 	})
+}
+
+// Redeem credits a credit voucher to the user's wallet
+func (h *WalletHandler) Redeem(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	var input struct {
+		Code string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid"})
+		return
+	}
 
+	var redemption *models.VoucherRedemption
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		redemption, err = services.RedeemVoucherToWallet(tx, input.Code, userID, time.Now())
+		return err
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal melakukan top up"})
+		switch {
+		case errors.Is(err, services.ErrVoucherNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrVoucherInactive), errors.Is(err, services.ErrVoucherExhausted),
+			errors.Is(err, services.ErrVoucherUserLimit), errors.Is(err, services.ErrVoucherWrongUsage),
+			errors.Is(err, services.ErrVoucherZeroBalance):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menukarkan voucher"})
+		}
 		return
 	}
 
-	// Fetch final balance for broadcast
 	var user models.User
 	h.DB.Select("balance").First(&user, "id = ?", userID)
 	h.broadcastBalance(userID, user.Balance)
 
-	c.JSON(http.StatusOK, gin.H{"message": "Top up berhasil"})
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Voucher berhasil ditukarkan",
+		"amount":  redemption.Amount,
+		"balance": user.Balance,
+	})
+}
+
+// Transfer moves balance to another user's wallet, found by email or phone.
+func (h *WalletHandler) Transfer(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	var input struct {
+		Email  string       `json:"email" binding:"omitempty,email"`
+		Phone  string       `json:"phone"`
+		Amount models.Money `json:"amount" binding:"required,gt=0"`
+		Note   string       `json:"note" binding:"max=100"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid"})
+		return
+	}
+	if (input.Email == "") == (input.Phone == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Isi salah satu: email atau phone penerima"})
+		return
+	}
+
+	var recipients []models.User
+	query := h.DB.Select("id", "name").Limit(2)
+	if input.Email != "" {
+		query = query.Where("email = ?", input.Email)
+	} else {
+		query = query.Where("phone = ?", input.Phone)
+	}
+	if err := query.Find(&recipients).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mencari penerima"})
+		return
+	}
+	switch len(recipients) {
+	case 0:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Penerima tidak ditemukan"})
+		return
+	case 2:
+		c.JSON(http.StatusConflict, gin.H{"error": "Nomor telepon terdaftar di lebih dari satu akun, gunakan email penerima"})
+		return
+	}
+	recipient := recipients[0]
+
+	var transfer *services.WalletTransfer
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		transfer, err = services.TransferBalance(tx, userID, recipient.ID, input.Amount, input.Note, h.TransferLimits, time.Now())
+		return err
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrTransferBlocked):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrTransferInsufficient):
+			c.JSON(http.StatusPaymentRequired, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrTransferBelowMin), errors.Is(err, services.ErrTransferAboveMax),
+			errors.Is(err, services.ErrTransferDailyLimit):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "limits": h.TransferLimits})
+		case errors.Is(err, services.ErrTransferInvalid), errors.Is(err, services.ErrTransferSelf),
+			errors.Is(err, services.ErrTransferRecipient):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mentransfer saldo"})
+		}
+		return
+	}
+
+	h.broadcastBalance(userID, *transfer.Sender.BalanceAfter)
+	h.broadcastBalance(recipient.ID, *transfer.Recipient.BalanceAfter)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Transfer saldo berhasil",
+		"transfer_id": transfer.ID,
+		"amount":      transfer.Amount,
+		"recipient":   gin.H{"id": recipient.ID, "name": recipient.Name},
+		"transaction": transfer.Sender,
+		"balance":     transfer.Sender.BalanceAfter,
+	})
 }
 
 // AdminTopUp (For testing in admin panel)
 func (h *WalletHandler) AdminTopUp(c *gin.Context) {
 	var input struct {
-		UserID string  `json:"user_id" binding:"required"`
-		Amount float64 `json:"amount" binding:"required,gt=0"`
+		UserID string       `json:"user_id" binding:"required"`
+		Amount models.Money `json:"amount" binding:"required,gt=0"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -102,21 +408,11 @@ func (h *WalletHandler) AdminTopUp(c *gin.Context) {
 	}
 
 	err = h.DB.Transaction(func(tx *gorm.DB) error {
-		if err := tx.Model(&models.User{}).Where("id = ?", targetUserID).Update("balance", gorm.Expr("balance + ?", input.Amount)).Error; err != nil {
-			return err
-		}
-
-		transaction := models.WalletTransaction{
-			UserID:          targetUserID,
-			Amount:          input.Amount,
-			TransactionType: models.TransactionTopUp,
-			Description:     "Top up saldo oleh Admin",
-		}
-		if err := tx.Create(&transaction).Error; err != nil {
-			return err
-		}
-
-		return nil
+		// Admin credit is not backed by a payment, so it is booked against
+		// the adjustments account instead of cash
+		_, err := services.CreditWallet(tx, targetUserID, input.Amount, services.AccountAdjustments,
+			models.LedgerAdminTopUp, models.TransactionTopUp, "", "Top up saldo oleh Admin")
+		return err
 	})
 
 	if err != nil {
@@ -19,6 +19,22 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
+// readUntilClosed discards what the client sends, which also answers its
+// pings and close frames, and closes the returned channel once the
+// connection is closed or broken.
+func readUntilClosed(conn *websocket.Conn) <-chan struct{} {
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+	return closed
+}
+
 func (h *WebSocketHandler) HandleTopic(c *gin.Context) {
 	topic := c.Param("topic")
 	if len(topic) > 0 && topic[0] == '/' {
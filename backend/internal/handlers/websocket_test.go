@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestReadUntilClosed(t *testing.T) {
+	result := make(chan bool, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			result <- false
+			return
+		}
+		defer conn.Close()
+
+		select {
+		case <-readUntilClosed(conn):
+			result <- true
+		case <-time.After(5 * time.Second):
+			result <- false
+		}
+	}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Messages from the viewer are ignored, only the disconnect counts
+	if err := conn.WriteMessage(websocket.TextMessage, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	if !<-result {
+		t.Error("readUntilClosed() did not report the closed connection")
+	}
+}
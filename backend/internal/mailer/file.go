@@ -0,0 +1,37 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var _ Mailer = (*File)(nil)
+
+// File writes each message as an .eml file into a directory instead of
+// sending it, for development and testing.
+type File struct {
+	dir  string
+	from string
+}
+
+func NewFile(dir, from string) *File {
+	return &File{dir: dir, from: from}
+}
+
+func (f *File) Name() string { return "file" }
+
+func (f *File) Send(ctx context.Context, msg Message) error {
+	now := time.Now()
+	data, err := msg.Encode(f.from, now)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(f.dir, 0o755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%d.eml", now.Format("20060102-150405"), now.Nanosecond())
+	return os.WriteFile(filepath.Join(f.dir, name), data, 0o644)
+}
@@ -0,0 +1,82 @@
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"time"
+)
+
+var _ Mailer = (*SMTP)(nil)
+
+// SMTP sends messages through a mail server, authenticating with PLAIN when
+// a username is set. The connection is upgraded with STARTTLS when the
+// server offers it; servers that do not, such as local test stubs, are
+// only accepted without authentication or on localhost.
+type SMTP struct {
+	addr     string
+	username string
+	password string
+	from     string
+}
+
+func NewSMTP(addr, username, password, from string) *SMTP {
+	return &SMTP{addr: addr, username: username, password: password, from: from}
+}
+
+func (s *SMTP) Name() string { return "smtp" }
+
+func (s *SMTP) Send(ctx context.Context, msg Message) error {
+	data, err := msg.Encode(s.from, time.Now())
+	if err != nil {
+		return err
+	}
+	sender, _ := mail.ParseAddress(s.from)
+	to, _ := mail.ParseAddress(msg.To)
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	host, _, _ := net.SplitHostPort(s.addr)
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if s.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.username, s.password, host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(sender.Address); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to.Address); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
@@ -0,0 +1,156 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const IdempotencyHeader = "Idempotency-Key"
+
+// idempotencyLockTimeout is how long a key stays reserved for a request that
+// never finished, e.g. because the server restarted while handling it.
+const idempotencyLockTimeout = 5 * time.Minute
+
+// responseRecorder keeps a copy of the response body for storing it with
+// the idempotency key.
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Idempotency makes a route safe to retry. Requests carrying an
+// Idempotency-Key header are handled once; repeats with the same key and
+// body within the retention window get the stored response replayed, and a
+// key reused for a different request is rejected. Requests without the
+// header are handled as before. Server errors are not stored, so the client
+// can retry them with the same key.
+func Idempotency(db *gorm.DB, retention time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > 255 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key terlalu panjang (maksimal 255 karakter)"})
+			c.Abort()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Gagal membaca request"})
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		scope := "public"
+		if userID, exists := c.Get("user_id"); exists {
+			scope = userID.(uuid.UUID).String()
+		}
+		hash := sha256.Sum256([]byte(c.Request.Method + " " + c.Request.URL.Path + "\n" + string(body)))
+
+		now := time.Now()
+		record := models.IdempotencyKey{
+			Scope:       scope,
+			Key:         key,
+			Method:      c.Request.Method,
+			Path:        c.Request.URL.Path,
+			RequestHash: hex.EncodeToString(hash[:]),
+			ExpiresAt:   now.Add(retention),
+		}
+
+		reserved, existing, err := reserveIdempotencyKey(db, &record, now)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memproses Idempotency-Key"})
+			c.Abort()
+			return
+		}
+		if !reserved {
+			switch {
+			case existing.RequestHash != record.RequestHash:
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key sudah dipakai untuk request yang berbeda"})
+			case existing.CompletedAt == nil:
+				c.JSON(http.StatusConflict, gin.H{"error": "Request dengan Idempotency-Key ini masih diproses"})
+			default:
+				c.Header("Idempotent-Replayed", "true")
+				c.Data(existing.ResponseStatus, existing.ContentType, []byte(existing.ResponseBody))
+			}
+			c.Abort()
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		status := recorder.Status()
+		if status >= http.StatusInternalServerError {
+			db.Delete(&record)
+			return
+		}
+		completedAt := time.Now()
+		db.Model(&record).Updates(map[string]interface{}{
+			"response_status": status,
+			"response_body":   recorder.body.String(),
+			"content_type":    recorder.Header().Get("Content-Type"),
+			"completed_at":    completedAt,
+		})
+	}
+}
+
+// reserveIdempotencyKey stores a new key for the request about to run. When
+// the key is already taken it returns the existing record instead, after
+// clearing it if it expired or was abandoned mid-request.
+func reserveIdempotencyKey(db *gorm.DB, record *models.IdempotencyKey, now time.Time) (bool, *models.IdempotencyKey, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(record)
+		if result.Error != nil {
+			return false, nil, result.Error
+		}
+		if result.RowsAffected == 1 {
+			return true, nil, nil
+		}
+
+		var existing models.IdempotencyKey
+		err := db.First(&existing, "scope = ? AND key = ?", record.Scope, record.Key).Error
+		if err == gorm.ErrRecordNotFound {
+			continue // Removed in between, try again
+		}
+		if err != nil {
+			return false, nil, err
+		}
+
+		stale := existing.ExpiresAt.Before(now) ||
+			(existing.CompletedAt == nil && existing.CreatedAt.Add(idempotencyLockTimeout).Before(now))
+		if !stale {
+			return false, &existing, nil
+		}
+		if err := db.Where("id = ?", existing.ID).Delete(&models.IdempotencyKey{}).Error; err != nil {
+			return false, nil, err
+		}
+		record.ID = uuid.Nil
+	}
+	return false, nil, gorm.ErrDuplicatedKey
+}
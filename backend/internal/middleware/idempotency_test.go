@@ -0,0 +1,200 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const topUpPath = "/wallet/topup"
+
+var idempotencyColumns = []string{
+	"id", "scope", "key", "method", "path", "request_hash",
+	"response_status", "response_body", "content_type", "completed_at", "expires_at", "created_at",
+}
+
+func newMockDB(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	t.Helper()
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{
+		SkipDefaultTransaction: true,
+		Logger:                 logger.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, mock
+}
+
+func requestHash(body string) string {
+	hash := sha256.Sum256([]byte(http.MethodPost + " " + topUpPath + "\n" + body))
+	return hex.EncodeToString(hash[:])
+}
+
+// storedKey returns a row of an idempotency key taken earlier for body.
+func storedKey(body string, completed bool, createdAt, expiresAt time.Time) *sqlmock.Rows {
+	var completedAt interface{}
+	if completed {
+		completedAt = createdAt.Add(time.Second)
+	}
+	return sqlmock.NewRows(idempotencyColumns).AddRow(
+		uuid.New(), "public", "key-1", http.MethodPost, topUpPath, requestHash(body),
+		http.StatusCreated, `{"balance":"15000.00"}`, "application/json; charset=utf-8", completedAt, expiresAt, createdAt,
+	)
+}
+
+func TestIdempotency(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	now := time.Now()
+	const body = `{"amount":5000}`
+
+	insertKey := `INSERT INTO "idempotency_keys" .* ON CONFLICT DO NOTHING`
+	selectKey := `SELECT \* FROM "idempotency_keys" WHERE scope = \$1 AND key = \$2`
+
+	tests := []struct {
+		name         string
+		key          string
+		body         string
+		handlerCode  int
+		expect       func(mock sqlmock.Sqlmock)
+		wantStatus   int
+		wantHandled  bool
+		wantReplayed bool
+		wantBody     string
+	}{
+		{
+			name: "no key",
+			body: body, handlerCode: http.StatusCreated,
+			expect:     func(mock sqlmock.Sqlmock) {},
+			wantStatus: http.StatusCreated, wantHandled: true,
+		},
+		{
+			name: "key too long",
+			key:  strings.Repeat("k", 256), body: body,
+			expect:     func(mock sqlmock.Sqlmock) {},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "first request is handled and stored",
+			key:  "key-1", body: body, handlerCode: http.StatusCreated,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(insertKey).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE "idempotency_keys" SET .*"response_status"=`).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			wantStatus: http.StatusCreated, wantHandled: true,
+		},
+		{
+			name: "repeat gets the stored response",
+			key:  "key-1", body: body,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(insertKey).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(selectKey).WillReturnRows(storedKey(body, true, now.Add(-time.Minute), now.Add(time.Hour)))
+			},
+			wantStatus: http.StatusCreated, wantReplayed: true, wantBody: `{"balance":"15000.00"}`,
+		},
+		{
+			name: "key reused for a different body",
+			key:  "key-1", body: `{"amount":9000}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(insertKey).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(selectKey).WillReturnRows(storedKey(body, true, now.Add(-time.Minute), now.Add(time.Hour)))
+			},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "repeat while the first request is still running",
+			key:  "key-1", body: body,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(insertKey).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(selectKey).WillReturnRows(storedKey(body, false, now.Add(-time.Minute), now.Add(time.Hour)))
+			},
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name: "abandoned request is taken over",
+			key:  "key-1", body: body, handlerCode: http.StatusCreated,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(insertKey).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(selectKey).WillReturnRows(storedKey(body, false, now.Add(-idempotencyLockTimeout-time.Minute), now.Add(time.Hour)))
+				mock.ExpectExec(`DELETE FROM "idempotency_keys" WHERE id = \$1`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(insertKey).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE "idempotency_keys"`).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			wantStatus: http.StatusCreated, wantHandled: true,
+		},
+		{
+			name: "expired key is reused for a different body",
+			key:  "key-1", body: `{"amount":9000}`, handlerCode: http.StatusCreated,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(insertKey).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(selectKey).WillReturnRows(storedKey(body, true, now.Add(-2*time.Hour), now.Add(-time.Hour)))
+				mock.ExpectExec(`DELETE FROM "idempotency_keys" WHERE id = \$1`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(insertKey).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE "idempotency_keys"`).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			wantStatus: http.StatusCreated, wantHandled: true,
+		},
+		{
+			name: "server error releases the key",
+			key:  "key-1", body: body, handlerCode: http.StatusInternalServerError,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(insertKey).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`DELETE FROM "idempotency_keys" WHERE "idempotency_keys"."id" = \$1`).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			wantStatus: http.StatusInternalServerError, wantHandled: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newMockDB(t)
+			tt.expect(mock)
+
+			handled := false
+			router := gin.New()
+			router.POST(topUpPath, Idempotency(db, 24*time.Hour), func(c *gin.Context) {
+				handled = true
+				c.JSON(tt.handlerCode, gin.H{"balance": "15000.00"})
+			})
+
+			req := httptest.NewRequest(http.MethodPost, topUpPath, strings.NewReader(tt.body))
+			if tt.key != "" {
+				req.Header.Set(IdempotencyHeader, tt.key)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d (body %s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if handled != tt.wantHandled {
+				t.Errorf("handler called = %v, want %v", handled, tt.wantHandled)
+			}
+			if replayed := w.Header().Get("Idempotent-Replayed") == "true"; replayed != tt.wantReplayed {
+				t.Errorf("replayed = %v, want %v", replayed, tt.wantReplayed)
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("body = %s, want %s", w.Body.String(), tt.wantBody)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
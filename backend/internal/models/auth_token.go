@@ -0,0 +1,63 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type AuthTokenType string
+
+const (
+	TokenRFID     AuthTokenType = "rfid"     // Card UID read by the charger
+	TokenVirtual  AuthTokenType = "virtual"  // Issued by the platform, e.g. for a QR code or partner app
+	TokenContract AuthTokenType = "contract" // Plug-and-charge contract ID (EMAID) sent by the vehicle
+)
+
+// AuthToken lets a charger start a session without the app. Sessions are
+// billed to the user the token is issued to, or for fleet tokens to the
+// organization, with the user as the driver.
+type AuthToken struct {
+	ID             uuid.UUID     `gorm:"type:uuid;primaryKey" json:"id"`
+	Type           AuthTokenType `gorm:"size:20;not null" json:"type"`
+	UID            string        `gorm:"size:100;not null;uniqueIndex" json:"uid"`
+	Label          string        `gorm:"size:100" json:"label"`
+	UserID         uuid.UUID     `gorm:"type:uuid;not null;index" json:"user_id"`
+	OrganizationID *uuid.UUID    `gorm:"type:uuid;index" json:"organization_id,omitempty"`
+	Blocked        bool          `gorm:"default:false" json:"blocked"`
+	ExpiresAt      *time.Time    `json:"expires_at"`
+	LastUsedAt     *time.Time    `json:"last_used_at"`
+	CreatedAt      time.Time     `json:"created_at"`
+	UpdatedAt      time.Time     `json:"updated_at"`
+
+	User         *User         `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	Organization *Organization `gorm:"foreignKey:OrganizationID" json:"organization,omitempty"`
+}
+
+func (t *AuthToken) BeforeCreate(tx *gorm.DB) error {
+	if t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
+	return nil
+}
+
+// NormalizeTokenUID folds the ways chargers and users write a token, e.g.
+// "04:a1:b2:c3" and "04A1B2C3", into one.
+func NormalizeTokenUID(uid string) string {
+	return strings.NewReplacer(" ", "", ":", "").Replace(strings.ToUpper(strings.TrimSpace(uid)))
+}
+
+// AuthorizationStatus is the answer to a charger's authorize request.
+type AuthorizationStatus string
+
+const (
+	AuthAccepted     AuthorizationStatus = "accepted"
+	AuthInvalid      AuthorizationStatus = "invalid" // Unknown token
+	AuthBlocked      AuthorizationStatus = "blocked"
+	AuthExpired      AuthorizationStatus = "expired"
+	AuthNoCredit     AuthorizationStatus = "no_credit"
+	AuthConcurrentTx AuthorizationStatus = "concurrent_tx" // The owner already has an active session
+	AuthUnavailable  AuthorizationStatus = "unavailable"   // Connector is not available
+)
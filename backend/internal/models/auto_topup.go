@@ -0,0 +1,57 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// SavedPaymentMethod is a payment method the user saved at a provider, such
+// as a tokenized card or a linked e-wallet, which can be charged without
+// them present. Token is the provider's reference to it.
+type SavedPaymentMethod struct {
+	ID        uuid.UUID      `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID    uuid.UUID      `gorm:"type:uuid;not null;index" json:"user_id"`
+	Provider  string         `gorm:"size:50;not null" json:"provider"`
+	Method    string         `gorm:"size:50;not null" json:"method"` // e.g. card, ovo
+	Token     string         `gorm:"size:255;not null" json:"-"`
+	Label     string         `gorm:"size:100" json:"label"` // e.g. "VISA •••• 4242"
+	CreatedAt time.Time      `json:"created_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+func (m *SavedPaymentMethod) BeforeCreate(tx *gorm.DB) error {
+	if m.ID == uuid.Nil {
+		m.ID = uuid.New()
+	}
+	return nil
+}
+
+// AutoTopUp tops up a user's wallet by Amount from a saved payment method
+// whenever the balance falls below Threshold, up to MonthlyCap per calendar
+// month. It is switched off after repeated failed charges.
+type AutoTopUp struct {
+	ID              uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID          uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex" json:"user_id"`
+	Enabled         bool       `gorm:"default:false" json:"enabled"`
+	Threshold       Money      `gorm:"type:bigint;not null" json:"threshold"`
+	Amount          Money      `gorm:"type:bigint;not null" json:"amount"`
+	MonthlyCap      Money      `gorm:"type:bigint;not null" json:"monthly_cap"`
+	PaymentMethodID *uuid.UUID `gorm:"type:uuid" json:"payment_method_id"`
+	FailureCount    int        `gorm:"default:0" json:"failure_count"` // Consecutive failed charges
+	LastError       string     `gorm:"size:255" json:"last_error,omitempty"`
+	LastFailedAt    *time.Time `json:"last_failed_at,omitempty"`
+	CapReachedAt    *time.Time `json:"cap_reached_at,omitempty"` // When the user was last told the cap was reached
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+
+	PaymentMethod *SavedPaymentMethod `gorm:"foreignKey:PaymentMethodID" json:"payment_method,omitempty"`
+}
+
+func (a *AutoTopUp) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	return nil
+}
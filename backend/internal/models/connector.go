@@ -12,6 +12,7 @@ type ConnectorStatus string
 const (
 	ConnectorAvailable ConnectorStatus = "available"
 	ConnectorInUse     ConnectorStatus = "in_use"
+	ConnectorReserved  ConnectorStatus = "reserved" // Held for a scheduled session
 	ConnectorFault     ConnectorStatus = "fault"
 	ConnectorOffline   ConnectorStatus = "offline"
 )
@@ -21,15 +22,18 @@ type Connector struct {
 	StationID      uuid.UUID       `gorm:"type:uuid;not null;index" json:"station_id"`
 	ConnectorType  string          `gorm:"size:50;not null" json:"connector_type"`  // Type2, CCS, CHAdeMO, etc.
 	PowerKW        float64         `gorm:"type:decimal(6,2);not null" json:"power_kw"`
-	PricePerKWH    float64         `gorm:"type:decimal(10,2);not null" json:"price_per_kwh"`
+	PricePerKWH    Money           `gorm:"type:bigint;not null" json:"price_per_kwh"` // Flat price used when no tariff is assigned
+	TariffID       *uuid.UUID      `gorm:"type:uuid;index" json:"tariff_id"`
 	Status         ConnectorStatus `gorm:"size:20;default:'available'" json:"status"`
 	MQTTTopic      string          `gorm:"size:200;not null" json:"mqtt_topic"`
+	IdleFee        IdleFeePolicy   `gorm:"embedded;embeddedPrefix:idle_" json:"idle_fee"` // Overrides the station policy when enabled
 	CreatedAt      time.Time       `json:"created_at"`
 	UpdatedAt      time.Time       `json:"updated_at"`
 	DeletedAt      gorm.DeletedAt  `gorm:"index" json:"-"`
 
 	Station  Station           `gorm:"foreignKey:StationID" json:"station,omitempty"`
 	Sessions []ChargingSession `gorm:"foreignKey:ConnectorID" json:"sessions,omitempty"`
+	Tariff   *Tariff           `gorm:"foreignKey:TariffID" json:"tariff,omitempty"`
 }
 
 func (c *Connector) BeforeCreate(tx *gorm.DB) error {
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// IdempotencyKey remembers the response to a request sent with an
+// Idempotency-Key header so retries of the same request get the same answer
+// instead of repeating its side effects. Keys are scoped per user.
+type IdempotencyKey struct {
+	ID             uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	Scope          string     `gorm:"size:100;not null;uniqueIndex:idx_idempotency_scope_key" json:"scope"` // User ID, or "public" for unauthenticated routes
+	Key            string     `gorm:"size:255;not null;uniqueIndex:idx_idempotency_scope_key" json:"key"`
+	Method         string     `gorm:"size:10;not null" json:"method"`
+	Path           string     `gorm:"size:255;not null" json:"path"`
+	RequestHash    string     `gorm:"size:64;not null" json:"request_hash"` // SHA-256 of method, path and body
+	ResponseStatus int        `json:"response_status"`
+	ResponseBody   string     `gorm:"type:text" json:"response_body"`
+	ContentType    string     `gorm:"size:100" json:"content_type"`
+	CompletedAt    *time.Time `json:"completed_at"` // Unset while the original request is still running
+	ExpiresAt      time.Time  `gorm:"index;not null" json:"expires_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+func (k *IdempotencyKey) BeforeCreate(tx *gorm.DB) error {
+	if k.ID == uuid.Nil {
+		k.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"math"
+	"time"
+)
+
+// IdleFeePolicy describes the overstay fee charged while a vehicle stays
+// plugged in after charging has completed.
+type IdleFeePolicy struct {
+	GraceMinutes int   `gorm:"default:0" json:"grace_minutes"`
+	FeePerMinute Money `gorm:"type:bigint;default:0" json:"fee_per_minute"`
+	MaxFee       Money `gorm:"type:bigint;default:0" json:"max_fee"` // 0 = no cap
+}
+
+func (p IdleFeePolicy) Enabled() bool {
+	return p.FeePerMinute > 0
+}
+
+// BillableMinutes returns the idle minutes left after the grace period,
+// rounded up to the next started minute.
+func (p IdleFeePolicy) BillableMinutes(idle time.Duration) int {
+	billable := idle - time.Duration(p.GraceMinutes)*time.Minute
+	if billable <= 0 {
+		return 0
+	}
+	return int(math.Ceil(billable.Minutes()))
+}
+
+// Fee computes the idle fee for the given idle duration, honouring the cap.
+func (p IdleFeePolicy) Fee(idle time.Duration) Money {
+	if !p.Enabled() {
+		return 0
+	}
+	fee := p.FeePerMinute * Money(p.BillableMinutes(idle))
+	if p.MaxFee > 0 && fee > p.MaxFee {
+		fee = p.MaxFee
+	}
+	return fee
+}
+
+// EffectiveIdleFee returns the connector policy if it is enabled, otherwise
+// the station policy.
+func EffectiveIdleFee(connector Connector, station Station) IdleFeePolicy {
+	if connector.IdleFee.Enabled() {
+		return connector.IdleFee
+	}
+	return station.IdleFee
+}
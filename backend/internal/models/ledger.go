@@ -0,0 +1,118 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var ErrLedgerImmutable = errors.New("ledger entries cannot be changed, post a reversal instead")
+
+type LedgerAccountType string
+
+const (
+	LedgerAsset     LedgerAccountType = "asset"
+	LedgerLiability LedgerAccountType = "liability"
+	LedgerEquity    LedgerAccountType = "equity"
+	LedgerRevenue   LedgerAccountType = "revenue"
+	LedgerExpense   LedgerAccountType = "expense"
+)
+
+// DebitNormal reports whether debits increase accounts of this type.
+func (t LedgerAccountType) DebitNormal() bool {
+	return t == LedgerAsset || t == LedgerExpense
+}
+
+// LedgerAccount is an account of the double-entry ledger. Balance is a cache
+// of the account's entries, kept in the account's normal direction, and is
+// only changed together with a posted entry.
+type LedgerAccount struct {
+	ID             uuid.UUID         `gorm:"type:uuid;primaryKey" json:"id"`
+	Code           string            `gorm:"size:100;uniqueIndex;not null" json:"code"`
+	Name           string            `gorm:"size:100;not null" json:"name"`
+	Type           LedgerAccountType `gorm:"size:20;not null" json:"type"`
+	UserID         *uuid.UUID        `gorm:"type:uuid;uniqueIndex" json:"user_id,omitempty"`         // Set for user wallet accounts
+	OrganizationID *uuid.UUID        `gorm:"type:uuid;uniqueIndex" json:"organization_id,omitempty"` // Set for organization wallet accounts
+	Balance        Money             `gorm:"type:bigint;default:0" json:"balance"`
+	CreatedAt      time.Time         `json:"created_at"`
+	UpdatedAt      time.Time         `json:"updated_at"`
+}
+
+type LedgerTransactionKind string
+
+const (
+	LedgerTopUp      LedgerTransactionKind = "topup"
+	LedgerAdminTopUp LedgerTransactionKind = "admin_topup"
+	LedgerCharge     LedgerTransactionKind = "charge"
+	LedgerPromo      LedgerTransactionKind = "promo"
+	LedgerRefund     LedgerTransactionKind = "refund"
+	LedgerTransfer   LedgerTransactionKind = "transfer"
+	LedgerOrgTopUp   LedgerTransactionKind = "org_topup"       // Organization deposit received by bank transfer
+	LedgerInvoice    LedgerTransactionKind = "invoice_payment" // Postpaid invoice paid by bank transfer
+	LedgerReset      LedgerTransactionKind = "reset"
+	LedgerOpening    LedgerTransactionKind = "opening" // Balances that existed before the ledger
+)
+
+// LedgerTransaction groups balanced entries posted together. Transactions
+// and entries are append-only; mistakes are corrected by posting a reversal.
+type LedgerTransaction struct {
+	ID          uuid.UUID             `gorm:"type:uuid;primaryKey" json:"id"`
+	Kind        LedgerTransactionKind `gorm:"size:30;not null;index" json:"kind"`
+	ReferenceID string                `gorm:"size:100;index" json:"reference_id"` // Session, payment or voucher redemption ID
+	Description string                `gorm:"size:255" json:"description"`
+	CreatedAt   time.Time             `json:"created_at"`
+
+	Entries []LedgerEntry `gorm:"foreignKey:TransactionID" json:"entries,omitempty"`
+}
+
+// LedgerEntry debits or credits one account. Exactly one of Debit and
+// Credit is non-zero.
+type LedgerEntry struct {
+	ID            uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	TransactionID uuid.UUID `gorm:"type:uuid;not null;index" json:"transaction_id"`
+	AccountID     uuid.UUID `gorm:"type:uuid;not null;index" json:"account_id"`
+	Debit         Money     `gorm:"type:bigint;default:0" json:"debit"`
+	Credit        Money     `gorm:"type:bigint;default:0" json:"credit"`
+	CreatedAt     time.Time `json:"created_at"`
+
+	Account LedgerAccount `gorm:"foreignKey:AccountID" json:"account,omitempty"`
+}
+
+func (a *LedgerAccount) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	return nil
+}
+
+func (t *LedgerTransaction) BeforeCreate(tx *gorm.DB) error {
+	if t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
+	return nil
+}
+
+func (t *LedgerTransaction) BeforeUpdate(tx *gorm.DB) error {
+	return ErrLedgerImmutable
+}
+
+func (t *LedgerTransaction) BeforeDelete(tx *gorm.DB) error {
+	return ErrLedgerImmutable
+}
+
+func (e *LedgerEntry) BeforeCreate(tx *gorm.DB) error {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	return nil
+}
+
+func (e *LedgerEntry) BeforeUpdate(tx *gorm.DB) error {
+	return ErrLedgerImmutable
+}
+
+func (e *LedgerEntry) BeforeDelete(tx *gorm.DB) error {
+	return ErrLedgerImmutable
+}
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type LineItemType string
+
+const (
+	LineEnergy     LineItemType = "energy"
+	LineTime       LineItemType = "time"
+	LineStartFee   LineItemType = "start_fee"
+	LineAdjustment LineItemType = "adjustment" // Tariff min/max price correction
+	LineIdle       LineItemType = "idle"
+	LineDiscount   LineItemType = "discount" // Negative amount
+	LineServiceFee LineItemType = "service_fee"
+	LineTax        LineItemType = "tax"
+)
+
+// SessionLineItem is one row of a session's bill. The amounts of all rows
+// of a session add up to its TotalCost; the session's payment is billed
+// from the same rows.
+type SessionLineItem struct {
+	ID          uuid.UUID    `gorm:"type:uuid;primaryKey" json:"id"`
+	SessionID   uuid.UUID    `gorm:"type:uuid;not null;index" json:"session_id"`
+	Position    int          `gorm:"not null" json:"position"`
+	Type        LineItemType `gorm:"size:20;not null" json:"type"`
+	Description string       `gorm:"size:255" json:"description"`
+	Quantity    float64      `gorm:"type:decimal(12,3);default:0" json:"quantity"`
+	Unit        string       `gorm:"size:10" json:"unit"`
+	Amount      Money        `gorm:"type:bigint;not null" json:"amount"`
+	CreatedAt   time.Time    `json:"created_at"`
+}
+
+func (i *SessionLineItem) BeforeCreate(tx *gorm.DB) error {
+	if i.ID == uuid.Nil {
+		i.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// LocalAuthEntry puts a token on a charger's local authorization list, so
+// the charger can still accept it while it cannot reach the backend.
+type LocalAuthEntry struct {
+	ID          uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	ConnectorID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_local_auth_entry" json:"connector_id"`
+	AuthTokenID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_local_auth_entry;index" json:"auth_token_id"`
+	CreatedAt   time.Time `json:"created_at"`
+
+	AuthToken *AuthToken `gorm:"foreignKey:AuthTokenID;constraint:OnDelete:CASCADE" json:"auth_token,omitempty"`
+}
+
+func (e *LocalAuthEntry) BeforeCreate(tx *gorm.DB) error {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	return nil
+}
+
+// LocalAuthItem is a token on a local authorization list as the charger
+// receives it.
+type LocalAuthItem struct {
+	IDTag     string     `json:"id_tag"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// LocalAuthList tracks the local authorization list of a charger: the
+// version and items last sent to it and the version it confirmed having.
+type LocalAuthList struct {
+	ConnectorID  uuid.UUID       `gorm:"type:uuid;primaryKey" json:"connector_id"`
+	Version      int             `gorm:"not null;default:0" json:"version"`
+	AckedVersion int             `gorm:"not null;default:0" json:"acked_version"`
+	Items        []LocalAuthItem `gorm:"type:jsonb;serializer:json" json:"items"`
+	AckedItems   []LocalAuthItem `gorm:"type:jsonb;serializer:json" json:"acked_items"` // Items of the last version the charger confirmed
+	SentAt       *time.Time      `json:"sent_at"`
+	AckedAt      *time.Time      `json:"acked_at"`
+	UpdatedAt    time.Time       `json:"updated_at"`
+}
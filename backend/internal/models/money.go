@@ -0,0 +1,188 @@
+package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Currency is the ISO 4217 code of every Money amount in the system.
+const Currency = "IDR"
+
+// MinorUnits is the number of decimal places of the currency; Money counts
+// 1/100 rupiah.
+const MinorUnits = 2
+
+const minorPerMajor = 100
+
+// Money is an amount in integer minor units of Currency. Adding and
+// subtracting Money is exact. Whenever a fractional amount is turned into
+// Money (prices times kWh, percentages, parsed input) it is rounded once to
+// the nearest minor unit, halves away from zero.
+//
+// Money is stored as a bigint of minor units and encoded in JSON as a
+// decimal number of major units, e.g. 2500.50, so API clients keep seeing
+// rupiah.
+type Money int64
+
+// RoundMinor rounds an amount of minor units to Money.
+func RoundMinor(minor float64) Money {
+	return Money(math.Round(minor))
+}
+
+// NewMoney converts an amount of major units to Money.
+func NewMoney(major float64) Money {
+	return RoundMinor(major * minorPerMajor)
+}
+
+// ParseMoney parses a decimal amount of major units, e.g. "2500" or
+// "2500.505". Digits beyond the minor unit are rounded.
+func ParseMoney(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, fmt.Errorf("money: empty amount")
+	}
+
+	neg := false
+	if s[0] == '-' || s[0] == '+' {
+		neg = s[0] == '-'
+		s = s[1:]
+	}
+
+	if s == "" || s[0] == '-' || s[0] == '+' {
+		return 0, fmt.Errorf("money: invalid amount %q", s)
+	}
+
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" {
+		whole = "0"
+	}
+	if strings.ContainsAny(frac, "eE") || strings.ContainsAny(whole, "eE") {
+		// Exponent notation, only reachable through JSON numbers
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, fmt.Errorf("money: invalid amount %q", s)
+		}
+		m := NewMoney(f)
+		if neg {
+			m = -m
+		}
+		return m, nil
+	}
+
+	units, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("money: invalid amount %q", s)
+	}
+	for _, r := range frac {
+		if r < '0' || r > '9' {
+			return 0, fmt.Errorf("money: invalid amount %q", s)
+		}
+	}
+
+	var minor int64
+	for i := 0; i < MinorUnits; i++ {
+		minor *= 10
+		if i < len(frac) {
+			minor += int64(frac[i] - '0')
+		}
+	}
+	if len(frac) > MinorUnits && frac[MinorUnits] >= '5' {
+		minor++
+	}
+
+	m := Money(units*minorPerMajor + minor)
+	if neg {
+		m = -m
+	}
+	return m, nil
+}
+
+// Minor returns the amount in minor units.
+func (m Money) Minor() int64 {
+	return int64(m)
+}
+
+// Major returns the amount in major units, for display and ratios only.
+func (m Money) Major() float64 {
+	return float64(m) / minorPerMajor
+}
+
+// Mul multiplies the amount by a factor such as kWh or minutes.
+func (m Money) Mul(factor float64) Money {
+	return RoundMinor(float64(m) * factor)
+}
+
+// Percent returns p percent of the amount.
+func (m Money) Percent(p float64) Money {
+	return RoundMinor(float64(m) * p / 100)
+}
+
+// String formats the amount in major units with all minor digits, e.g.
+// "-2500.50".
+func (m Money) String() string {
+	sign := ""
+	v := int64(m)
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	return fmt.Sprintf("%s%d.%0*d", sign, v/minorPerMajor, MinorUnits, v%minorPerMajor)
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON accepts a number or a numeric string in major units.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "null" {
+		return nil
+	}
+	v, err := ParseMoney(s)
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
+
+func (m Money) Value() (driver.Value, error) {
+	return int64(m), nil
+}
+
+// Scan reads a minor unit column, including SUM() results that the driver
+// returns as numeric text.
+func (m *Money) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*m = 0
+	case int64:
+		*m = Money(v)
+	case float64:
+		*m = RoundMinor(v)
+	case []byte:
+		return m.scanText(string(v))
+	case string:
+		return m.scanText(v)
+	default:
+		return fmt.Errorf("money: cannot scan %T", src)
+	}
+	return nil
+}
+
+func (m *Money) scanText(s string) error {
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		*m = Money(i)
+		return nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return fmt.Errorf("money: cannot scan %q", s)
+	}
+	*m = RoundMinor(f)
+	return nil
+}
@@ -0,0 +1,160 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Money
+		wantErr bool
+	}{
+		{in: "2500", want: 250000},
+		{in: "2500.5", want: 250050},
+		{in: "2500.50", want: 250050},
+		{in: " 2500.05 ", want: 250005},
+		{in: ".75", want: 75},
+		{in: "+10", want: 1000},
+		{in: "-10.25", want: -1025},
+		{in: "2500.504", want: 250050},
+		{in: "2500.505", want: 250051},
+		{in: "2500.995", want: 250100},
+		{in: "-2500.505", want: -250051},
+		{in: "0.004", want: 0},
+		{in: "1e3", want: 100000},
+		{in: "2.5E-1", want: 25},
+		{in: "-1.2345e2", want: -12345},
+		{in: "", wantErr: true},
+		{in: "-", wantErr: true},
+		{in: "--5", wantErr: true},
+		{in: "+-5", wantErr: true},
+		{in: "abc", wantErr: true},
+		{in: "12a", wantErr: true},
+		{in: "1.2.3", wantErr: true},
+		{in: "1.5x", wantErr: true},
+		{in: "1e", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseMoney(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseMoney(%q) = %s, want error", tt.in, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseMoney(%q) error: %v", tt.in, err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseMoney(%q) = %d minor units, want %d", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewMoney(t *testing.T) {
+	tests := []struct {
+		in   float64
+		want Money
+	}{
+		{2500, 250000},
+		{0.1 + 0.2, 30},
+		{1.005, 100}, // 1.005 is 1.00499999... as a float64
+		{-0.015, -2},
+	}
+
+	for _, tt := range tests {
+		if got := NewMoney(tt.in); got != tt.want {
+			t.Errorf("NewMoney(%v) = %d minor units, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	marshal := []struct {
+		in   Money
+		want string
+	}{
+		{0, "0.00"},
+		{5, "0.05"},
+		{250050, "2500.50"},
+		{-5, "-0.05"},
+		{-250050, "-2500.50"},
+	}
+
+	for _, tt := range marshal {
+		got, err := json.Marshal(tt.in)
+		if err != nil {
+			t.Fatalf("Marshal(%d) error: %v", tt.in, err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("Marshal(%d) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+
+	unmarshal := []struct {
+		in      string
+		want    Money
+		wantErr bool
+	}{
+		{in: `2500`, want: 250000},
+		{in: `2500.505`, want: 250051},
+		{in: `"2500.50"`, want: 250050},
+		{in: `-0.05`, want: -5},
+		{in: `1e3`, want: 100000},
+		{in: `null`, want: 0},
+		{in: `"abc"`, wantErr: true},
+		{in: `true`, wantErr: true},
+	}
+
+	for _, tt := range unmarshal {
+		var got struct {
+			Amount Money `json:"amount"`
+		}
+		err := json.Unmarshal([]byte(`{"amount":`+tt.in+`}`), &got)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Unmarshal(%s) = %s, want error", tt.in, got.Amount)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Unmarshal(%s) error: %v", tt.in, err)
+		}
+		if got.Amount != tt.want {
+			t.Errorf("Unmarshal(%s) = %d minor units, want %d", tt.in, got.Amount, tt.want)
+		}
+	}
+
+	// Round trip keeps the exact minor units
+	for _, m := range []Money{1, 99, 100, 123456789, -42} {
+		data, _ := json.Marshal(m)
+		var back Money
+		if err := json.Unmarshal(data, &back); err != nil || back != m {
+			t.Errorf("round trip of %d gave %d (%v)", m, back, err)
+		}
+	}
+}
+
+func TestMoneyPercent(t *testing.T) {
+	tests := []struct {
+		m    Money
+		p    float64
+		want Money
+	}{
+		{NewMoney(10000), 11, NewMoney(1100)},
+		{333, 50, 167},   // 166.5 rounds away from zero
+		{-333, 50, -167}, // and so does its negative
+		{NewMoney(100), 0, 0},
+	}
+
+	for _, tt := range tests {
+		if got := tt.m.Percent(tt.p); got != tt.want {
+			t.Errorf("%s.Percent(%v) = %s, want %s", tt.m, tt.p, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type OrganizationRole string
+
+const (
+	OrgRoleManager OrganizationRole = "manager" // Manages members, sees the wallet and invoices
+	OrgRoleDriver  OrganizationRole = "driver"  // Charges on the organization's account
+)
+
+// Organization is a fleet account whose members charge on a shared wallet.
+// The wallet is a ledger account that may go down to -CreditLimit, so a zero
+// limit makes it prepaid and a positive one postpaid; what was charged is
+// billed on a monthly invoice either way.
+type Organization struct {
+	ID           uuid.UUID      `gorm:"type:uuid;primaryKey" json:"id"`
+	Name         string         `gorm:"size:100;not null" json:"name"`
+	BillingEmail string         `gorm:"size:100" json:"billing_email"`
+	CreditLimit  Money          `gorm:"type:bigint;default:0" json:"credit_limit"`
+	Status       string         `gorm:"size:20;default:'active'" json:"status"` // active, suspended
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
+
+	Members []OrganizationMember `gorm:"foreignKey:OrganizationID" json:"members,omitempty"`
+}
+
+func (o *Organization) BeforeCreate(tx *gorm.DB) error {
+	if o.ID == uuid.Nil {
+		o.ID = uuid.New()
+	}
+	return nil
+}
+
+// OrganizationMember links a user to the one organization they belong to.
+// MonthlyLimit caps what the member may charge to the organization per
+// calendar month; zero means no limit.
+type OrganizationMember struct {
+	ID             uuid.UUID        `gorm:"type:uuid;primaryKey" json:"id"`
+	OrganizationID uuid.UUID        `gorm:"type:uuid;not null;index" json:"organization_id"`
+	UserID         uuid.UUID        `gorm:"type:uuid;not null;uniqueIndex" json:"user_id"`
+	Role           OrganizationRole `gorm:"size:20;not null;default:'driver'" json:"role"`
+	MonthlyLimit   Money            `gorm:"type:bigint;default:0" json:"monthly_limit"`
+	Active         bool             `gorm:"default:true" json:"active"`
+	CreatedAt      time.Time        `json:"created_at"`
+	UpdatedAt      time.Time        `json:"updated_at"`
+
+	User         *User         `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	Organization *Organization `gorm:"foreignKey:OrganizationID" json:"organization,omitempty"`
+}
+
+func (m *OrganizationMember) BeforeCreate(tx *gorm.DB) error {
+	if m.ID == uuid.Nil {
+		m.ID = uuid.New()
+	}
+	return nil
+}
+
+type InvoiceStatus string
+
+const (
+	InvoiceIssued InvoiceStatus = "issued" // Owed by a postpaid organization
+	InvoicePaid   InvoiceStatus = "paid"   // Settled, or already paid from a prepaid wallet
+)
+
+// Invoice bills an organization for the sessions its members closed in a
+// calendar month. Total is what was charged less refunds.
+type Invoice struct {
+	ID             uuid.UUID     `gorm:"type:uuid;primaryKey" json:"id"`
+	Sequence       int           `gorm:"uniqueIndex;not null" json:"-"`
+	Number         string        `gorm:"size:30;uniqueIndex;not null" json:"number"` // e.g. INV-2026-000042
+	OrganizationID uuid.UUID     `gorm:"type:uuid;not null;uniqueIndex:idx_invoice_org_period" json:"organization_id"`
+	PeriodStart    time.Time     `gorm:"not null;uniqueIndex:idx_invoice_org_period" json:"period_start"`
+	PeriodEnd      time.Time     `gorm:"not null" json:"period_end"`
+	SessionCount   int           `json:"session_count"`
+	EnergyKWH      float64       `gorm:"type:decimal(12,3);default:0" json:"energy_kwh"`
+	Tax            Money         `gorm:"type:bigint;default:0" json:"tax"`
+	Refunded       Money         `gorm:"type:bigint;default:0" json:"refunded"`
+	Total          Money         `gorm:"type:bigint;default:0" json:"total"`
+	Status         InvoiceStatus `gorm:"size:20;not null" json:"status"`
+	IssuedAt       time.Time     `json:"issued_at"`
+	PaidAt         *time.Time    `json:"paid_at"`
+
+	Organization *Organization `gorm:"foreignKey:OrganizationID" json:"organization,omitempty"`
+	Lines        []InvoiceLine `gorm:"foreignKey:InvoiceID" json:"lines,omitempty"`
+}
+
+func (i *Invoice) BeforeCreate(tx *gorm.DB) error {
+	if i.ID == uuid.Nil {
+		i.ID = uuid.New()
+	}
+	return nil
+}
+
+// InvoiceLine is one session on an invoice, with the driver and vehicle as
+// they were when the invoice was issued.
+type InvoiceLine struct {
+	ID           uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	InvoiceID    uuid.UUID  `gorm:"type:uuid;not null;index" json:"invoice_id"`
+	SessionID    uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex" json:"session_id"`
+	UserID       uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	DriverName   string     `gorm:"size:100" json:"driver_name"`
+	VehiclePlate string     `gorm:"size:20" json:"vehicle_plate"`
+	StationName  string     `gorm:"size:100" json:"station_name"`
+	StartedAt    *time.Time `json:"started_at"`
+	EndedAt      *time.Time `json:"ended_at"`
+	EnergyKWH    float64    `gorm:"type:decimal(10,3);default:0" json:"energy_kwh"`
+	Tax          Money      `gorm:"type:bigint;default:0" json:"tax"`
+	Amount       Money      `gorm:"type:bigint;default:0" json:"amount"`
+	Refunded     Money      `gorm:"type:bigint;default:0" json:"refunded"`
+}
+
+func (l *InvoiceLine) BeforeCreate(tx *gorm.DB) error {
+	if l.ID == uuid.Nil {
+		l.ID = uuid.New()
+	}
+	return nil
+}
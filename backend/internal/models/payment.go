@@ -10,26 +10,52 @@ import (
 type PaymentStatus string
 
 const (
-	PaymentPending   PaymentStatus = "pending"
-	PaymentSuccess   PaymentStatus = "success"
-	PaymentFailed    PaymentStatus = "failed"
-	PaymentRefunded  PaymentStatus = "refunded"
+	PaymentPending           PaymentStatus = "pending"
+	PaymentSuccess           PaymentStatus = "success"
+	PaymentFailed            PaymentStatus = "failed"
+	PaymentRefunded          PaymentStatus = "refunded"
+	PaymentPartiallyRefunded PaymentStatus = "partially_refunded"
+	PaymentCancelled         PaymentStatus = "cancelled"
+)
+
+// PaymentPurpose tells what a payment pays for.
+type PaymentPurpose string
+
+const (
+	PurposeSession PaymentPurpose = "session"
+	PurposeTopUp   PaymentPurpose = "topup"
 )
 
 type Payment struct {
 	ID             uuid.UUID      `gorm:"type:uuid;primaryKey" json:"id"`
-	SessionID      uuid.UUID      `gorm:"type:uuid;not null;uniqueIndex" json:"session_id"`
+	UserID         uuid.UUID      `gorm:"type:uuid;index" json:"user_id"`
+	Purpose        PaymentPurpose `gorm:"size:20;default:'session';index" json:"purpose"`
+	SessionID      *uuid.UUID     `gorm:"type:uuid;uniqueIndex" json:"session_id,omitempty"` // Unset for wallet top-ups
 	PaymentMethod  string         `gorm:"size:50" json:"payment_method"`
-	PaymentGateway string         `gorm:"size:50;default:'dummy'" json:"payment_gateway"`
+	PaymentGateway string         `gorm:"size:50;default:'wallet'" json:"payment_gateway"`
 	ExternalID     string         `gorm:"size:200" json:"external_id"`
-	Amount         float64        `gorm:"type:decimal(12,2);not null" json:"amount"`
+	Amount         Money          `gorm:"type:bigint;not null" json:"amount"`
+	Discount       Money          `gorm:"type:bigint;default:0" json:"discount"` // Voucher discount already taken off Amount
+	ServiceFee     Money          `gorm:"type:bigint;default:0" json:"service_fee"` // Included in Amount
+	Tax            Money          `gorm:"type:bigint;default:0" json:"tax"`         // Included in Amount
+	RefundedAmount Money          `gorm:"type:bigint;default:0" json:"refunded_amount"`
+	PrepaidAmount  Money          `gorm:"type:bigint;default:0" json:"prepaid_amount,omitempty"` // Paid upfront by direct pay and credited to the wallet
+	Automatic      bool           `gorm:"default:false;index" json:"automatic,omitempty"`        // Auto top-up charged from a saved payment method
 	Status         PaymentStatus  `gorm:"size:20;default:'pending'" json:"status"`
+	PaymentURL     string         `gorm:"size:500" json:"payment_url,omitempty"` // Gateway payment page
+	VABank         string         `gorm:"size:20" json:"va_bank,omitempty"`
+	VANumber       string         `gorm:"size:50" json:"va_number,omitempty"`
+	QRString       string         `gorm:"type:text" json:"qr_string,omitempty"` // QRIS payload to render as a QR code
+	ExpiresAt      *time.Time     `json:"expires_at,omitempty"`
+	PaidAt         *time.Time     `json:"paid_at,omitempty"`
 	CallbackData   string         `gorm:"type:text" json:"callback_data,omitempty"`
 	CreatedAt      time.Time      `json:"created_at"`
 	UpdatedAt      time.Time      `json:"updated_at"`
 	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
 
-	Session ChargingSession `gorm:"foreignKey:SessionID" json:"session,omitempty"`
+	User    *User            `gorm:"foreignKey:UserID" json:"-"`
+	Session *ChargingSession `gorm:"foreignKey:SessionID" json:"session,omitempty"`
+	Refunds []Refund         `gorm:"foreignKey:PaymentID" json:"refunds,omitempty"`
 }
 
 func (p *Payment) BeforeCreate(tx *gorm.DB) error {
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ConnectorPriceChange is an entry in a connector's price history. Entries
+// with a future EffectiveAt are pending until the scheduler applies them.
+type ConnectorPriceChange struct {
+	ID          uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	ConnectorID uuid.UUID  `gorm:"type:uuid;not null;index" json:"connector_id"`
+	PricePerKWH Money      `gorm:"type:bigint;not null" json:"price_per_kwh"`
+	TariffID    *uuid.UUID `gorm:"type:uuid" json:"tariff_id"`
+	EffectiveAt time.Time  `gorm:"not null;index" json:"effective_at"`
+	AppliedAt   *time.Time `json:"applied_at"` // nil while pending
+	CreatedBy   *uuid.UUID `gorm:"type:uuid" json:"created_by"`
+	Note        string     `gorm:"size:255" json:"note"`
+	CreatedAt   time.Time  `json:"created_at"`
+
+	Connector Connector `gorm:"foreignKey:ConnectorID" json:"-"`
+}
+
+func (p *ConnectorPriceChange) BeforeCreate(tx *gorm.DB) error {
+	if p.ID == uuid.Nil {
+		p.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Receipt numbers the bill of a completed session for the user's expense
+// records. Numbers run without gaps across all sessions and never change;
+// the receipt itself is rendered from the session whenever it is requested.
+type Receipt struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	Sequence  int        `gorm:"uniqueIndex;not null" json:"-"`
+	Number    string     `gorm:"size:30;uniqueIndex;not null" json:"number"` // e.g. RCP-2026-000042
+	SessionID uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex" json:"session_id"`
+	UserID    uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	IssuedAt  time.Time  `gorm:"not null" json:"issued_at"`
+	EmailedTo string     `gorm:"size:100" json:"emailed_to,omitempty"` // Last address the receipt was sent to
+	EmailedAt *time.Time `json:"emailed_at,omitempty"`
+}
+
+func (r *Receipt) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Refund returns part or all of a session's payment to the user's wallet.
+// Tax is the share of the refunded amount that reverses collected tax, and
+// Discount the share of the voucher discount given back to promotions.
+type Refund struct {
+	ID                  uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	PaymentID           uuid.UUID  `gorm:"type:uuid;not null;index" json:"payment_id"`
+	SessionID           uuid.UUID  `gorm:"type:uuid;not null;index" json:"session_id"`
+	UserID              uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	Amount              Money      `gorm:"type:bigint;not null" json:"amount"`
+	Tax                 Money      `gorm:"type:bigint;default:0" json:"tax"`      // Included in Amount
+	Discount            Money      `gorm:"type:bigint;default:0" json:"discount"` // Not included in Amount
+	Reason              string     `gorm:"size:255" json:"reason"`
+	Automatic           bool       `gorm:"default:false" json:"automatic"`
+	RefundedBy          *uuid.UUID `gorm:"type:uuid" json:"refunded_by,omitempty"` // Admin, unset for automatic refunds
+	LedgerTransactionID *uuid.UUID `gorm:"type:uuid;index" json:"ledger_transaction_id"`
+	CreatedAt           time.Time  `json:"created_at"`
+}
+
+func (r *Refund) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return nil
+}
@@ -12,31 +12,76 @@ type SessionStatus string
 const (
 	SessionPending    SessionStatus = "pending"
 	SessionPaid       SessionStatus = "paid"
+	SessionScheduled  SessionStatus = "scheduled" // Paid, connector held until the scheduled start
 	SessionCharging   SessionStatus = "charging"
+	SessionIdle       SessionStatus = "idle" // Charging finished, vehicle still plugged in
 	SessionCompleted  SessionStatus = "completed"
 	SessionCancelled  SessionStatus = "cancelled"
 	SessionFailed     SessionStatus = "failed"
 )
 
+// StopReason records which limit or event ended the charging phase.
+type StopReason string
+
+const (
+	StopTargetKWH   StopReason = "target_kwh"
+	StopMaxCost     StopReason = "max_cost"
+	StopMaxDuration StopReason = "max_duration"
+	StopTargetSoC   StopReason = "target_soc"
+	StopUser        StopReason = "user"
+	StopCharger     StopReason = "charger" // Charger finished on its own, e.g. battery full
+	StopUnplugged   StopReason = "unplugged"
+	StopError       StopReason = "error"
+)
+
 type ChargingSession struct {
 	ID           uuid.UUID      `gorm:"type:uuid;primaryKey" json:"id"`
 	UserID       uuid.UUID      `gorm:"type:uuid;not null;index" json:"user_id"`
-	ConnectorID  uuid.UUID      `gorm:"type:uuid;not null;index" json:"connector_id"`
+	ConnectorID  uuid.UUID      `gorm:"type:uuid;not null;index;uniqueIndex:idx_session_offline" json:"connector_id"`
 	Status       SessionStatus  `gorm:"size:20;default:'pending'" json:"status"`
 	EnergyKWH    float64        `gorm:"type:decimal(10,3);default:0" json:"energy_kwh"`
 	PowerKW      float64        `gorm:"type:decimal(6,2);default:0" json:"power_kw"`
 	Progress     int            `gorm:"default:0" json:"progress"`
-	TotalCost    float64        `gorm:"type:decimal(12,2);default:0" json:"total_cost"`
+	TariffID     *uuid.UUID     `gorm:"type:uuid;index" json:"tariff_id"`
+	Tariff       *Tariff        `gorm:"type:jsonb;serializer:json" json:"tariff,omitempty"` // Snapshot of the tariff in force at session start, used for billing
+	EnergyCost   Money          `gorm:"type:bigint;default:0" json:"energy_cost"`
+	TimeCost     Money          `gorm:"type:bigint;default:0" json:"time_cost"`
+	StartFee     Money          `gorm:"type:bigint;default:0" json:"start_fee"`
+	Adjustment   Money          `gorm:"type:bigint;default:0" json:"price_adjustment"` // Min/max session price correction
+	IdleFee      Money          `gorm:"type:bigint;default:0" json:"idle_fee"`
+	IdleMinutes  int            `gorm:"default:0" json:"idle_minutes"`
+	VoucherID    *uuid.UUID     `gorm:"type:uuid;index" json:"voucher_id"`
+	Discount     Money          `gorm:"type:bigint;default:0" json:"discount"`
+	ServiceFee   Money          `gorm:"type:bigint;default:0" json:"service_fee"`
+	Tax          Money          `gorm:"type:bigint;default:0" json:"tax"`
+	TotalCost    Money          `gorm:"type:bigint;default:0" json:"total_cost"`
 	TargetKWH    float64        `gorm:"type:decimal(10,3);default:0" json:"target_kwh"`
+	MaxCost      Money          `gorm:"type:bigint;default:0" json:"max_cost"`
+	MaxDuration  int            `gorm:"default:0" json:"max_duration_minutes"`
+	TargetSoC    int            `gorm:"default:0" json:"target_soc"`
+	SoC          int            `gorm:"default:0" json:"soc"`
+	StopReason   StopReason     `gorm:"size:30" json:"stop_reason,omitempty"`
+	ScheduledAt  *time.Time     `gorm:"index" json:"scheduled_start_at"`
+	ReadyBy      *time.Time     `json:"ready_by"`
 	StartedAt    *time.Time     `json:"started_at"`
+	ChargedAt    *time.Time     `json:"charged_at"` // Charger reported complete, idle time starts here
 	EndedAt      *time.Time     `json:"ended_at"`
 	CreatedAt    time.Time      `json:"created_at"`
 	UpdatedAt    time.Time      `json:"updated_at"`
 	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
 
-	User      User      `gorm:"foreignKey:UserID" json:"user,omitempty"`
-	Connector Connector `gorm:"foreignKey:ConnectorID" json:"connector,omitempty"`
-	Payment   *Payment  `gorm:"foreignKey:SessionID" json:"payment,omitempty"`
+	// Fleet sessions are billed to the organization's wallet
+	OrganizationID *uuid.UUID `gorm:"type:uuid;index" json:"organization_id,omitempty"`
+	VehicleID      *uuid.UUID `gorm:"type:uuid;index" json:"vehicle_id,omitempty"`
+	VehiclePlate   string     `gorm:"size:20" json:"vehicle_plate,omitempty"`
+	AuthTokenID    *uuid.UUID `gorm:"type:uuid;index" json:"auth_token_id,omitempty"`                      // Started at the charger with a card or token
+	OfflineID      *string    `gorm:"size:64;uniqueIndex:idx_session_offline" json:"offline_id,omitempty"` // Charger's ID of a session reported after running offline
+
+	User      User              `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	Connector Connector         `gorm:"foreignKey:ConnectorID" json:"connector,omitempty"`
+	Payment   *Payment          `gorm:"foreignKey:SessionID" json:"payment,omitempty"`
+	LineItems []SessionLineItem `gorm:"foreignKey:SessionID" json:"line_items,omitempty"`
+	Vehicle   *Vehicle          `gorm:"foreignKey:VehicleID" json:"vehicle,omitempty"`
 }
 
 func (s *ChargingSession) BeforeCreate(tx *gorm.DB) error {
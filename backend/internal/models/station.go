@@ -23,11 +23,14 @@ type Station struct {
 	Longitude float64        `gorm:"type:decimal(10,7)" json:"longitude"`
 	QRCode    string         `gorm:"size:100;uniqueIndex;not null" json:"qr_code"`
 	Status    StationStatus  `gorm:"size:20;default:'active'" json:"status"`
+	IdleFee   IdleFeePolicy  `gorm:"embedded;embeddedPrefix:idle_" json:"idle_fee"`
+	TariffID  *uuid.UUID     `gorm:"type:uuid;index" json:"tariff_id"` // Default tariff for connectors without their own
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 
 	Connectors []Connector `gorm:"foreignKey:StationID" json:"connectors,omitempty"`
+	Tariff     *Tariff     `gorm:"foreignKey:TariffID" json:"tariff,omitempty"`
 }
 
 func (s *Station) BeforeCreate(tx *gorm.DB) error {
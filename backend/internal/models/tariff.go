@@ -0,0 +1,97 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Tariff is a pricing scheme assignable to stations or connectors. Energy
+// and charging time are billed at the base rates unless a time-of-use band
+// covers the moment the energy was delivered.
+type Tariff struct {
+	ID             uuid.UUID      `gorm:"type:uuid;primaryKey" json:"id"`
+	Name           string         `gorm:"size:100;not null" json:"name"`
+	Description    string         `gorm:"size:255" json:"description"`
+	PricePerKWH    Money          `gorm:"type:bigint;default:0" json:"price_per_kwh"`
+	PricePerMinute Money          `gorm:"type:bigint;default:0" json:"price_per_minute"` // Charging time, idle time is billed separately
+	StartFee       Money          `gorm:"type:bigint;default:0" json:"start_fee"`
+	MinPrice       Money          `gorm:"type:bigint;default:0" json:"min_price"` // 0 = no minimum
+	MaxPrice       Money          `gorm:"type:bigint;default:0" json:"max_price"` // 0 = no maximum
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
+
+	Bands []TariffBand `gorm:"foreignKey:TariffID" json:"bands"`
+}
+
+// TariffBand overrides the base rates during certain hours of certain
+// weekdays, e.g. an off-peak rate from 22:00 to 06:00.
+type TariffBand struct {
+	ID             uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	TariffID       uuid.UUID `gorm:"type:uuid;not null;index" json:"tariff_id"`
+	Name           string    `gorm:"size:100" json:"name"`
+	Weekdays       string    `gorm:"size:20" json:"weekdays"`    // Comma separated, 0 = Sunday; empty = every day
+	StartHour      int       `gorm:"not null" json:"start_hour"` // 0-23, inclusive
+	EndHour        int       `gorm:"not null" json:"end_hour"`   // 1-24, exclusive, never equal to StartHour; below it wraps past midnight
+	PricePerKWH    Money     `gorm:"type:bigint" json:"price_per_kwh"`
+	PricePerMinute Money     `gorm:"type:bigint" json:"price_per_minute"`
+}
+
+func (t *Tariff) BeforeCreate(tx *gorm.DB) error {
+	if t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
+	return nil
+}
+
+func (b *TariffBand) BeforeCreate(tx *gorm.DB) error {
+	if b.ID == uuid.Nil {
+		b.ID = uuid.New()
+	}
+	return nil
+}
+
+// Covers reports whether the band applies at the given local time. A band
+// wrapping past midnight belongs to the weekday it starts on.
+func (b TariffBand) Covers(at time.Time) bool {
+	hour := at.Hour()
+	weekday := at.Weekday()
+
+	if b.StartHour < b.EndHour {
+		return hour >= b.StartHour && hour < b.EndHour && b.onWeekday(weekday)
+	}
+	if hour >= b.StartHour {
+		return b.onWeekday(weekday)
+	}
+	if hour < b.EndHour {
+		return b.onWeekday((weekday + 6) % 7)
+	}
+	return false
+}
+
+func (b TariffBand) onWeekday(day time.Weekday) bool {
+	if strings.TrimSpace(b.Weekdays) == "" {
+		return true
+	}
+	for _, part := range strings.Split(b.Weekdays, ",") {
+		if d, err := strconv.Atoi(strings.TrimSpace(part)); err == nil && time.Weekday(d) == day {
+			return true
+		}
+	}
+	return false
+}
+
+// RatesAt returns the per-kWh and per-minute rates in force at the given
+// local time; the first matching band wins.
+func (t Tariff) RatesAt(at time.Time) (perKWH, perMinute Money) {
+	for _, band := range t.Bands {
+		if band.Covers(at) {
+			return band.PricePerKWH, band.PricePerMinute
+		}
+	}
+	return t.PricePerKWH, t.PricePerMinute
+}
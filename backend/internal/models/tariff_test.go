@@ -0,0 +1,77 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTariffBandCovers(t *testing.T) {
+	// 19 October 2026 is a Monday
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, 10, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name string
+		band TariffBand
+		at   time.Time
+		want bool
+	}{
+		{"daytime band start is inclusive", TariffBand{StartHour: 9, EndHour: 17}, at(19, 9, 0), true},
+		{"daytime band end is exclusive", TariffBand{StartHour: 9, EndHour: 17}, at(19, 17, 0), false},
+		{"before daytime band", TariffBand{StartHour: 9, EndHour: 17}, at(19, 8, 59), false},
+		{"whole day band", TariffBand{StartHour: 0, EndHour: 24}, at(19, 23, 59), true},
+		{"night band before midnight", TariffBand{StartHour: 22, EndHour: 6}, at(19, 23, 0), true},
+		{"night band after midnight", TariffBand{StartHour: 22, EndHour: 6}, at(20, 2, 0), true},
+		{"night band end is exclusive", TariffBand{StartHour: 22, EndHour: 6}, at(20, 6, 0), false},
+		{"outside night band", TariffBand{StartHour: 22, EndHour: 6}, at(19, 21, 59), false},
+		{"weekday listed", TariffBand{StartHour: 9, EndHour: 17, Weekdays: "1,2,3,4,5"}, at(19, 10, 0), true},
+		{"weekday not listed", TariffBand{StartHour: 9, EndHour: 17, Weekdays: "1,2,3,4,5"}, at(25, 10, 0), false},
+		{"weekday list with spaces", TariffBand{StartHour: 9, EndHour: 17, Weekdays: " 0 , 6 "}, at(25, 10, 0), true},
+		{"wrapped band on the weekday it starts", TariffBand{StartHour: 22, EndHour: 6, Weekdays: "5"}, at(23, 23, 0), true},
+		{"wrapped band after midnight belongs to the day before", TariffBand{StartHour: 22, EndHour: 6, Weekdays: "5"}, at(24, 2, 0), true},
+		{"wrapped band early morning of its own weekday", TariffBand{StartHour: 22, EndHour: 6, Weekdays: "5"}, at(23, 2, 0), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.band.Covers(tt.at); got != tt.want {
+				t.Errorf("Covers(%s) = %v, want %v", tt.at.Format("Mon 15:04"), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTariffRatesAt(t *testing.T) {
+	tariff := Tariff{
+		PricePerKWH:    NewMoney(2500),
+		PricePerMinute: NewMoney(100),
+		Bands: []TariffBand{
+			{StartHour: 22, EndHour: 6, PricePerKWH: NewMoney(1500), PricePerMinute: NewMoney(50)},
+			{StartHour: 0, EndHour: 24, PricePerKWH: NewMoney(9999)}, // Never reached at night, first match wins
+		},
+	}
+
+	tests := []struct {
+		name          string
+		hour          int
+		wantKWH       Money
+		wantPerMinute Money
+	}{
+		{"first matching band wins", 23, NewMoney(1500), NewMoney(50)},
+		{"later band when the first does not match", 12, NewMoney(9999), 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			perKWH, perMinute := tariff.RatesAt(time.Date(2026, 10, 19, tt.hour, 0, 0, 0, time.UTC))
+			if perKWH != tt.wantKWH || perMinute != tt.wantPerMinute {
+				t.Errorf("RatesAt(%02d:00) = %s, %s; want %s, %s", tt.hour, perKWH, perMinute, tt.wantKWH, tt.wantPerMinute)
+			}
+		})
+	}
+
+	if perKWH, _ := (Tariff{PricePerKWH: NewMoney(2500)}).RatesAt(time.Now()); perKWH != NewMoney(2500) {
+		t.Errorf("RatesAt without bands = %s, want base rate 2500.00", perKWH)
+	}
+}
@@ -0,0 +1,70 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Vehicle is an electric vehicle a user registered. Sessions started with it
+// are checked against its connector types, capped at its battery capacity
+// and estimated at the lower of its and the connector's power.
+type Vehicle struct {
+	ID             uuid.UUID      `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID         uuid.UUID      `gorm:"type:uuid;not null;index" json:"user_id"`
+	Make           string         `gorm:"size:50;not null" json:"make"`
+	Model          string         `gorm:"size:50;not null" json:"model"`
+	Plate          string         `gorm:"size:20" json:"plate"`
+	BatteryKWH     float64        `gorm:"type:decimal(6,2);not null" json:"battery_kwh"`
+	ConnectorTypes []string       `gorm:"type:jsonb;serializer:json" json:"connector_types"` // e.g. ["Type 2", "CCS"]
+	MaxACKW        float64        `gorm:"type:decimal(6,2);default:0" json:"max_ac_kw"`      // Onboard charger limit, 0 when unknown
+	MaxDCKW        float64        `gorm:"type:decimal(6,2);default:0" json:"max_dc_kw"`      // 0 when unknown
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+func (v *Vehicle) BeforeCreate(tx *gorm.DB) error {
+	if v.ID == uuid.Nil {
+		v.ID = uuid.New()
+	}
+	return nil
+}
+
+// NormalizeConnectorType folds the spellings of a connector type used by
+// stations and vehicles, e.g. "Type 2", "type2" and "TYPE-2", into one.
+func NormalizeConnectorType(connectorType string) string {
+	return strings.NewReplacer(" ", "", "-", "", "_", "").Replace(strings.ToLower(connectorType))
+}
+
+// IsDCConnector reports whether a connector type charges with direct
+// current.
+func IsDCConnector(connectorType string) bool {
+	switch NormalizeConnectorType(connectorType) {
+	case "ccs", "ccs1", "ccs2", "chademo", "gbtdc":
+		return true
+	}
+	return false
+}
+
+// Supports reports whether the vehicle can plug into a connector type.
+func (v *Vehicle) Supports(connectorType string) bool {
+	want := NormalizeConnectorType(connectorType)
+	for _, t := range v.ConnectorTypes {
+		if NormalizeConnectorType(t) == want {
+			return true
+		}
+	}
+	return false
+}
+
+// MaxPowerKW returns the most power the vehicle accepts on a connector
+// type, or 0 when it is unknown.
+func (v *Vehicle) MaxPowerKW(connectorType string) float64 {
+	if IsDCConnector(connectorType) {
+		return v.MaxDCKW
+	}
+	return v.MaxACKW
+}
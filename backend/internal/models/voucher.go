@@ -0,0 +1,65 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type VoucherType string
+
+const (
+	VoucherPercentage VoucherType = "percentage" // Percent off the charging cost
+	VoucherFixed      VoucherType = "fixed"      // Amount off the charging cost
+	VoucherFreeKWH    VoucherType = "free_kwh"   // Free kWh not billed
+	VoucherCredit     VoucherType = "credit"     // Amount of wallet credit, redeemed via /wallet/redeem
+)
+
+type Voucher struct {
+	ID            uuid.UUID      `gorm:"type:uuid;primaryKey" json:"id"`
+	Code          string         `gorm:"size:50;uniqueIndex;not null" json:"code"`
+	Description   string         `gorm:"size:255" json:"description"`
+	Type          VoucherType    `gorm:"size:20;not null" json:"type"`
+	Amount        Money          `gorm:"type:bigint;default:0" json:"amount"`          // Fixed and credit vouchers
+	Percent       float64        `gorm:"type:decimal(5,2);default:0" json:"percent"`   // Percentage vouchers
+	FreeKWH       float64        `gorm:"type:decimal(10,3);default:0" json:"free_kwh"` // Free kWh vouchers
+	MaxDiscount   Money          `gorm:"type:bigint;default:0" json:"max_discount"`    // Cap for percentage vouchers, 0 = no cap
+	UsageLimit    int            `gorm:"default:0" json:"usage_limit"`                 // Total redemptions, 0 = unlimited
+	PerUserLimit  int            `gorm:"default:0" json:"per_user_limit"`              // Redemptions per user, 0 = unlimited
+	ValidFrom     *time.Time     `json:"valid_from"`
+	ValidUntil    *time.Time     `json:"valid_until"`
+	StationID     *uuid.UUID     `gorm:"type:uuid" json:"station_id"`   // Only valid at this station
+	ConnectorType string         `gorm:"size:50" json:"connector_type"` // Only valid for this connector type
+	IsActive      bool           `gorm:"default:true" json:"is_active"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	DeletedAt     gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// VoucherRedemption records one use of a voucher. Session redemptions are
+// reserved when the session is created and get their amount at settlement.
+type VoucherRedemption struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	VoucherID uuid.UUID  `gorm:"type:uuid;not null;index" json:"voucher_id"`
+	UserID    uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	SessionID *uuid.UUID `gorm:"type:uuid;index" json:"session_id"`
+	Amount    Money      `gorm:"type:bigint;default:0" json:"amount"` // Discount or credit granted
+	CreatedAt time.Time  `json:"created_at"`
+
+	Voucher Voucher `gorm:"foreignKey:VoucherID" json:"voucher,omitempty"`
+}
+
+func (v *Voucher) BeforeCreate(tx *gorm.DB) error {
+	if v.ID == uuid.Nil {
+		v.ID = uuid.New()
+	}
+	return nil
+}
+
+func (r *VoucherRedemption) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return nil
+}
@@ -10,21 +10,36 @@ import (
 type TransactionType string
 
 const (
-	TransactionTopUp     TransactionType = "topup"
-	TransactionDeduction TransactionType = "deduction"
-	TransactionRefund    TransactionType = "refund"
+	TransactionTopUp       TransactionType = "topup"
+	TransactionAutoTopUp   TransactionType = "auto_topup" // Charged from a saved payment method
+	TransactionDeduction   TransactionType = "deduction"
+	TransactionRefund      TransactionType = "refund"
+	TransactionPromo       TransactionType = "promo"        // Voucher credit
+	TransactionTransferOut TransactionType = "transfer_out" // Sent to another user's wallet
+	TransactionTransferIn  TransactionType = "transfer_in"  // Received from another user's wallet
 )
 
+// Credits reports whether the transaction type adds to the wallet.
+func (t TransactionType) Credits() bool {
+	return t != TransactionDeduction && t != TransactionTransferOut
+}
+
 type WalletTransaction struct {
-	ID              uuid.UUID       `gorm:"type:uuid;primaryKey" json:"id"`
-	UserID          uuid.UUID       `gorm:"type:uuid;not null;index" json:"user_id"`
-	Amount          float64         `gorm:"type:decimal(15,2);not null" json:"amount"`
-	TransactionType TransactionType `gorm:"size:20;not null" json:"transaction_type"`
-	ReferenceID     string          `gorm:"size:100" json:"reference_id"` // Session ID or Payment ID
-	Description     string          `gorm:"size:255" json:"description"`
-	CreatedAt       time.Time       `json:"created_at"`
-
-	User User `gorm:"foreignKey:UserID" json:"-"`
+	ID                  uuid.UUID       `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID              uuid.UUID       `gorm:"type:uuid;not null;index;index:idx_wallet_transactions_user_created,priority:1" json:"user_id"`
+	Amount              Money           `gorm:"type:bigint;not null" json:"amount"`
+	Discount            Money           `gorm:"type:bigint;default:0" json:"discount"` // Voucher discount already taken off Amount
+	TransactionType     TransactionType `gorm:"size:20;not null" json:"transaction_type"`
+	ReferenceID         string          `gorm:"size:100" json:"reference_id"`                     // Session, payment or refund ID
+	SessionID           *uuid.UUID      `gorm:"type:uuid;index" json:"session_id"`                // Charging session of a deduction
+	OrganizationID      *uuid.UUID      `gorm:"type:uuid;index" json:"organization_id,omitempty"` // Set when the organization's wallet was used instead of the user's
+	LedgerTransactionID *uuid.UUID      `gorm:"type:uuid;index" json:"ledger_transaction_id"`
+	BalanceAfter        *Money          `gorm:"type:bigint" json:"balance_after"` // Wallet balance right after this entry
+	Description         string          `gorm:"size:255" json:"description"`
+	CreatedAt           time.Time       `gorm:"index:idx_wallet_transactions_user_created,priority:2" json:"created_at"`
+
+	User    User             `gorm:"foreignKey:UserID" json:"-"`
+	Session *ChargingSession `gorm:"foreignKey:SessionID" json:"session,omitempty"`
 }
 
 func (wt *WalletTransaction) BeforeCreate(tx *gorm.DB) error {
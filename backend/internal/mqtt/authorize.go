@@ -0,0 +1,88 @@
+package mqttclient
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
+	"github.com/Julianarwansah/sistemcharging/backend/internal/services"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"gorm.io/gorm"
+)
+
+// AuthorizeRequest is published by a charger on <connector topic>/authorize
+// when a card is tapped or a vehicle presents a plug-and-charge contract.
+type AuthorizeRequest struct {
+	RequestID string `json:"request_id"`
+	IDTag     string `json:"id_tag"` // RFID UID, virtual token or contract ID
+}
+
+func (mc *MQTTClient) subscribeToAuthorize() {
+	for _, topic := range []string{"charger/+/authorize", "charger/+/+/authorize"} {
+		mc.client.Subscribe(topic, 1, func(c mqtt.Client, msg mqtt.Message) {
+			var req AuthorizeRequest
+			if err := json.Unmarshal(msg.Payload(), &req); err != nil {
+				log.Printf("Error parsing authorize request: %v", err)
+				return
+			}
+			mc.authorize(strings.TrimSuffix(msg.Topic(), "/authorize"), req)
+		})
+	}
+
+	log.Println("📡 Subscribed to charger/+/authorize")
+}
+
+// authorize answers an authorize request on the connector's command topic
+// with an AUTHORIZE command carrying the status, and for an accepted token
+// creates the session billed to its owner and starts it.
+func (mc *MQTTClient) authorize(connectorTopic string, req AuthorizeRequest) {
+	var connector models.Connector
+	if err := mc.db.First(&connector, "mqtt_topic = ?", connectorTopic).Error; err != nil {
+		log.Printf("Authorize request from unknown charger %s", connectorTopic)
+		return
+	}
+
+	now := time.Now()
+	var session *models.ChargingSession
+	token, err := services.AuthorizeToken(mc.db, req.IDTag, now)
+	if err == nil {
+		err = mc.db.Transaction(func(tx *gorm.DB) error {
+			var createErr error
+			session, createErr = services.CreateTokenSession(tx, token, connector.ID, now)
+			return createErr
+		})
+	}
+
+	status := services.AuthorizationStatus(err)
+	if status == models.AuthInvalid && !errors.Is(err, services.ErrTokenUnknown) {
+		log.Printf("Error authorizing token at %s: %v", connectorTopic, err)
+	}
+	log.Printf("🪪 Token %s at %s: %s", req.IDTag, connectorTopic, status)
+
+	reply := ChargerCommand{
+		Action:    "AUTHORIZE",
+		RequestID: req.RequestID,
+		IDTag:     req.IDTag,
+		Status:    string(status),
+	}
+	if session != nil {
+		reply.SessionID = session.ID.String()
+	}
+	if err := mc.SendCommand(connectorTopic, reply); err != nil {
+		log.Printf("Error answering authorize request at %s: %v", connectorTopic, err)
+	}
+	if session == nil {
+		return
+	}
+
+	if err := mc.StartSession(session); err != nil {
+		log.Printf("Error starting token session %s: %v", session.ID, err)
+		mc.db.Transaction(func(tx *gorm.DB) error {
+			return services.CancelSession(tx, session, time.Now())
+		})
+		mc.BroadcastSessionStatus(session)
+	}
+}
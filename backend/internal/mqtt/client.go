@@ -2,11 +2,13 @@ package mqttclient
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"time"
 
 	"github.com/Julianarwansah/sistemcharging/backend/internal/config"
 	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
+	"github.com/Julianarwansah/sistemcharging/backend/internal/services"
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
@@ -16,6 +18,10 @@ type MQTTClient struct {
 	client mqtt.Client
 	db     *gorm.DB
 	hub    *WebSocketHub
+
+	// AfterSettle, when set, runs in the background for the session's user
+	// once a session is settled, e.g. to top their wallet up again
+	AfterSettle func(userID uuid.UUID)
 }
 
 type ChargerStatus struct {
@@ -23,6 +29,7 @@ type ChargerStatus struct {
 	EnergyKWH float64 `json:"energy_kwh"`
 	PowerKW   float64 `json:"power_kw"`
 	Progress  int     `json:"progress"`
+	SoC       int     `json:"soc"` // Battery state of charge in percent, 0 if unknown
 	SessionID string  `json:"session_id"`
 }
 
@@ -30,6 +37,12 @@ type ChargerCommand struct {
 	Action    string  `json:"action"`
 	SessionID string  `json:"session_id"`
 	TargetKWH float64 `json:"target_kwh"`
+
+	// Answer to an authorize request or an offline session report
+	RequestID string `json:"request_id,omitempty"`
+	IDTag     string `json:"id_tag,omitempty"`
+	OfflineID string `json:"offline_id,omitempty"`
+	Status    string `json:"status,omitempty"`
 }
 
 type WebSocketHub struct {
@@ -88,6 +101,8 @@ func NewMQTTClient(cfg *config.Config, db *gorm.DB, hub *WebSocketHub) *MQTTClie
 	opts.SetOnConnectHandler(func(c mqtt.Client) {
 		log.Println("✅ MQTT connected")
 		mc.subscribeToChargerStatus()
+		mc.subscribeToAuthorize()
+		mc.subscribeToLocalAuth()
 	})
 
 	opts.SetConnectionLostHandler(func(c mqtt.Client, err error) {
@@ -134,51 +149,151 @@ func (mc *MQTTClient) subscribeToChargerStatus() {
 			return
 		}
 
-		session.EnergyKWH = status.EnergyKWH
-		session.PowerKW = status.PowerKW
-		session.Progress = status.Progress
+		// Late updates (e.g. the "complete" echo after a user STOP) must not
+		// reopen a session that has already been settled
+		if services.IsSessionClosed(session.Status) {
+			return
+		}
 
-		// Fetch connector to get price if needed for real-time cost
+		// Fetch connector and its tariff for the real-time cost
 		var connector models.Connector
-		mc.db.First(&connector, "id = ?", session.ConnectorID)
-		session.TotalCost = status.EnergyKWH * connector.PricePerKWH
+		mc.db.Preload("Station").First(&connector, "id = ?", session.ConnectorID)
+
+		if status.Status != "unplugged" {
+			session.EnergyKWH = status.EnergyKWH
+			session.PowerKW = status.PowerKW
+			session.Progress = status.Progress
+			if status.SoC > 0 {
+				session.SoC = status.SoC
+			}
+
+			if tariff, err := services.SessionTariff(mc.db, &session, connector); err == nil {
+				end := time.Now()
+				if session.ChargedAt != nil {
+					end = *session.ChargedAt
+				}
+				start := end
+				if session.StartedAt != nil {
+					start = *session.StartedAt
+				}
+				services.ApplyBreakdown(&session, services.PriceCharging(tariff, session.EnergyKWH, start, end, services.TariffLocation(mc.db)))
+				session.Discount = services.RunningDiscount(mc.db, &session)
+				services.ApplyCharges(&session, services.LoadChargeRules(mc.db))
+			}
+		}
 
+		settled := false
 		switch status.Status {
 		case "charging":
 			session.Status = models.SessionCharging
+
+			// Enforce whichever stop limit is reached first; the charger
+			// answers STOP with "complete" which closes the charging phase
+			if session.StopReason == "" {
+				if reason := services.ReachedLimit(&session, time.Now()); reason != "" {
+					if err := mc.SendCommand(connector.MQTTTopic, ChargerCommand{
+						Action:    "STOP",
+						SessionID: session.ID.String(),
+					}); err != nil {
+						log.Printf("Error sending STOP for session %s: %v", session.ID, err)
+					} else {
+						session.StopReason = reason
+						log.Printf("🛑 Session %s reached limit %s, STOP sent", session.ID, reason)
+					}
+				}
+			}
 		case "complete":
-			session.Status = models.SessionCompleted
+			if session.ChargedAt != nil {
+				break
+			}
 			now := time.Now()
-			session.EndedAt = &now
-
-			var connector models.Connector
-			mc.db.First(&connector, "id = ?", session.ConnectorID)
-			session.TotalCost = status.EnergyKWH * connector.PricePerKWH
 			session.Progress = 100
-
-			connector.Status = models.ConnectorAvailable
-			mc.db.Save(&connector)
+			if session.StopReason == "" {
+				session.StopReason = models.StopCharger
+				if session.TargetKWH > 0 && session.EnergyKWH >= session.TargetKWH {
+					session.StopReason = models.StopTargetKWH
+				}
+			}
+			if models.EffectiveIdleFee(connector, connector.Station).Enabled() {
+				// Keep the connector occupied and start the idle clock until
+				// the vehicle is unplugged or the user closes the session
+				session.Status = models.SessionIdle
+				session.ChargedAt = &now
+			} else {
+				if err := mc.settle(&session, now); err != nil {
+					logSettleError(session.ID, err)
+					return
+				}
+				settled = true
+			}
+		case "unplugged":
+			if session.Status != models.SessionCharging && session.Status != models.SessionIdle {
+				return
+			}
+			if session.StopReason == "" {
+				session.StopReason = models.StopUnplugged
+			}
+			if err := mc.settle(&session, time.Now()); err != nil {
+				logSettleError(session.ID, err)
+				return
+			}
+			settled = true
 		case "error":
-			session.Status = models.SessionFailed
-			now := time.Now()
-			session.EndedAt = &now
-
-			var connector models.Connector
-			mc.db.First(&connector, "id = ?", session.ConnectorID)
-			connector.Status = models.ConnectorFault
-			mc.db.Save(&connector)
+			if err := mc.fail(&session, time.Now()); err != nil {
+				logSettleError(session.ID, err)
+				return
+			}
+			settled = true
 		}
 
-		mc.db.Save(&session)
+		// Only write what the report changed, and only while the session is
+		// open, so a concurrent settlement is never undone
+		if !settled {
+			result := mc.db.Model(&models.ChargingSession{}).
+				Where("id = ? AND status NOT IN ?", session.ID, services.ClosedSessionStatuses).
+				Updates(map[string]interface{}{
+					"status":      session.Status,
+					"energy_kwh":  session.EnergyKWH,
+					"power_kw":    session.PowerKW,
+					"progress":    session.Progress,
+					"soc":         session.SoC,
+					"energy_cost": session.EnergyCost,
+					"time_cost":   session.TimeCost,
+					"start_fee":   session.StartFee,
+					"adjustment":  session.Adjustment,
+					"discount":    session.Discount,
+					"service_fee": session.ServiceFee,
+					"tax":         session.Tax,
+					"total_cost":  session.TotalCost,
+					"stop_reason": session.StopReason,
+					"charged_at":  session.ChargedAt,
+				})
+			if result.Error != nil {
+				log.Printf("Error updating session %s: %v", session.ID, result.Error)
+				return
+			}
+			if result.RowsAffected == 0 {
+				return
+			}
+		}
 
 		// Broadcast to WebSocket subscribers
 		wsData, _ := json.Marshal(map[string]interface{}{
-			"session_id": session.ID,
-			"status":     session.Status,
-			"energy_kwh": session.EnergyKWH,
-			"power_kw":   session.PowerKW,
-			"progress":   session.Progress,
-			"total_cost": session.TotalCost,
+			"session_id":  session.ID,
+			"status":      session.Status,
+			"energy_kwh":  session.EnergyKWH,
+			"power_kw":    session.PowerKW,
+			"progress":    session.Progress,
+			"soc":         session.SoC,
+			"stop_reason": session.StopReason,
+			"energy_cost": session.EnergyCost,
+			"time_cost":   session.TimeCost,
+			"start_fee":   session.StartFee,
+			"idle_fee":    session.IdleFee,
+			"discount":    session.Discount,
+			"service_fee": session.ServiceFee,
+			"tax":         session.Tax,
+			"total_cost":  session.TotalCost,
 		})
 		mc.hub.Broadcast(session.ID.String(), wsData)
 		mc.hub.Broadcast("admin", wsData)
@@ -187,13 +302,96 @@ func (mc *MQTTClient) subscribeToChargerStatus() {
 	log.Println("📡 Subscribed to charger/+/status")
 }
 
+// settle closes the session through the shared settlement path and notifies
+// the user about the new wallet balance.
+func (mc *MQTTClient) settle(session *models.ChargingSession, closedAt time.Time) error {
+	err := mc.db.Transaction(func(tx *gorm.DB) error {
+		return services.SettleSession(tx, session, closedAt)
+	})
+	if err != nil {
+		return err
+	}
+
+	mc.notifyBalance(session)
+	mc.afterSettle(session)
+	return nil
+}
+
+// fail closes a session after a charger error, bills what was delivered and
+// tells the user about the automatic refund when nothing was.
+func (mc *MQTTClient) fail(session *models.ChargingSession, failedAt time.Time) error {
+	var refund *models.Refund
+	err := mc.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		refund, err = services.FailSession(tx, session, failedAt)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if refund != nil {
+		log.Printf("💸 Session %s failed without energy, refunded Rp %s", session.ID, refund.Amount)
+		mc.notifyRefund(refund)
+	}
+	mc.notifyBalance(session)
+	mc.afterSettle(session)
+	return nil
+}
+
+// logSettleError logs a failed settlement, except for sessions that were
+// already closed by another request or report.
+func logSettleError(sessionID uuid.UUID, err error) {
+	if errors.Is(err, services.ErrSessionClosed) {
+		return
+	}
+	log.Printf("Error closing session %s: %v", sessionID, err)
+}
+
+func (mc *MQTTClient) afterSettle(session *models.ChargingSession) {
+	if mc.AfterSettle != nil {
+		go mc.AfterSettle(session.UserID)
+	}
+}
+
+// notifyRefund tells the user and the admin dashboard about a refund.
+func (mc *MQTTClient) notifyRefund(refund *models.Refund) {
+	refundData, _ := json.Marshal(map[string]interface{}{
+		"type":       "refund",
+		"refund_id":  refund.ID,
+		"session_id": refund.SessionID,
+		"user_id":    refund.UserID,
+		"amount":     refund.Amount,
+		"reason":     refund.Reason,
+		"automatic":  refund.Automatic,
+	})
+	mc.hub.Broadcast(refund.UserID.String(), refundData)
+	mc.hub.Broadcast(refund.SessionID.String(), refundData)
+	mc.hub.Broadcast("admin", refundData)
+}
+
+func (mc *MQTTClient) notifyBalance(session *models.ChargingSession) {
+	var user models.User
+	mc.db.Select("balance").First(&user, "id = ?", session.UserID)
+	balanceData, _ := json.Marshal(map[string]interface{}{
+		"type":    "balance_update",
+		"balance": user.Balance,
+		"user_id": session.UserID,
+	})
+	mc.hub.Broadcast(session.UserID.String(), balanceData)
+	mc.hub.Broadcast("admin", balanceData)
+}
+
 func (mc *MQTTClient) SendCommand(connectorMQTTTopic string, command ChargerCommand) error {
-	payload, err := json.Marshal(command)
+	return mc.publish(connectorMQTTTopic+"/command", command)
+}
+
+func (mc *MQTTClient) publish(topic string, message interface{}) error {
+	payload, err := json.Marshal(message)
 	if err != nil {
 		return err
 	}
 
-	topic := connectorMQTTTopic + "/command"
 	token := mc.client.Publish(topic, 1, false, payload)
 	token.Wait()
 	return token.Error()
@@ -0,0 +1,178 @@
+package mqttclient
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
+	"github.com/Julianarwansah/sistemcharging/backend/internal/services"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"gorm.io/gorm"
+)
+
+// LocalAuthListCommand updates a charger's local authorization list. A full
+// update replaces the list; a differential one adds or changes Entries and
+// drops Removed.
+type LocalAuthListCommand struct {
+	Action     string                 `json:"action"` // UPDATE_AUTH_LIST
+	Version    int                    `json:"list_version"`
+	UpdateType string                 `json:"update_type"` // full, differential
+	Entries    []models.LocalAuthItem `json:"entries"`
+	Removed    []string               `json:"removed,omitempty"`
+}
+
+// LocalAuthListReport is published by a charger on <connector topic>/auth_list
+// after applying an update, and when it reconnects, with the list version it
+// has.
+type LocalAuthListReport struct {
+	Version int    `json:"list_version"`
+	Status  string `json:"status"` // accepted, failed
+}
+
+func (mc *MQTTClient) subscribeToLocalAuth() {
+	for _, topic := range []string{"charger/+/auth_list", "charger/+/+/auth_list"} {
+		mc.client.Subscribe(topic, 1, func(c mqtt.Client, msg mqtt.Message) {
+			var report LocalAuthListReport
+			if err := json.Unmarshal(msg.Payload(), &report); err != nil {
+				log.Printf("Error parsing auth list report: %v", err)
+				return
+			}
+			mc.ackLocalAuthList(strings.TrimSuffix(msg.Topic(), "/auth_list"), report)
+		})
+	}
+	for _, topic := range []string{"charger/+/offline_session", "charger/+/+/offline_session"} {
+		mc.client.Subscribe(topic, 1, func(c mqtt.Client, msg mqtt.Message) {
+			var report services.OfflineSession
+			if err := json.Unmarshal(msg.Payload(), &report); err != nil {
+				log.Printf("Error parsing offline session report: %v", err)
+				return
+			}
+			mc.recordOfflineSession(strings.TrimSuffix(msg.Topic(), "/offline_session"), report)
+		})
+	}
+
+	log.Println("📡 Subscribed to charger/+/auth_list and charger/+/offline_session")
+}
+
+// SyncLocalAuthList sends a connector's charger the update its local
+// authorization list needs, if any. force sends the full list.
+func (mc *MQTTClient) SyncLocalAuthList(connector models.Connector, force bool) error {
+	var update *services.LocalAuthUpdate
+	err := mc.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		update, err = services.NextLocalAuthUpdate(tx, connector.ID, force, time.Now())
+		return err
+	})
+	if err != nil || update == nil {
+		return err
+	}
+
+	command := LocalAuthListCommand{
+		Action:     "UPDATE_AUTH_LIST",
+		Version:    update.Version,
+		UpdateType: "differential",
+		Entries:    update.Items,
+		Removed:    update.Removed,
+	}
+	if update.Full {
+		command.UpdateType = "full"
+	}
+	if command.Entries == nil {
+		command.Entries = []models.LocalAuthItem{}
+	}
+	if err := mc.publish(connector.MQTTTopic+"/command", command); err != nil {
+		return err
+	}
+	log.Printf("📋 Auth list v%d (%s) sent to %s", update.Version, command.UpdateType, connector.MQTTTopic)
+	return nil
+}
+
+// SyncLocalAuthLists brings the local authorization list of every charger
+// that has or had one up to date.
+func (mc *MQTTClient) SyncLocalAuthLists() {
+	var connectors []models.Connector
+	if err := mc.db.Where("id IN (?) OR id IN (?)",
+		mc.db.Model(&models.LocalAuthEntry{}).Select("connector_id"),
+		mc.db.Model(&models.LocalAuthList{}).Select("connector_id"),
+	).Find(&connectors).Error; err != nil {
+		log.Printf("⚠️  Failed to load chargers with auth lists: %v", err)
+		return
+	}
+
+	for _, connector := range connectors {
+		if err := mc.SyncLocalAuthList(connector, false); err != nil {
+			log.Printf("⚠️  Failed to sync auth list of %s: %v", connector.MQTTTopic, err)
+		}
+	}
+}
+
+// ackLocalAuthList records the list version a charger has and sends it the
+// full list when it is out of date.
+func (mc *MQTTClient) ackLocalAuthList(connectorTopic string, report LocalAuthListReport) {
+	var connector models.Connector
+	if err := mc.db.First(&connector, "mqtt_topic = ?", connectorTopic).Error; err != nil {
+		log.Printf("Auth list report from unknown charger %s", connectorTopic)
+		return
+	}
+
+	var outdated bool
+	err := mc.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		outdated, err = services.AckLocalAuthList(tx, connector.ID, report.Version, report.Status != "failed", time.Now())
+		return err
+	})
+	if err != nil {
+		log.Printf("Error recording auth list report of %s: %v", connectorTopic, err)
+		return
+	}
+	if outdated {
+		if err := mc.SyncLocalAuthList(connector, true); err != nil {
+			log.Printf("⚠️  Failed to resend auth list to %s: %v", connectorTopic, err)
+		}
+	}
+}
+
+// recordOfflineSession bills a session the charger ran offline and answers
+// with an OFFLINE_SESSION_ACK command, accepted or rejected. Database
+// errors go unanswered so the charger reports the session again.
+func (mc *MQTTClient) recordOfflineSession(connectorTopic string, report services.OfflineSession) {
+	var connector models.Connector
+	if err := mc.db.First(&connector, "mqtt_topic = ?", connectorTopic).Error; err != nil {
+		log.Printf("Offline session report from unknown charger %s", connectorTopic)
+		return
+	}
+
+	var session *models.ChargingSession
+	var created bool
+	err := mc.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		session, created, err = services.RecordOfflineSession(tx, connector, report, time.Now())
+		return err
+	})
+
+	reply := ChargerCommand{Action: "OFFLINE_SESSION_ACK", OfflineID: report.OfflineID, Status: "accepted"}
+	switch {
+	case errors.Is(err, services.ErrOfflineSessionInvalid), errors.Is(err, services.ErrTokenUnknown),
+		errors.Is(err, services.ErrOfflineTokenNotListed):
+		log.Printf("⚠️  Offline session %s at %s rejected: %v", report.OfflineID, connectorTopic, err)
+		reply.Status = "rejected"
+	case err != nil:
+		log.Printf("Error recording offline session %s at %s: %v", report.OfflineID, connectorTopic, err)
+		return
+	default:
+		reply.SessionID = session.ID.String()
+	}
+	if err := mc.SendCommand(connectorTopic, reply); err != nil {
+		log.Printf("Error acknowledging offline session %s at %s: %v", report.OfflineID, connectorTopic, err)
+	}
+
+	if created {
+		log.Printf("📴 Offline session %s at %s billed as %s", report.OfflineID, connectorTopic, session.ID)
+		mc.BroadcastSessionStatus(session)
+		mc.notifyBalance(session)
+		mc.afterSettle(session)
+	}
+}
@@ -0,0 +1,114 @@
+package mqttclient
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
+	"github.com/Julianarwansah/sistemcharging/backend/internal/services"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// StartSession sends START for a paid or scheduled session, marks the
+// connector in use and the session charging, and broadcasts the change.
+// The session must have its Connector loaded. The session is claimed with
+// a conditional update, so one cancelled or started elsewhere in the
+// meantime returns services.ErrSessionNotWaiting. The connector must be
+// available, or reserved when a scheduled session starts; otherwise
+// services.ErrConnectorUnavailable is returned and nothing changes. When
+// START cannot be sent, the session and connector are put back as they
+// were.
+func (mc *MQTTClient) StartSession(session *models.ChargingSession) error {
+	now := time.Now()
+	from := session.Status
+	var connectorFrom models.ConnectorStatus
+	err := mc.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.ChargingSession{}).Where("id = ? AND status = ?", session.ID, from).
+			Updates(map[string]interface{}{"status": models.SessionPaid, "started_at": now})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return services.ErrSessionNotWaiting
+		}
+
+		var connector models.Connector
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "status").
+			First(&connector, "id = ?", session.ConnectorID).Error; err != nil {
+			return err
+		}
+		connectorFrom = connector.Status
+
+		// Only a scheduled session may take the connector it reserved
+		claimable := []models.ConnectorStatus{models.ConnectorAvailable}
+		if from == models.SessionScheduled {
+			claimable = append(claimable, models.ConnectorReserved)
+		}
+		result = tx.Model(&models.Connector{}).Where("id = ? AND status IN ?", session.ConnectorID, claimable).
+			Update("status", models.ConnectorInUse)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return services.ErrConnectorUnavailable
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	session.Status = models.SessionPaid
+	session.StartedAt = &now
+	session.Connector.Status = models.ConnectorInUse
+
+	// Send START command via MQTT
+	err = mc.SendCommand(session.Connector.MQTTTopic, ChargerCommand{
+		Action:    "START",
+		SessionID: session.ID.String(),
+		TargetKWH: session.TargetKWH,
+	})
+	if err != nil {
+		rollback := mc.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&models.ChargingSession{}).Where("id = ? AND status = ?", session.ID, models.SessionPaid).
+				Updates(map[string]interface{}{"status": from, "started_at": nil}).Error; err != nil {
+				return err
+			}
+			return tx.Model(&models.Connector{}).Where("id = ? AND status = ?", session.ConnectorID, models.ConnectorInUse).
+				Update("status", connectorFrom).Error
+		})
+		if rollback != nil {
+			log.Printf("⚠️  Failed to restore session %s after START failed: %v", session.ID, rollback)
+		}
+		session.Status = from
+		session.StartedAt = nil
+		session.Connector.Status = connectorFrom
+		return err
+	}
+
+	// The charger has been told to start, so a failure here is only logged;
+	// its first status report marks the session charging as well
+	session.Status = models.SessionCharging
+	if err := mc.db.Model(&models.ChargingSession{}).Where("id = ? AND status = ?", session.ID, models.SessionPaid).
+		Update("status", models.SessionCharging).Error; err != nil {
+		log.Printf("⚠️  Failed to mark session %s charging: %v", session.ID, err)
+	}
+
+	mc.BroadcastSessionStatus(session)
+	return nil
+}
+
+// BroadcastSessionStatus notifies the session, its owner and the admin
+// dashboard about a session status change.
+func (mc *MQTTClient) BroadcastSessionStatus(session *models.ChargingSession) {
+	wsData, _ := json.Marshal(map[string]interface{}{
+		"session_id":         session.ID,
+		"status":             session.Status,
+		"user_id":            session.UserID,
+		"scheduled_start_at": session.ScheduledAt,
+	})
+	mc.hub.Broadcast(session.ID.String(), wsData)
+	mc.hub.Broadcast(session.UserID.String(), wsData)
+	mc.hub.Broadcast("admin", wsData)
+}
@@ -0,0 +1,252 @@
+package receipt
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
+)
+
+// Columns of the receipt, in points from the left edge.
+const (
+	valueX    = 180.0
+	quantityX = 420.0
+	amountX   = pageWidth - margin
+)
+
+var months = [...]string{"Jan", "Feb", "Mar", "Apr", "Mei", "Jun", "Jul", "Agu", "Sep", "Okt", "Nov", "Des"}
+
+var stopReasons = map[models.StopReason]string{
+	models.StopTargetKWH:   "Target energi tercapai",
+	models.StopMaxCost:     "Batas biaya tercapai",
+	models.StopMaxDuration: "Batas durasi tercapai",
+	models.StopTargetSoC:   "Target baterai tercapai",
+	models.StopUser:        "Dihentikan pengguna",
+	models.StopCharger:     "Selesai oleh charger",
+	models.StopUnplugged:   "Kabel dicabut",
+	models.StopError:       "Gangguan charger",
+}
+
+// Document is everything a receipt shows. The session must have its User,
+// Connector.Station and LineItems loaded; Tariff is the one it was billed
+// under. Organization is set for fleet sessions.
+type Document struct {
+	Issuer       string // System name printed as the receipt's header
+	Receipt      models.Receipt
+	Session      models.ChargingSession
+	Tariff       models.Tariff
+	Payment      *models.Payment
+	Organization *models.Organization
+	Location     *time.Location
+}
+
+// Filename is the name the receipt is downloaded and attached as.
+func (d Document) Filename() string {
+	return "kwitansi-" + d.Receipt.Number + ".pdf"
+}
+
+// PaymentMethod describes how the session was paid.
+func (d Document) PaymentMethod() string {
+	switch {
+	case d.Organization != nil:
+		return "Wallet organisasi " + d.Organization.Name
+	case d.Payment == nil || d.Payment.PaymentGateway == "wallet":
+		return "Saldo wallet"
+	}
+	method := strings.ToUpper(strings.ReplaceAll(d.Payment.PaymentMethod, "_", " "))
+	return method + " (" + d.Payment.PaymentGateway + ")"
+}
+
+// Summary is a short plain text note on the receipt, e.g. for the e-mail it
+// is attached to.
+func (d Document) Summary() string {
+	s := d.Session
+	ended := d.Receipt.IssuedAt
+	if s.EndedAt != nil {
+		ended = *s.EndedAt
+	}
+	return fmt.Sprintf("Halo %s,\n\n"+
+		"Terlampir kwitansi %s untuk pengisian di %s pada %s.\n"+
+		"Energi: %s kWh\nTotal: %s\n\n"+
+		"Terima kasih telah menggunakan %s.\n",
+		s.User.Name, d.Receipt.Number, s.Connector.Station.Name, formatTime(ended, d.Location),
+		formatDecimal(s.EnergyKWH, 3), formatRupiah(s.TotalCost), d.Issuer)
+}
+
+// Render returns the receipt as a PDF.
+func Render(d Document) []byte {
+	s := d.Session
+	p := newPDF()
+
+	// Header
+	p.newline(16)
+	p.text(margin, d.Issuer, 16, true)
+	p.textRight(amountX, "KWITANSI", 16, true)
+	p.newline(18)
+	p.text(margin, "Kwitansi pengisian kendaraan listrik", 10, false)
+	p.textRight(amountX, "No. "+d.Receipt.Number, 10, true)
+	p.newline(14)
+	p.textRight(amountX, "Diterbitkan "+formatTime(d.Receipt.IssuedAt, d.Location), 9, false)
+	p.rule(1)
+	p.newline(10)
+
+	field := func(label, value string) {
+		lines := wrap(value, 10, amountX-valueX)
+		for i, line := range lines {
+			p.newline(14)
+			if i == 0 {
+				p.text(margin, label, 10, false)
+			}
+			p.text(valueX, line, 10, false)
+		}
+	}
+	section := func(title string) {
+		p.newline(22)
+		p.text(margin, title, 11, true)
+		p.rule(0.5)
+		p.newline(4)
+	}
+
+	section("Pelanggan")
+	field("Nama", s.User.Name)
+	field("E-mail", s.User.Email)
+	if d.Organization != nil {
+		field("Organisasi", d.Organization.Name)
+	}
+	if s.VehiclePlate != "" {
+		field("Kendaraan", s.VehiclePlate)
+	}
+
+	section("Lokasi pengisian")
+	station := s.Connector.Station
+	field("Stasiun", station.Name)
+	field("Alamat", station.Address)
+	field("Konektor", fmt.Sprintf("%s, %s kW", s.Connector.ConnectorType, formatDecimal(s.Connector.PowerKW, 0)))
+
+	section("Sesi")
+	field("ID sesi", s.ID.String())
+	if s.StartedAt != nil {
+		field("Mulai", formatTime(*s.StartedAt, d.Location))
+	}
+	if s.EndedAt != nil {
+		field("Selesai", formatTime(*s.EndedAt, d.Location))
+		if s.StartedAt != nil {
+			field("Durasi", formatDuration(s.EndedAt.Sub(*s.StartedAt)))
+		}
+	}
+	field("Energi", formatDecimal(s.EnergyKWH, 3)+" kWh")
+	if reason, ok := stopReasons[s.StopReason]; ok {
+		field("Alasan berhenti", reason)
+	}
+
+	section("Tarif")
+	field("Nama tarif", d.Tariff.Name)
+	field("Harga energi", formatRupiah(d.Tariff.PricePerKWH)+" / kWh")
+	if d.Tariff.PricePerMinute > 0 {
+		field("Harga waktu", formatRupiah(d.Tariff.PricePerMinute)+" / menit")
+	}
+	if d.Tariff.StartFee > 0 {
+		field("Biaya awal", formatRupiah(d.Tariff.StartFee))
+	}
+	if len(d.Tariff.Bands) > 0 {
+		field("", "Harga berbeda berlaku pada jam tertentu; rincian di bawah sudah memperhitungkannya.")
+	}
+
+	section("Rincian biaya")
+	for _, item := range s.LineItems {
+		p.newline(14)
+		p.text(margin, item.Description, 10, false)
+		if item.Unit != "" && item.Type != models.LineTax {
+			p.textRight(quantityX, formatDecimal(item.Quantity, quantityPlaces(item.Unit))+" "+item.Unit, 10, false)
+		}
+		p.textRight(amountX, formatRupiah(item.Amount), 10, false)
+	}
+	p.rule(0.5)
+	p.newline(20)
+	p.text(margin, "Total", 11, true)
+	p.textRight(amountX, formatRupiah(s.TotalCost), 11, true)
+	if d.Payment != nil && d.Payment.RefundedAmount > 0 {
+		p.newline(14)
+		p.text(margin, "Dikembalikan", 10, false)
+		p.textRight(amountX, formatRupiah(-d.Payment.RefundedAmount), 10, false)
+		p.newline(14)
+		p.text(margin, "Total setelah pengembalian", 10, true)
+		p.textRight(amountX, formatRupiah(s.TotalCost-d.Payment.RefundedAmount), 10, true)
+	}
+
+	section("Pembayaran")
+	field("Metode", d.PaymentMethod())
+	if d.Payment != nil {
+		field("Status", paymentStatus(d.Payment.Status))
+		if d.Payment.PaidAt != nil {
+			field("Dibayar", formatTime(*d.Payment.PaidAt, d.Location))
+		}
+	}
+
+	p.newline(36)
+	p.text(margin, "Kwitansi ini dibuat secara elektronik dan sah tanpa tanda tangan.", 8, false)
+	return p.Bytes("Kwitansi " + d.Receipt.Number)
+}
+
+func paymentStatus(status models.PaymentStatus) string {
+	switch status {
+	case models.PaymentSuccess:
+		return "Lunas"
+	case models.PaymentRefunded:
+		return "Dikembalikan"
+	case models.PaymentPartiallyRefunded:
+		return "Dikembalikan sebagian"
+	}
+	return string(status)
+}
+
+func quantityPlaces(unit string) int {
+	if unit == "kWh" {
+		return 3
+	}
+	return 0
+}
+
+// formatRupiah formats an amount the Indonesian way, e.g. "Rp 12.500" or
+// "-Rp 1.250,50".
+func formatRupiah(m models.Money) string {
+	sign := ""
+	minor := m.Minor()
+	if minor < 0 {
+		sign = "-"
+		minor = -minor
+	}
+
+	digits := strconv.FormatInt(minor/100, 10)
+	var b strings.Builder
+	for i, d := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteByte('.')
+		}
+		b.WriteRune(d)
+	}
+	if cents := minor % 100; cents != 0 {
+		fmt.Fprintf(&b, ",%02d", cents)
+	}
+	return sign + "Rp " + b.String()
+}
+
+// formatDecimal formats a number with a decimal comma.
+func formatDecimal(f float64, places int) string {
+	return strings.Replace(strconv.FormatFloat(f, 'f', places, 64), ".", ",", 1)
+}
+
+func formatTime(t time.Time, loc *time.Location) string {
+	t = t.In(loc)
+	return fmt.Sprintf("%d %s %d %s", t.Day(), months[t.Month()-1], t.Year(), t.Format("15:04 MST"))
+}
+
+func formatDuration(d time.Duration) string {
+	minutes := int(d.Round(time.Minute).Minutes())
+	if minutes < 60 {
+		return fmt.Sprintf("%d menit", minutes)
+	}
+	return fmt.Sprintf("%d jam %d menit", minutes/60, minutes%60)
+}
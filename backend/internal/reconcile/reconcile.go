@@ -0,0 +1,486 @@
+// Package reconcile cross-checks payments, charging sessions, wallet
+// transactions, wallet balances and the payment providers' records, reports
+// where they disagree and optionally applies the fixes that cannot move
+// money wrongly.
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Julianarwansah/sistemcharging/backend/internal/gateway"
+	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
+	"github.com/Julianarwansah/sistemcharging/backend/internal/services"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Kinds of mismatch.
+const (
+	SessionWithoutPayment   = "session_without_payment"   // Closed session with no payment record
+	PaymentWithoutDeduction = "payment_without_deduction" // Closed session never charged to the wallet
+	DuplicateDeduction      = "duplicate_deduction"       // Session charged to the wallet more than once
+	DeductionMismatch       = "deduction_mismatch"        // Wallet charge differs from the session total
+	PaymentAmountMismatch   = "payment_amount_mismatch"   // Payment amounts differ from the settled session
+	PaymentStatusMismatch   = "payment_status_mismatch"   // Payment status does not match the session outcome
+	PaymentWithoutCredit    = "payment_without_credit"    // Paid top-up or direct pay never credited to the wallet
+	BalanceMismatch         = "balance_mismatch"          // User balance differs from their wallet account
+	LedgerAccountMismatch   = "ledger_account_mismatch"   // Cached account balance differs from its entries
+	UnbalancedLedger        = "unbalanced_ledger"         // Ledger transaction whose debits and credits differ
+	GatewayStatusMismatch   = "gateway_status_mismatch"   // Provider reports a different payment outcome
+	GatewayAmountMismatch   = "gateway_amount_mismatch"   // Provider reports a different paid amount
+	GatewayError            = "gateway_error"             // Provider status query failed
+)
+
+// pendingGrace is how long a pending payment may still receive its
+// callback; younger ones are not checked against the provider.
+const pendingGrace = 15 * time.Minute
+
+// Options selects what Run checks.
+type Options struct {
+	// Since limits the payment and session checks to records created after
+	// it; the zero time checks everything. Balances are always checked.
+	Since time.Time
+	// Payments enables the provider cross-check; nil skips it.
+	Payments *gateway.Registry
+	// Fix applies the safe fixes.
+	Fix bool
+}
+
+// Issue is one mismatch. Fixable issues are corrected by Run with Fix set:
+// payment records copied from the settled session they mirror, cached
+// balances rebuilt from ledger entries, opening entries posted for balances
+// that predate the ledger, and pending payments completed with the state
+// their provider confirms. Everything else needs a person.
+type Issue struct {
+	Kind      string     `json:"kind"`
+	PaymentID *uuid.UUID `json:"payment_id,omitempty"`
+	SessionID *uuid.UUID `json:"session_id,omitempty"`
+	UserID    *uuid.UUID `json:"user_id,omitempty"`
+	Account   string     `json:"account,omitempty"`
+	Detail    string     `json:"detail"`
+	Fixable   bool       `json:"fixable"`
+	Fixed     bool       `json:"fixed"`
+	FixError  string     `json:"fix_error,omitempty"`
+
+	fix func(tx *gorm.DB) error
+}
+
+// Report is the result of Run.
+type Report struct {
+	OK             bool       `json:"ok"` // No issues left unfixed
+	CheckedAt      time.Time  `json:"checked_at"`
+	Since          *time.Time `json:"since,omitempty"`
+	Sessions       int        `json:"sessions"`        // Closed sessions checked
+	GatewayChecked int        `json:"gateway_checked"` // Payments checked with their provider
+	Fixed          int        `json:"fixed"`
+	Issues         []Issue    `json:"issues"`
+}
+
+// Run checks the records and, with opts.Fix, applies the safe fixes. Each
+// fix runs in its own transaction and re-checks the record it changes, so
+// a fix racing live traffic is skipped rather than applied twice.
+func Run(ctx context.Context, db *gorm.DB, opts Options, now time.Time) (*Report, error) {
+	report := &Report{CheckedAt: now, Issues: []Issue{}}
+	if !opts.Since.IsZero() {
+		report.Since = &opts.Since
+	}
+
+	if err := checkSessions(db, opts.Since, report); err != nil {
+		return nil, err
+	}
+	if err := checkCredits(db, opts.Since, report); err != nil {
+		return nil, err
+	}
+	if err := checkLedger(db, now, report); err != nil {
+		return nil, err
+	}
+	if opts.Payments != nil {
+		if err := checkGateway(ctx, db, opts.Payments, opts.Since, now, report); err != nil {
+			return nil, err
+		}
+	}
+
+	report.OK = true
+	for i := range report.Issues {
+		issue := &report.Issues[i]
+		if opts.Fix && issue.fix != nil {
+			if err := db.Transaction(issue.fix); err != nil {
+				issue.FixError = err.Error()
+			} else {
+				issue.Fixed = true
+				report.Fixed++
+			}
+		}
+		report.OK = report.OK && issue.Fixed
+	}
+	return report, nil
+}
+
+func (r *Report) add(issue Issue) {
+	issue.Fixable = issue.fix != nil
+	r.Issues = append(r.Issues, issue)
+}
+
+// sessionRow is a closed session with its payment and wallet charges.
+type sessionRow struct {
+	SessionID     uuid.UUID
+	UserID        uuid.UUID
+	Status        models.SessionStatus
+	TotalCost     models.Money
+	Discount      models.Money
+	ServiceFee    models.Money
+	Tax           models.Money
+	PaymentID     *uuid.UUID
+	PaymentStatus models.PaymentStatus
+	Amount        models.Money
+	PayDiscount   models.Money
+	PayServiceFee models.Money
+	PayTax        models.Money
+	Deductions    int
+	Deducted      models.Money
+}
+
+// checkSessions compares every closed session with its payment and the
+// wallet deductions settlement posted for it.
+func checkSessions(db *gorm.DB, since time.Time, report *Report) error {
+	var rows []sessionRow
+	if err := db.Table("charging_sessions s").
+		Select(`s.id AS session_id, s.user_id, s.status, s.total_cost, s.discount, s.service_fee, s.tax,
+			p.id AS payment_id, p.status AS payment_status, p.amount, p.discount AS pay_discount,
+			p.service_fee AS pay_service_fee, p.tax AS pay_tax,
+			COALESCE(d.deductions, 0) AS deductions, COALESCE(d.deducted, 0) AS deducted`).
+		Joins("LEFT JOIN payments p ON p.session_id = s.id AND p.deleted_at IS NULL").
+		Joins(`LEFT JOIN (SELECT session_id, COUNT(*) AS deductions, SUM(amount) AS deducted
+			FROM wallet_transactions WHERE transaction_type = ? GROUP BY session_id) d ON d.session_id = s.id`,
+			models.TransactionDeduction).
+		Where("s.deleted_at IS NULL AND s.status IN ? AND s.created_at >= ?",
+			[]models.SessionStatus{models.SessionCompleted, models.SessionFailed, models.SessionCancelled}, since).
+		Scan(&rows).Error; err != nil {
+		return err
+	}
+	report.Sessions = len(rows)
+
+	for _, row := range rows {
+		sessionID, userID := row.SessionID, row.UserID
+		issue := Issue{SessionID: &sessionID, UserID: &userID, PaymentID: row.PaymentID}
+
+		if row.Status == models.SessionCancelled {
+			// A cancelled session is never charged and neither is its payment
+			if row.Deductions > 0 {
+				issue.Kind = DeductionMismatch
+				issue.Detail = fmt.Sprintf("Sesi dibatalkan tetapi dompet dipotong Rp %s", row.Deducted)
+				report.add(issue)
+			} else if row.PaymentID != nil && row.PaymentStatus == models.PaymentSuccess {
+				issue.Kind = PaymentStatusMismatch
+				issue.Detail = "Sesi dibatalkan tetapi pembayarannya berstatus success"
+				issue.fix = setPaymentStatus(*row.PaymentID, row.PaymentStatus, models.PaymentCancelled)
+				report.add(issue)
+			}
+			continue
+		}
+
+		if row.PaymentID == nil {
+			issue.Kind = SessionWithoutPayment
+			issue.Detail = fmt.Sprintf("Sesi %s tanpa data pembayaran (total Rp %s)", row.Status, row.TotalCost)
+			report.add(issue)
+		}
+
+		charged := row.Deductions == 1 && row.Deducted == row.TotalCost
+		switch {
+		case row.Deductions == 0:
+			issue.Kind = PaymentWithoutDeduction
+			issue.Detail = fmt.Sprintf("Sesi %s senilai Rp %s tidak pernah dipotong dari dompet", row.Status, row.TotalCost)
+			report.add(issue)
+		case row.Deductions > 1:
+			issue.Kind = DuplicateDeduction
+			issue.Detail = fmt.Sprintf("Dompet dipotong %d kali (Rp %s) untuk sesi senilai Rp %s", row.Deductions, row.Deducted, row.TotalCost)
+			report.add(issue)
+		case !charged:
+			issue.Kind = DeductionMismatch
+			issue.Detail = fmt.Sprintf("Dompet dipotong Rp %s untuk sesi senilai Rp %s", row.Deducted, row.TotalCost)
+			report.add(issue)
+		}
+		if row.PaymentID == nil {
+			continue
+		}
+
+		// The payment mirrors the settlement, so once the wallet charge is
+		// confirmed it can be rewritten from the session
+		switch row.PaymentStatus {
+		case models.PaymentSuccess, models.PaymentRefunded, models.PaymentPartiallyRefunded:
+		default:
+			issue.Kind = PaymentStatusMismatch
+			issue.Detail = fmt.Sprintf("Sesi %s tetapi pembayarannya berstatus %s", row.Status, row.PaymentStatus)
+			issue.fix = nil
+			if charged {
+				issue.fix = setPaymentStatus(*row.PaymentID, row.PaymentStatus, models.PaymentSuccess)
+			}
+			report.add(issue)
+		}
+
+		if row.Amount != row.TotalCost || row.PayDiscount != row.Discount ||
+			row.PayServiceFee != row.ServiceFee || row.PayTax != row.Tax {
+			issue.Kind = PaymentAmountMismatch
+			issue.Detail = fmt.Sprintf("Pembayaran Rp %s (diskon %s, layanan %s, pajak %s), sesi Rp %s (diskon %s, layanan %s, pajak %s)",
+				row.Amount, row.PayDiscount, row.PayServiceFee, row.PayTax,
+				row.TotalCost, row.Discount, row.ServiceFee, row.Tax)
+			issue.fix = nil
+			if charged {
+				issue.fix = copySessionAmounts(*row.PaymentID, sessionID)
+			}
+			report.add(issue)
+		}
+	}
+	return nil
+}
+
+func setPaymentStatus(paymentID uuid.UUID, from, to models.PaymentStatus) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		result := tx.Model(&models.Payment{}).Where("id = ? AND status = ?", paymentID, from).Update("status", to)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("pembayaran sudah berubah")
+		}
+		return nil
+	}
+}
+
+func copySessionAmounts(paymentID, sessionID uuid.UUID) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		var session models.ChargingSession
+		if err := tx.Select("total_cost", "discount", "service_fee", "tax").
+			First(&session, "id = ?", sessionID).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Payment{}).Where("id = ?", paymentID).Updates(map[string]interface{}{
+			"amount":      session.TotalCost,
+			"discount":    session.Discount,
+			"service_fee": session.ServiceFee,
+			"tax":         session.Tax,
+		}).Error
+	}
+}
+
+// checkCredits finds payments confirmed by a provider whose money never
+// reached the wallet.
+func checkCredits(db *gorm.DB, since time.Time, report *Report) error {
+	var payments []models.Payment
+	if err := db.Where("paid_at IS NOT NULL AND (purpose = ? OR prepaid_amount > 0) AND created_at >= ?",
+		models.PurposeTopUp, since).
+		Where("NOT EXISTS (?)", db.Table("wallet_transactions w").Select("1").
+			Where("w.reference_id = payments.id::text AND w.transaction_type IN ?",
+				[]models.TransactionType{models.TransactionTopUp, models.TransactionAutoTopUp})).
+		Find(&payments).Error; err != nil {
+		return err
+	}
+
+	for _, payment := range payments {
+		paymentID, userID := payment.ID, payment.UserID
+		amount := payment.Amount
+		if payment.PrepaidAmount > 0 {
+			amount = payment.PrepaidAmount
+		}
+		report.add(Issue{
+			Kind:      PaymentWithoutCredit,
+			PaymentID: &paymentID,
+			SessionID: payment.SessionID,
+			UserID:    &userID,
+			Detail:    fmt.Sprintf("Pembayaran %s Rp %s via %s tidak masuk ke dompet", payment.Purpose, amount, payment.PaymentGateway),
+		})
+	}
+	return nil
+}
+
+// checkLedger reports ledger inconsistencies. Cached balances are rebuilt
+// from the entries, which are the record of every posting.
+func checkLedger(db *gorm.DB, now time.Time, report *Report) error {
+	ledger, err := services.ReconcileLedger(db, now)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ledger.UnbalancedTransactions {
+		report.add(Issue{Kind: UnbalancedLedger, Detail: "Transaksi ledger " + id.String() + " tidak seimbang"})
+	}
+	for _, m := range ledger.AccountMismatches {
+		report.add(Issue{
+			Kind:    LedgerAccountMismatch,
+			Account: m.Code,
+			Detail:  fmt.Sprintf("Saldo akun Rp %s, jumlah mutasi Rp %s", m.Cached, m.Ledger),
+			fix:     rebuildAccountBalance(m.AccountID),
+		})
+	}
+	for _, m := range ledger.WalletMismatches {
+		userID := m.UserID
+		// A balance from before the ledger gets its opening entry; syncing
+		// it would wipe the balance
+		if m.Unopened {
+			report.add(Issue{
+				Kind:    BalanceMismatch,
+				UserID:  &userID,
+				Account: services.WalletAccountCode(userID),
+				Detail:  fmt.Sprintf("Saldo user Rp %s belum tercatat di ledger (belum ada akun dompet)", m.Cached),
+				fix:     openWallet(userID),
+			})
+			continue
+		}
+		report.add(Issue{
+			Kind:    BalanceMismatch,
+			UserID:  &userID,
+			Account: services.WalletAccountCode(userID),
+			Detail:  fmt.Sprintf("Saldo user Rp %s, saldo dompet di ledger Rp %s", m.Cached, m.Ledger),
+			fix:     syncUserBalance(userID),
+		})
+	}
+	return nil
+}
+
+// rebuildAccountBalance sets an account's cached balance, and the user's
+// balance for a wallet, to the sum of its entries. The account is locked
+// like Post does, so no posting lands in between.
+func rebuildAccountBalance(accountID uuid.UUID) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		var account models.LedgerAccount
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&account, "id = ?", accountID).Error; err != nil {
+			return err
+		}
+		var debits, credits models.Money
+		if err := tx.Model(&models.LedgerEntry{}).Where("account_id = ?", accountID).
+			Select("COALESCE(SUM(debit), 0), COALESCE(SUM(credit), 0)").
+			Row().Scan(&debits, &credits); err != nil {
+			return err
+		}
+		balance := credits - debits
+		if account.Type.DebitNormal() {
+			balance = -balance
+		}
+
+		if err := tx.Model(&account).Update("balance", balance).Error; err != nil {
+			return err
+		}
+		if account.UserID != nil {
+			return tx.Model(&models.User{}).Where("id = ?", *account.UserID).Update("balance", balance).Error
+		}
+		return nil
+	}
+}
+
+// syncUserBalance copies a user's wallet account balance to User.Balance.
+// It fails for a user without a wallet account rather than zeroing their
+// balance.
+func syncUserBalance(userID uuid.UUID) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		var account models.LedgerAccount
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&account, "user_id = ?", userID).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.User{}).Where("id = ?", userID).Update("balance", account.Balance).Error
+	}
+}
+
+// openWallet records a balance that predates the ledger as the opening
+// entry of the user's wallet account, keeping the balance as it is.
+func openWallet(userID uuid.UUID) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		return services.OpenWallet(tx, userID)
+	}
+}
+
+// checkGateway asks each payment's provider for its state. Wallet payments
+// have no provider and the dummy provider keeps no records, so both are
+// skipped, as are providers that are not enabled.
+func checkGateway(ctx context.Context, db *gorm.DB, payments *gateway.Registry, since, now time.Time, report *Report) error {
+	var records []models.Payment
+	if err := db.Where("payment_gateway NOT IN ? AND external_id <> '' AND created_at >= ?",
+		[]string{"wallet", "dummy"}, since).
+		Where("status <> ? OR created_at < ?", models.PaymentPending, now.Add(-pendingGrace)).
+		Order("created_at").Find(&records).Error; err != nil {
+		return err
+	}
+
+	for _, payment := range records {
+		provider, err := payments.Provider(payment.PaymentGateway)
+		if err != nil {
+			continue
+		}
+		report.GatewayChecked++
+
+		paymentID, userID := payment.ID, payment.UserID
+		issue := Issue{PaymentID: &paymentID, SessionID: payment.SessionID, UserID: &userID}
+
+		remote, err := provider.Status(ctx, payment.ExternalID)
+		if err != nil {
+			issue.Kind = GatewayError
+			issue.Detail = fmt.Sprintf("Status %s tidak dapat diperiksa: %v", provider.Name(), err)
+			report.add(issue)
+			continue
+		}
+
+		localPaid := payment.PaidAt != nil
+		remotePaid := remote.Result == gateway.ResultPaid
+		switch {
+		case localPaid && remotePaid:
+			if remote.Amount != payment.Amount && remote.Amount != payment.PrepaidAmount {
+				issue.Kind = GatewayAmountMismatch
+				issue.Detail = fmt.Sprintf("%s mencatat Rp %s, pembayaran Rp %s", provider.Name(), remote.Amount, payment.Amount)
+				report.add(issue)
+			}
+		case localPaid:
+			issue.Kind = GatewayStatusMismatch
+			issue.Detail = fmt.Sprintf("Pembayaran sudah dikreditkan tetapi %s mencatat %s", provider.Name(), remote.Result)
+			report.add(issue)
+		case remotePaid || (remote.Result != gateway.ResultPending && payment.Status == models.PaymentPending):
+			issue.Kind = GatewayStatusMismatch
+			issue.Detail = fmt.Sprintf("Pembayaran %s tetapi %s mencatat %s", payment.Status, provider.Name(), remote.Result)
+			// The callback never arrived: apply the confirmed state the way
+			// it would have, as long as the payment can still take it
+			if payment.Status == models.PaymentPending || (payment.Status == models.PaymentCancelled && payment.PrepaidAmount > 0) {
+				issue.fix = completePayment(payment.ID, provider.Name(), remote, now)
+			}
+			report.add(issue)
+		}
+	}
+	return nil
+}
+
+// completePayment applies a provider-confirmed state like the callback
+// does. A direct-pay session is not started this late; it is cancelled and
+// its payment stays in the wallet.
+func completePayment(paymentID uuid.UUID, provider string, remote *gateway.Status, at time.Time) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		payment, changed, err := services.CompletePayment(tx, paymentID, services.PaymentUpdate{
+			Gateway:      provider,
+			Status:       remote.Result.PaymentStatus(),
+			Amount:       remote.Amount,
+			Reference:    remote.Reference,
+			CallbackData: "reconciliation",
+		}, at)
+		if err != nil {
+			return err
+		}
+		if !changed {
+			return fmt.Errorf("pembayaran sudah berubah")
+		}
+		if payment.SessionID == nil || payment.Status != models.PaymentSuccess {
+			return nil
+		}
+
+		var session models.ChargingSession
+		if err := tx.First(&session, "id = ?", *payment.SessionID).Error; err != nil {
+			return err
+		}
+		if session.Status != models.SessionPending {
+			return nil
+		}
+		if err := services.CancelSession(tx, &session, at); err != nil && !errors.Is(err, services.ErrSessionNotWaiting) {
+			return err
+		}
+		return nil
+	}
+}
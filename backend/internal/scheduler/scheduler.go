@@ -0,0 +1,150 @@
+package scheduler
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
+	mqttclient "github.com/Julianarwansah/sistemcharging/backend/internal/mqtt"
+	"github.com/Julianarwansah/sistemcharging/backend/internal/services"
+	"gorm.io/gorm"
+)
+
+// defaultInterval is used when the configured interval is not positive.
+const defaultInterval = 30 * time.Second
+
+// Scheduler runs periodic background jobs: starting scheduled charging
+// sessions, cancelling unconfirmed ones, applying future-dated connector
+// price changes, issuing monthly organization invoices, syncing chargers'
+// local authorization lists and purging expired idempotency keys.
+type Scheduler struct {
+	db       *gorm.DB
+	mqtt     *mqttclient.MQTTClient
+	interval time.Duration
+	// pendingExpiry is how long a wallet-paid session may wait for the user
+	// to confirm its payment
+	pendingExpiry time.Duration
+}
+
+func NewScheduler(db *gorm.DB, mqtt *mqttclient.MQTTClient, interval, pendingExpiry time.Duration) *Scheduler {
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+	return &Scheduler{
+		db:            db,
+		mqtt:          mqtt,
+		interval:      interval,
+		pendingExpiry: pendingExpiry,
+	}
+}
+
+// Start launches the scheduler loop in the background.
+func (s *Scheduler) Start() {
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		log.Printf("⏰ Scheduler running every %s", s.interval)
+		for range ticker.C {
+			s.applyDuePriceChanges()
+			s.startDueSessions()
+			s.expirePendingSessions()
+			s.issueInvoices()
+			s.mqtt.SyncLocalAuthLists()
+			s.purgeIdempotencyKeys()
+		}
+	}()
+}
+
+func (s *Scheduler) startDueSessions() {
+	var sessions []models.ChargingSession
+	if err := s.db.Preload("Connector").
+		Where("status = ? AND scheduled_at <= ?", models.SessionScheduled, time.Now()).
+		Find(&sessions).Error; err != nil {
+		log.Printf("⚠️  Scheduler failed to load scheduled sessions: %v", err)
+		return
+	}
+
+	for i := range sessions {
+		session := &sessions[i]
+		// StartSession puts a session it could not start back on schedule,
+		// so it is retried on the next tick; one whose connector is still
+		// taken by an earlier session waits for it quietly
+		if err := s.mqtt.StartSession(session); err != nil {
+			if !errors.Is(err, services.ErrSessionNotWaiting) && !errors.Is(err, services.ErrConnectorUnavailable) {
+				log.Printf("⚠️  Failed to start scheduled session %s: %v", session.ID, err)
+			}
+			continue
+		}
+		log.Printf("⏰ Scheduled session %s started", session.ID)
+	}
+}
+
+// expirePendingSessions cancels sessions whose wallet payment was never
+// confirmed, releasing their reserved voucher use. A zero expiry keeps
+// them waiting.
+func (s *Scheduler) expirePendingSessions() {
+	if s.pendingExpiry <= 0 {
+		return
+	}
+	now := time.Now()
+	expired, err := services.ExpirePendingSessions(s.db, now.Add(-s.pendingExpiry), now)
+	if err != nil {
+		log.Printf("⚠️  Scheduler failed to expire pending sessions: %v", err)
+	}
+	for i := range expired {
+		s.mqtt.BroadcastSessionStatus(&expired[i])
+	}
+	if len(expired) > 0 {
+		log.Printf("⌛ Cancelled %d unconfirmed session(s)", len(expired))
+	}
+}
+
+func (s *Scheduler) applyDuePriceChanges() {
+	applied, err := services.ApplyDuePriceChanges(s.db, time.Now())
+	if err != nil {
+		log.Printf("⚠️  Scheduler failed to apply price changes: %v", err)
+	}
+	if applied > 0 {
+		log.Printf("💲 Applied %d scheduled price change(s)", applied)
+	}
+}
+
+// issueInvoices invoices the previous month for every organization that
+// existed then and has no invoice for it yet.
+func (s *Scheduler) issueInvoices() {
+	now := time.Now()
+	monthStart := services.MonthStart(s.db, now)
+	periodStart := monthStart.AddDate(0, -1, 0)
+
+	var orgs []models.Organization
+	if err := s.db.Where("created_at < ? AND NOT EXISTS (?)", monthStart,
+		s.db.Model(&models.Invoice{}).Select("1").
+			Where("invoices.organization_id = organizations.id AND invoices.period_start = ?", periodStart)).
+		Find(&orgs).Error; err != nil {
+		log.Printf("⚠️  Scheduler failed to load organizations to invoice: %v", err)
+		return
+	}
+
+	for i := range orgs {
+		org := &orgs[i]
+		var invoice *models.Invoice
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			var err error
+			invoice, err = services.GenerateInvoice(tx, org, periodStart, now)
+			return err
+		})
+		if err != nil {
+			log.Printf("⚠️  Failed to invoice organization %s: %v", org.ID, err)
+			continue
+		}
+		log.Printf("🧾 Issued invoice %s to %s (Rp %s)", invoice.Number, org.Name, invoice.Total)
+	}
+}
+
+func (s *Scheduler) purgeIdempotencyKeys() {
+	if err := s.db.Where("expires_at < ?", time.Now()).Delete(&models.IdempotencyKey{}).Error; err != nil {
+		log.Printf("⚠️  Scheduler failed to purge idempotency keys: %v", err)
+	}
+}
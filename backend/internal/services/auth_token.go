@@ -0,0 +1,174 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrTokenUnknown         = errors.New("token tidak dikenal")
+	ErrTokenBlocked         = errors.New("token diblokir")
+	ErrTokenExpired         = errors.New("token sudah kedaluwarsa")
+	ErrTokenNoCredit        = errors.New("saldo pemilik token tidak mencukupi")
+	ErrTokenConcurrent      = errors.New("pemilik token masih memiliki sesi charging aktif")
+	ErrConnectorUnavailable = errors.New("connector sedang tidak tersedia")
+)
+
+// AuthorizeToken looks up a token presented at a charger and checks that it
+// may start a session: it is neither blocked nor expired, its user is not
+// blocked, and the user of a fleet token is still an active member of an
+// active organization. The token is returned with the error when it exists.
+func AuthorizeToken(db *gorm.DB, uid string, now time.Time) (*models.AuthToken, error) {
+	var token models.AuthToken
+	err := db.Preload("User").First(&token, "uid = ?", models.NormalizeTokenUID(uid)).Error
+	if err == gorm.ErrRecordNotFound || (err == nil && token.User == nil) {
+		return nil, ErrTokenUnknown
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if token.Blocked || token.User.Status == "blocked" {
+		return &token, ErrTokenBlocked
+	}
+	if token.ExpiresAt != nil && !now.Before(*token.ExpiresAt) {
+		return &token, ErrTokenExpired
+	}
+	if token.OrganizationID != nil {
+		member, err := ActiveMembership(db, token.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if member == nil || member.OrganizationID != *token.OrganizationID || member.Organization.Status != "active" {
+			return &token, ErrTokenBlocked
+		}
+	}
+	return &token, nil
+}
+
+// AuthorizationStatus returns what a charger is told about an authorize
+// request that ended with err.
+func AuthorizationStatus(err error) models.AuthorizationStatus {
+	switch {
+	case err == nil:
+		return models.AuthAccepted
+	case errors.Is(err, ErrTokenBlocked):
+		return models.AuthBlocked
+	case errors.Is(err, ErrTokenExpired):
+		return models.AuthExpired
+	case errors.Is(err, ErrTokenNoCredit):
+		return models.AuthNoCredit
+	case errors.Is(err, ErrTokenConcurrent):
+		return models.AuthConcurrentTx
+	case errors.Is(err, ErrConnectorUnavailable):
+		return models.AuthUnavailable
+	}
+	return models.AuthInvalid
+}
+
+// CreateTokenSession creates the session of a token accepted at a
+// connector, billed to the token's user or organization. No limit is set at
+// the charger, so like a SoC-only session it is capped at what the payer
+// has available. Its payment is confirmed right away since nobody confirms
+// it in the app; the caller starts charging. It must be called inside a
+// transaction.
+func CreateTokenSession(tx *gorm.DB, token *models.AuthToken, connectorID uuid.UUID, now time.Time) (*models.ChargingSession, error) {
+	var connector models.Connector
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&connector, "id = ?", connectorID).Error; err != nil {
+		return nil, err
+	}
+	if connector.Status != models.ConnectorAvailable {
+		return nil, ErrConnectorUnavailable
+	}
+
+	var active int64
+	if err := tx.Model(&models.ChargingSession{}).
+		Where("user_id = ? AND status IN ?", token.UserID, activeSessionStatuses).
+		Count(&active).Error; err != nil {
+		return nil, err
+	}
+	if active > 0 {
+		return nil, ErrTokenConcurrent
+	}
+
+	session := models.ChargingSession{
+		UserID:         token.UserID,
+		ConnectorID:    connector.ID,
+		Status:         models.SessionPending,
+		OrganizationID: token.OrganizationID,
+		AuthTokenID:    &token.ID,
+	}
+
+	var available models.Money
+	if token.OrganizationID != nil {
+		member, err := ActiveMembership(tx, token.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if member == nil {
+			return nil, ErrTokenBlocked
+		}
+		available, err = MemberAllowance(tx, member, now)
+		if errors.Is(err, ErrOrgSuspended) {
+			return nil, ErrTokenBlocked
+		}
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		available, err = WalletBalance(tx, token.UserID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	tariff, err := ResolveTariff(tx, connector)
+	if err != nil {
+		return nil, err
+	}
+	if tariff.ID != uuid.Nil {
+		session.TariffID = &tariff.ID
+	}
+	session.Tariff = &tariff
+
+	if available <= 0 || available < tariff.MinPrice {
+		return nil, ErrTokenNoCredit
+	}
+	session.MaxCost = available
+	session.TotalCost = available
+
+	if err := tx.Create(&session).Error; err != nil {
+		return nil, err
+	}
+
+	payment := models.Payment{
+		UserID:         token.UserID,
+		Purpose:        models.PurposeSession,
+		SessionID:      &session.ID,
+		PaymentMethod:  "wallet",
+		PaymentGateway: "wallet",
+		ExternalID:     "WALLET-" + session.ID.String()[:8],
+		Amount:         available,
+		Status:         models.PaymentSuccess,
+		PaidAt:         &now,
+	}
+	if token.OrganizationID != nil {
+		payment.PaymentMethod = "organization"
+	}
+	if err := tx.Create(&payment).Error; err != nil {
+		return nil, err
+	}
+
+	if err := tx.Model(token).Update("last_used_at", now).Error; err != nil {
+		return nil, err
+	}
+
+	session.Connector = connector
+	return &session, nil
+}
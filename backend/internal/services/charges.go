@@ -0,0 +1,114 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// ChargeRules holds the tax and service fee settings applied on top of the
+// tariff price. They are read from the tax_name, tax_rate_percent,
+// service_fee_percent and service_fee_flat system settings.
+type ChargeRules struct {
+	TaxName           string       `json:"tax_name"`
+	TaxRate           float64      `json:"tax_rate_percent"`
+	ServiceFeePercent float64      `json:"service_fee_percent"`
+	ServiceFeeFlat    models.Money `json:"service_fee_flat"`
+}
+
+// LoadChargeRules reads the current tax and service fee settings. Missing
+// or invalid settings count as zero.
+func LoadChargeRules(tx *gorm.DB) ChargeRules {
+	var configs []models.SystemConfig
+	tx.Where("config_key IN ?", []string{"tax_name", "tax_rate_percent", "service_fee_percent", "service_fee_flat"}).
+		Find(&configs)
+
+	rules := ChargeRules{TaxName: "PPN"}
+	for _, cfg := range configs {
+		value, _ := strconv.ParseFloat(cfg.ConfigValue, 64)
+		switch cfg.ConfigKey {
+		case "tax_name":
+			if cfg.ConfigValue != "" {
+				rules.TaxName = cfg.ConfigValue
+			}
+		case "tax_rate_percent":
+			rules.TaxRate = value
+		case "service_fee_percent":
+			rules.ServiceFeePercent = value
+		case "service_fee_flat":
+			rules.ServiceFeeFlat, _ = models.ParseMoney(cfg.ConfigValue)
+		}
+	}
+	return rules
+}
+
+// Gross returns the service fee, tax and final amount for a net amount. The
+// service fee is only charged when there is something to bill, and tax is
+// levied on the net amount plus the service fee. Fee and tax are each
+// rounded to the minor unit.
+func (r ChargeRules) Gross(net models.Money) (serviceFee, tax, total models.Money) {
+	if net > 0 {
+		serviceFee = net.Percent(r.ServiceFeePercent) + r.ServiceFeeFlat
+		tax = (net + serviceFee).Percent(r.TaxRate)
+	}
+	return serviceFee, tax, net + serviceFee + tax
+}
+
+// ChargingCost returns the tariff price of the charging phase, before idle
+// fee, discount, service fee and tax.
+func ChargingCost(session *models.ChargingSession) models.Money {
+	return session.EnergyCost + session.TimeCost + session.StartFee + session.Adjustment
+}
+
+// ApplyCharges sets the service fee, tax and TotalCost of a session from its
+// priced components.
+func ApplyCharges(session *models.ChargingSession, rules ChargeRules) {
+	net := ChargingCost(session) + session.IdleFee - session.Discount
+	session.ServiceFee, session.Tax, session.TotalCost = rules.Gross(net)
+}
+
+// BuildLineItems returns the bill rows of a session from its current
+// amounts. Zero rows are left out except energy, which is always shown.
+func BuildLineItems(session *models.ChargingSession, rules ChargeRules) []models.SessionLineItem {
+	var items []models.SessionLineItem
+	add := func(t models.LineItemType, description string, quantity float64, unit string, amount models.Money) {
+		if amount == 0 && t != models.LineEnergy {
+			return
+		}
+		items = append(items, models.SessionLineItem{
+			SessionID:   session.ID,
+			Position:    len(items) + 1,
+			Type:        t,
+			Description: description,
+			Quantity:    quantity,
+			Unit:        unit,
+			Amount:      amount,
+		})
+	}
+
+	add(models.LineEnergy, "Energi", session.EnergyKWH, "kWh", session.EnergyCost)
+	add(models.LineTime, "Biaya waktu pengisian", 0, "", session.TimeCost)
+	add(models.LineStartFee, "Biaya awal sesi", 0, "", session.StartFee)
+	add(models.LineAdjustment, "Penyesuaian harga minimum/maksimum", 0, "", session.Adjustment)
+	add(models.LineIdle, "Biaya parkir (idle)", float64(session.IdleMinutes), "menit", session.IdleFee)
+	add(models.LineDiscount, "Diskon voucher", 0, "", -session.Discount)
+	add(models.LineServiceFee, "Biaya layanan", 0, "", session.ServiceFee)
+	add(models.LineTax, fmt.Sprintf("%s %s%%", rules.TaxName, strconv.FormatFloat(rules.TaxRate, 'f', -1, 64)), rules.TaxRate, "%", session.Tax)
+
+	return items
+}
+
+// SaveLineItems replaces the stored bill rows of a session.
+func SaveLineItems(tx *gorm.DB, session *models.ChargingSession, rules ChargeRules) error {
+	if err := tx.Where("session_id = ?", session.ID).Delete(&models.SessionLineItem{}).Error; err != nil {
+		return err
+	}
+	items := BuildLineItems(session, rules)
+	if err := tx.Create(&items).Error; err != nil {
+		return err
+	}
+	session.LineItems = items
+	return nil
+}
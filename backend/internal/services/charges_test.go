@@ -0,0 +1,76 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
+)
+
+func TestChargeRulesGross(t *testing.T) {
+	tests := []struct {
+		name           string
+		rules          ChargeRules
+		net            models.Money
+		wantServiceFee models.Money
+		wantTax        models.Money
+		wantTotal      models.Money
+	}{
+		{
+			name: "no tax or service fee",
+			net:  models.NewMoney(10000), wantTotal: models.NewMoney(10000),
+		},
+		{
+			name:  "tax only",
+			rules: ChargeRules{TaxRate: 11},
+			net:   models.NewMoney(10000), wantTax: models.NewMoney(1100), wantTotal: models.NewMoney(11100),
+		},
+		{
+			name:  "tax is levied on the service fee too",
+			rules: ChargeRules{TaxRate: 11, ServiceFeePercent: 5, ServiceFeeFlat: models.NewMoney(2000)},
+			net:   models.NewMoney(10000), wantServiceFee: models.NewMoney(2500), wantTax: models.NewMoney(1375), wantTotal: models.NewMoney(13875),
+		},
+		{
+			name:  "fee and tax are rounded to the minor unit",
+			rules: ChargeRules{TaxRate: 11, ServiceFeePercent: 2.5},
+			net:   models.NewMoney(333.33), wantServiceFee: models.NewMoney(8.33), wantTax: models.NewMoney(37.58), wantTotal: models.NewMoney(379.24),
+		},
+		{
+			name:  "nothing to bill",
+			rules: ChargeRules{TaxRate: 11, ServiceFeeFlat: models.NewMoney(2000)},
+			net:   0,
+		},
+		{
+			name:  "negative net is not grossed up",
+			rules: ChargeRules{TaxRate: 11, ServiceFeeFlat: models.NewMoney(2000)},
+			net:   models.NewMoney(-500), wantTotal: models.NewMoney(-500),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serviceFee, tax, total := tt.rules.Gross(tt.net)
+			if serviceFee != tt.wantServiceFee || tax != tt.wantTax || total != tt.wantTotal {
+				t.Errorf("Gross(%s) = %s, %s, %s; want %s, %s, %s",
+					tt.net, serviceFee, tax, total, tt.wantServiceFee, tt.wantTax, tt.wantTotal)
+			}
+		})
+	}
+}
+
+func TestApplyCharges(t *testing.T) {
+	session := models.ChargingSession{
+		EnergyCost: models.NewMoney(20000),
+		TimeCost:   models.NewMoney(3000),
+		StartFee:   models.NewMoney(2000),
+		Adjustment: models.NewMoney(-1000),
+		IdleFee:    models.NewMoney(5000),
+		Discount:   models.NewMoney(4000),
+	}
+	ApplyCharges(&session, ChargeRules{TaxRate: 11, ServiceFeeFlat: models.NewMoney(1000)})
+
+	// Net 25000 after discount, plus 1000 service fee, plus 11% of 26000
+	if session.ServiceFee != models.NewMoney(1000) || session.Tax != models.NewMoney(2860) || session.TotalCost != models.NewMoney(28860) {
+		t.Errorf("ApplyCharges() set fee %s, tax %s, total %s; want 1000.00, 2860.00, 28860.00",
+			session.ServiceFee, session.Tax, session.TotalCost)
+	}
+}
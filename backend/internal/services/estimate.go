@@ -0,0 +1,138 @@
+package services
+
+import (
+	"math"
+	"time"
+
+	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
+)
+
+// DC charging slows down above dcTaperStart percent SoC, falling linearly to
+// dcTaperFloor of the power when the battery is full. AC charging is slow
+// enough for the battery to accept it flat.
+const (
+	dcTaperStart = 80.0
+	dcTaperFloor = 0.2
+)
+
+// maxChargeDuration caps ChargeDuration. No charge takes longer, and the
+// cap keeps absurd inputs from overflowing time.Duration.
+const maxChargeDuration = 7 * 24 * time.Hour
+
+// ChargeEstimate is what a charge is expected to deliver, take and cost.
+// Cost is the tariff price; ServiceFee and Tax are added on top of it.
+type ChargeEstimate struct {
+	EnergyKWH       float64       `json:"energy_kwh"`
+	PowerKW         float64       `json:"power_kw"` // Connector power as limited by the vehicle
+	DurationMinutes int           `json:"duration_minutes"`
+	StartAt         time.Time     `json:"start_at"`
+	EndAt           time.Time     `json:"end_at"`
+	Cost            CostBreakdown `json:"cost"`
+	ServiceFee      models.Money  `json:"service_fee"`
+	Tax             models.Money  `json:"tax"`
+	Total           models.Money  `json:"total"`
+}
+
+// curveFactor returns the share of the rated power a battery accepts at a
+// state of charge.
+func curveFactor(soc float64, dc bool) float64 {
+	if !dc || soc <= dcTaperStart {
+		return 1
+	}
+	return 1 - (1-dcTaperFloor)*min(soc-dcTaperStart, 100-dcTaperStart)/(100-dcTaperStart)
+}
+
+// ChargeDuration returns how long delivering energyKWH takes at powerKW, at
+// most maxChargeDuration. With a known battery capacity it follows the power
+// curve from fromSoC; otherwise the power is taken as constant.
+func ChargeDuration(energyKWH, powerKW, batteryKWH float64, fromSoC int, dc bool) time.Duration {
+	if energyKWH <= 0 || powerKW <= 0 {
+		return 0
+	}
+	if batteryKWH <= 0 {
+		return hoursDuration(energyKWH / powerKW)
+	}
+
+	// Integrate in steps of one percent of the battery
+	var hours float64
+	soc := float64(fromSoC)
+	step := batteryKWH / 100
+	for remaining := energyKWH; remaining > 0; remaining -= step {
+		slice := min(step, remaining)
+		hours += slice / (powerKW * curveFactor(soc, dc))
+		soc += slice / batteryKWH * 100
+	}
+	return hoursDuration(hours)
+}
+
+func hoursDuration(hours float64) time.Duration {
+	if hours >= maxChargeDuration.Hours() {
+		return maxChargeDuration
+	}
+	return time.Duration(hours * float64(time.Hour))
+}
+
+// EstimateCharge estimates delivering energyKWH through a connector starting
+// at start, priced under the tariff and charge rules. The connector's power
+// should already be limited by the vehicle, see VehicleConnector.
+func EstimateCharge(connector models.Connector, tariff models.Tariff, rules ChargeRules, energyKWH, batteryKWH float64, fromSoC int, start time.Time, loc *time.Location) ChargeEstimate {
+	duration := ChargeDuration(energyKWH, connector.PowerKW, batteryKWH, fromSoC, models.IsDCConnector(connector.ConnectorType))
+
+	estimate := ChargeEstimate{
+		EnergyKWH:       energyKWH,
+		PowerKW:         connector.PowerKW,
+		DurationMinutes: int(math.Ceil(duration.Minutes())),
+		StartAt:         start,
+		EndAt:           start.Add(duration),
+	}
+	estimate.Cost = PriceCharging(tariff, energyKWH, estimate.StartAt, estimate.EndAt, loc)
+	estimate.ServiceFee, estimate.Tax, estimate.Total = rules.Gross(estimate.Cost.Total)
+	return estimate
+}
+
+// EstimatedCompletion returns when a charging session is expected to reach
+// its first energy, SoC or duration limit, or nil when it is not charging
+// or cannot tell. When the vehicle's battery and SoC are known it follows
+// the power curve from the connector's power as limited by the vehicle;
+// otherwise it assumes the power the charger last reported. The session's
+// Vehicle should be loaded.
+func EstimatedCompletion(session *models.ChargingSession, connector models.Connector, now time.Time) *time.Time {
+	if session.Status != models.SessionCharging || session.StartedAt == nil {
+		return nil
+	}
+
+	power := VehicleConnector(connector, session.Vehicle).PowerKW
+	var batteryKWH float64
+	if session.Vehicle != nil && session.SoC > 0 {
+		batteryKWH = session.Vehicle.BatteryKWH
+	} else if session.PowerKW > 0 {
+		power = session.PowerKW
+	}
+	dc := models.IsDCConnector(connector.ConnectorType)
+
+	var remaining time.Duration
+	consider := func(d time.Duration) {
+		if d > 0 && (remaining == 0 || d < remaining) {
+			remaining = d
+		}
+	}
+	if session.TargetKWH > 0 {
+		consider(ChargeDuration(session.TargetKWH-session.EnergyKWH, power, batteryKWH, session.SoC, dc))
+	}
+	if batteryKWH > 0 {
+		target := session.TargetSoC
+		if target == 0 {
+			target = 100
+		}
+		consider(ChargeDuration(batteryKWH*float64(target-session.SoC)/100, power, batteryKWH, session.SoC, dc))
+	}
+	if session.MaxDuration > 0 {
+		consider(session.StartedAt.Add(time.Duration(session.MaxDuration) * time.Minute).Sub(now))
+	}
+	if remaining == 0 {
+		return nil
+	}
+
+	completion := now.Add(remaining).Truncate(time.Second)
+	return &completion
+}
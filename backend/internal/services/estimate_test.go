@@ -0,0 +1,35 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestChargeDuration(t *testing.T) {
+	tests := []struct {
+		name       string
+		energyKWH  float64
+		powerKW    float64
+		batteryKWH float64
+		fromSoC    int
+		dc         bool
+		want       time.Duration
+	}{
+		{name: "constant power", energyKWH: 30, powerKW: 60, want: 30 * time.Minute},
+		{name: "no energy", energyKWH: 0, powerKW: 60},
+		{name: "no power", energyKWH: 30, powerKW: 0},
+		{name: "AC follows no curve", energyKWH: 10, powerKW: 10, batteryKWH: 50, fromSoC: 85, want: time.Hour},
+		{name: "DC below the taper", energyKWH: 25, powerKW: 50, batteryKWH: 50, fromSoC: 20, dc: true, want: 30 * time.Minute},
+		{name: "capped for absurd input", energyKWH: 500, powerKW: 1e-9, want: maxChargeDuration},
+		{name: "capped along the curve", energyKWH: 50, powerKW: 1e-6, batteryKWH: 50, dc: true, want: maxChargeDuration},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ChargeDuration(tt.energyKWH, tt.powerKW, tt.batteryKWH, tt.fromSoC, tt.dc)
+			if diff := got - tt.want; diff > time.Second || diff < -time.Second {
+				t.Errorf("ChargeDuration() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,409 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Codes of the platform ledger accounts. User wallets use WalletAccountCode.
+const (
+	AccountCash        = "platform:cash"        // Money received through payment gateways
+	AccountRevenue     = "platform:revenue"     // Charging, idle and service fees before discounts
+	AccountTaxPayable  = "platform:tax_payable" // Tax collected, owed to the tax office
+	AccountPromotions  = "platform:promotions"  // Voucher discounts and credits granted
+	AccountAdjustments = "platform:adjustments" // Admin top-ups, resets and opening balances
+)
+
+var platformAccounts = map[string]struct {
+	name string
+	typ  models.LedgerAccountType
+}{
+	AccountCash:        {"Kas payment gateway", models.LedgerAsset},
+	AccountRevenue:     {"Pendapatan charging", models.LedgerRevenue},
+	AccountTaxPayable:  {"Utang pajak", models.LedgerLiability},
+	AccountPromotions:  {"Biaya promosi", models.LedgerExpense},
+	AccountAdjustments: {"Penyesuaian saldo", models.LedgerEquity},
+}
+
+var (
+	ErrLedgerUnbalanced = errors.New("ledger: debits and credits do not balance")
+	ErrLedgerEmpty      = errors.New("ledger: transaction has no amount")
+	ErrUnknownAccount   = errors.New("ledger: unknown account")
+)
+
+// WalletAccountCode returns the ledger account code of a user's wallet.
+func WalletAccountCode(userID uuid.UUID) string {
+	return "wallet:" + userID.String()
+}
+
+// OrganizationAccountCode returns the ledger account code of an
+// organization's shared wallet.
+func OrganizationAccountCode(orgID uuid.UUID) string {
+	return "org:" + orgID.String()
+}
+
+// LedgerLine is one side of a posting. Exactly one of Debit and Credit
+// should be set; zero lines are skipped.
+type LedgerLine struct {
+	Account string
+	Debit   models.Money
+	Credit  models.Money
+}
+
+func Debit(account string, amount models.Money) LedgerLine {
+	return LedgerLine{Account: account, Debit: amount}
+}
+
+func Credit(account string, amount models.Money) LedgerLine {
+	return LedgerLine{Account: account, Credit: amount}
+}
+
+// Post records a balanced ledger transaction and updates the cached balances
+// of the affected accounts, including User.Balance for wallet accounts.
+// Accounts are locked in code order so concurrent postings cannot deadlock.
+// It must be called inside a transaction.
+func Post(tx *gorm.DB, kind models.LedgerTransactionKind, referenceID, description string, lines ...LedgerLine) (*models.LedgerTransaction, error) {
+	var debits, credits models.Money
+	var posted []LedgerLine
+	for _, line := range lines {
+		if line.Debit < 0 || line.Credit < 0 {
+			return nil, fmt.Errorf("ledger: negative amount on %s", line.Account)
+		}
+		if line.Debit == 0 && line.Credit == 0 {
+			continue
+		}
+		debits += line.Debit
+		credits += line.Credit
+		posted = append(posted, line)
+	}
+	if debits != credits {
+		return nil, ErrLedgerUnbalanced
+	}
+	if debits == 0 {
+		return nil, ErrLedgerEmpty
+	}
+
+	codes := make([]string, 0, len(posted))
+	seen := map[string]bool{}
+	for _, line := range posted {
+		if !seen[line.Account] {
+			seen[line.Account] = true
+			codes = append(codes, line.Account)
+		}
+	}
+	sort.Strings(codes)
+
+	accounts := make(map[string]*models.LedgerAccount, len(codes))
+	for _, code := range codes {
+		account, err := lockAccount(tx, code)
+		if err != nil {
+			return nil, err
+		}
+		accounts[code] = account
+	}
+
+	transaction := models.LedgerTransaction{
+		Kind:        kind,
+		ReferenceID: referenceID,
+		Description: description,
+	}
+	if err := tx.Create(&transaction).Error; err != nil {
+		return nil, err
+	}
+
+	for _, line := range posted {
+		account := accounts[line.Account]
+		entry := models.LedgerEntry{
+			TransactionID: transaction.ID,
+			AccountID:     account.ID,
+			Debit:         line.Debit,
+			Credit:        line.Credit,
+		}
+		if err := tx.Create(&entry).Error; err != nil {
+			return nil, err
+		}
+		transaction.Entries = append(transaction.Entries, entry)
+
+		if account.Type.DebitNormal() {
+			account.Balance += line.Debit - line.Credit
+		} else {
+			account.Balance += line.Credit - line.Debit
+		}
+	}
+
+	for _, code := range codes {
+		account := accounts[code]
+		if err := tx.Model(account).Update("balance", account.Balance).Error; err != nil {
+			return nil, err
+		}
+		if account.UserID != nil {
+			if err := tx.Model(&models.User{}).Where("id = ?", *account.UserID).
+				Update("balance", account.Balance).Error; err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &transaction, nil
+}
+
+// lockAccount loads a ledger account for update, creating platform and
+// wallet accounts on first use.
+func lockAccount(tx *gorm.DB, code string) (*models.LedgerAccount, error) {
+	var account models.LedgerAccount
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&account, "code = ?", code).Error
+	if err == nil {
+		return &account, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+
+	account = models.LedgerAccount{Code: code}
+	if platform, ok := platformAccounts[code]; ok {
+		account.Name = platform.name
+		account.Type = platform.typ
+	} else if id, ok := strings.CutPrefix(code, "wallet:"); ok {
+		userID, err := uuid.Parse(id)
+		if err != nil {
+			return nil, ErrUnknownAccount
+		}
+		account.Name = "Dompet " + userID.String()
+		account.Type = models.LedgerLiability
+		account.UserID = &userID
+	} else if id, ok := strings.CutPrefix(code, "org:"); ok {
+		orgID, err := uuid.Parse(id)
+		if err != nil {
+			return nil, ErrUnknownAccount
+		}
+		account.Name = "Dompet organisasi " + orgID.String()
+		account.Type = models.LedgerLiability
+		account.OrganizationID = &orgID
+	} else {
+		return nil, ErrUnknownAccount
+	}
+
+	// Another request may create the same account concurrently
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&account).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&account, "code = ?", code).Error; err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// CreditWallet adds money to a user's wallet from the given source account
+// and records the matching wallet transaction. It must be called inside a
+// transaction.
+func CreditWallet(tx *gorm.DB, userID uuid.UUID, amount models.Money, source string, kind models.LedgerTransactionKind, txType models.TransactionType, referenceID, description string) (*models.WalletTransaction, error) {
+	entry, err := Post(tx, kind, referenceID, description,
+		Debit(source, amount),
+		Credit(WalletAccountCode(userID), amount),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	balance, err := WalletBalance(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	transaction := models.WalletTransaction{
+		UserID:              userID,
+		Amount:              amount,
+		TransactionType:     txType,
+		ReferenceID:         referenceID,
+		Description:         description,
+		LedgerTransactionID: &entry.ID,
+		BalanceAfter:        &balance,
+	}
+	if err := tx.Create(&transaction).Error; err != nil {
+		return nil, err
+	}
+	return &transaction, nil
+}
+
+// WalletBalance returns the cached wallet balance of a user.
+func WalletBalance(tx *gorm.DB, userID uuid.UUID) (models.Money, error) {
+	var user models.User
+	if err := tx.Select("balance").First(&user, "id = ?", userID).Error; err != nil {
+		return 0, err
+	}
+	return user.Balance, nil
+}
+
+// ResetWallets zeroes every wallet through reversing entries against the
+// adjustments account, so the ledger keeps the history. It must be called
+// inside a transaction.
+func ResetWallets(tx *gorm.DB, description string) error {
+	var wallets []models.LedgerAccount
+	if err := tx.Where("user_id IS NOT NULL AND balance <> 0").Find(&wallets).Error; err != nil {
+		return err
+	}
+
+	for _, wallet := range wallets {
+		line, contra := Debit(wallet.Code, wallet.Balance), Credit(AccountAdjustments, wallet.Balance)
+		if wallet.Balance < 0 {
+			line, contra = Credit(wallet.Code, -wallet.Balance), Debit(AccountAdjustments, -wallet.Balance)
+		}
+		if _, err := Post(tx, models.LedgerReset, wallet.UserID.String(), description, line, contra); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OpenLedger posts opening entries for user balances that predate the
+// ledger, so every cached balance is backed by entries. Users that already
+// have a wallet account are skipped, making it safe to run on every start.
+func OpenLedger(db *gorm.DB) (int, error) {
+	var users []models.User
+	if err := db.Where("balance <> 0 AND id NOT IN (?)",
+		db.Model(&models.LedgerAccount{}).Select("user_id").Where("user_id IS NOT NULL")).
+		Find(&users).Error; err != nil {
+		return 0, err
+	}
+
+	for _, user := range users {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			return OpenWallet(tx, user.ID)
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(users), nil
+}
+
+// OpenWallet posts the opening entry of a user whose balance predates the
+// ledger, leaving the balance itself as it is. Users that already have a
+// wallet account are left alone. It must be called inside a transaction.
+func OpenWallet(tx *gorm.DB, userID uuid.UUID) error {
+	var user models.User
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "balance").
+		First(&user, "id = ?", userID).Error; err != nil {
+		return err
+	}
+	var accounts int64
+	if err := tx.Model(&models.LedgerAccount{}).Where("user_id = ?", userID).Count(&accounts).Error; err != nil {
+		return err
+	}
+	if accounts > 0 || user.Balance == 0 {
+		return nil
+	}
+
+	line, contra := Credit(WalletAccountCode(user.ID), user.Balance), Debit(AccountAdjustments, user.Balance)
+	if user.Balance < 0 {
+		line, contra = Debit(WalletAccountCode(user.ID), -user.Balance), Credit(AccountAdjustments, -user.Balance)
+	}
+	_, err := Post(tx, models.LedgerOpening, user.ID.String(), "Saldo awal sebelum ledger", line, contra)
+	return err
+}
+
+// AccountMismatch is a ledger account whose cached balance differs from the
+// sum of its entries.
+type AccountMismatch struct {
+	AccountID uuid.UUID    `json:"account_id"`
+	Code      string       `json:"code"`
+	Cached    models.Money `json:"cached"`
+	Ledger    models.Money `json:"ledger"`
+}
+
+// WalletMismatch is a user whose cached Balance differs from the balance of
+// their wallet account. Unopened is set when the user has no wallet account
+// yet, i.e. the balance predates the ledger and OpenLedger has not run.
+type WalletMismatch struct {
+	UserID   uuid.UUID    `json:"user_id"`
+	Cached   models.Money `json:"cached"`
+	Ledger   models.Money `json:"ledger"`
+	Unopened bool         `json:"unopened"`
+}
+
+// LedgerReconciliation is the result of ReconcileLedger.
+type LedgerReconciliation struct {
+	OK                     bool              `json:"ok"`
+	CheckedAt              time.Time         `json:"checked_at"`
+	Accounts               int               `json:"accounts"`
+	TotalDebit             models.Money      `json:"total_debit"`
+	TotalCredit            models.Money      `json:"total_credit"`
+	UnbalancedTransactions []uuid.UUID       `json:"unbalanced_transactions"`
+	AccountMismatches      []AccountMismatch `json:"account_mismatches"`
+	WalletMismatches       []WalletMismatch  `json:"wallet_mismatches"`
+}
+
+// ReconcileLedger checks that every ledger transaction balances, that every
+// cached account balance equals the sum of its entries and that every user's
+// Balance equals their wallet account.
+func ReconcileLedger(db *gorm.DB, now time.Time) (*LedgerReconciliation, error) {
+	report := &LedgerReconciliation{
+		CheckedAt:              now,
+		UnbalancedTransactions: []uuid.UUID{},
+		AccountMismatches:      []AccountMismatch{},
+		WalletMismatches:       []WalletMismatch{},
+	}
+
+	if err := db.Model(&models.LedgerEntry{}).
+		Select("COALESCE(SUM(debit), 0) AS total_debit, COALESCE(SUM(credit), 0) AS total_credit").
+		Row().Scan(&report.TotalDebit, &report.TotalCredit); err != nil {
+		return nil, err
+	}
+
+	if err := db.Model(&models.LedgerEntry{}).
+		Select("transaction_id").Group("transaction_id").
+		Having("SUM(debit) <> SUM(credit)").
+		Scan(&report.UnbalancedTransactions).Error; err != nil {
+		return nil, err
+	}
+
+	var accounts []struct {
+		ID      uuid.UUID
+		Code    string
+		Type    models.LedgerAccountType
+		Balance models.Money
+		Debits  models.Money
+		Credits models.Money
+	}
+	if err := db.Table("ledger_accounts a").
+		Select("a.id, a.code, a.type, a.balance, COALESCE(SUM(e.debit), 0) AS debits, COALESCE(SUM(e.credit), 0) AS credits").
+		Joins("LEFT JOIN ledger_entries e ON e.account_id = a.id").
+		Group("a.id").
+		Scan(&accounts).Error; err != nil {
+		return nil, err
+	}
+	report.Accounts = len(accounts)
+	for _, a := range accounts {
+		ledger := a.Credits - a.Debits
+		if a.Type.DebitNormal() {
+			ledger = -ledger
+		}
+		if ledger != a.Balance {
+			report.AccountMismatches = append(report.AccountMismatches, AccountMismatch{
+				AccountID: a.ID, Code: a.Code, Cached: a.Balance, Ledger: ledger,
+			})
+		}
+	}
+
+	if err := db.Table("users u").
+		Select("u.id AS user_id, u.balance AS cached, COALESCE(a.balance, 0) AS ledger, a.id IS NULL AS unopened").
+		Joins("LEFT JOIN ledger_accounts a ON a.user_id = u.id").
+		Where("u.deleted_at IS NULL AND u.balance <> COALESCE(a.balance, 0)").
+		Scan(&report.WalletMismatches).Error; err != nil {
+		return nil, err
+	}
+
+	report.OK = report.TotalDebit == report.TotalCredit &&
+		len(report.UnbalancedTransactions) == 0 &&
+		len(report.AccountMismatches) == 0 &&
+		len(report.WalletMismatches) == 0
+	return report, nil
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestPostRejectsInvalidEntries(t *testing.T) {
+	wallet := WalletAccountCode(uuid.New())
+
+	tests := []struct {
+		name    string
+		lines   []LedgerLine
+		wantErr error
+	}{
+		{
+			name:    "debit without credit",
+			lines:   []LedgerLine{Debit(AccountCash, models.NewMoney(10000))},
+			wantErr: ErrLedgerUnbalanced,
+		},
+		{
+			name: "credits exceed debits",
+			lines: []LedgerLine{
+				Debit(AccountCash, models.NewMoney(10000)),
+				Credit(wallet, models.NewMoney(10000)),
+				Credit(AccountRevenue, models.NewMoney(0.01)),
+			},
+			wantErr: ErrLedgerUnbalanced,
+		},
+		{
+			name: "off by one minor unit across several lines",
+			lines: []LedgerLine{
+				Debit(wallet, models.NewMoney(11100)),
+				Credit(AccountRevenue, models.NewMoney(10000)),
+				Credit(AccountTaxPayable, models.NewMoney(1099.99)),
+			},
+			wantErr: ErrLedgerUnbalanced,
+		},
+		{
+			name:    "no lines",
+			wantErr: ErrLedgerEmpty,
+		},
+		{
+			name: "only zero lines",
+			lines: []LedgerLine{
+				Debit(wallet, 0),
+				Credit(AccountRevenue, 0),
+			},
+			wantErr: ErrLedgerEmpty,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A nil transaction panics if Post gets as far as the database
+			_, err := Post(nil, models.LedgerCharge, "ref", "test", tt.lines...)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Post() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPostRejectsNegativeAmounts(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []LedgerLine
+	}{
+		{
+			name: "negative debit",
+			lines: []LedgerLine{
+				Debit(AccountCash, models.NewMoney(-5000)),
+				Credit(AccountRevenue, models.NewMoney(-5000)),
+			},
+		},
+		{
+			name: "negative credit balanced by a larger debit",
+			lines: []LedgerLine{
+				Debit(AccountCash, models.NewMoney(5000)),
+				Credit(AccountRevenue, models.NewMoney(10000)),
+				Credit(AccountPromotions, models.NewMoney(-5000)),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Post(nil, models.LedgerCharge, "ref", "test", tt.lines...)
+			if err == nil {
+				t.Fatal("Post() accepted a negative amount")
+			}
+			if errors.Is(err, ErrLedgerUnbalanced) || errors.Is(err, ErrLedgerEmpty) {
+				t.Errorf("Post() error = %v, want a negative amount error", err)
+			}
+		})
+	}
+}
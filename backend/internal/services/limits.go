@@ -0,0 +1,59 @@
+package services
+
+import (
+	"time"
+
+	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
+)
+
+// HasStopLimit reports whether at least one stop condition is set.
+func HasStopLimit(session *models.ChargingSession) bool {
+	return session.TargetKWH > 0 || session.MaxCost > 0 || session.MaxDuration > 0 || session.TargetSoC > 0
+}
+
+// ReachedLimit returns the first stop condition the session has reached, or
+// an empty reason while charging may continue. TotalCost must hold the
+// current cost after the voucher discount and including service fee and
+// tax, the same amount MaxCost and a direct payment are set from.
+func ReachedLimit(session *models.ChargingSession, now time.Time) models.StopReason {
+	if session.TargetKWH > 0 && session.EnergyKWH >= session.TargetKWH {
+		return models.StopTargetKWH
+	}
+	if session.MaxCost > 0 && session.TotalCost >= session.MaxCost {
+		return models.StopMaxCost
+	}
+	if session.MaxDuration > 0 && session.StartedAt != nil &&
+		now.Sub(*session.StartedAt) >= time.Duration(session.MaxDuration)*time.Minute {
+		return models.StopMaxDuration
+	}
+	if session.TargetSoC > 0 && session.SoC >= session.TargetSoC {
+		return models.StopTargetSoC
+	}
+	return ""
+}
+
+// EstimateSessionCost returns the upfront cost estimate used for the balance
+// check: the cheapest of the limits that can be priced before charging,
+// assuming charging starts at the given time at the connector's rated power.
+// A SoC-only session cannot be priced and returns 0.
+func EstimateSessionCost(session *models.ChargingSession, connector models.Connector, tariff models.Tariff, start time.Time, loc *time.Location) models.Money {
+	var estimate models.Money
+	consider := func(cost models.Money) {
+		if cost > 0 && (estimate == 0 || cost < estimate) {
+			estimate = cost
+		}
+	}
+
+	if session.TargetKWH > 0 && connector.PowerKW > 0 {
+		duration := time.Duration(session.TargetKWH / connector.PowerKW * float64(time.Hour))
+		consider(PriceCharging(tariff, session.TargetKWH, start, start.Add(duration), loc).Total)
+	}
+	if session.MaxDuration > 0 {
+		duration := time.Duration(session.MaxDuration) * time.Minute
+		kwh := connector.PowerKW * duration.Hours()
+		consider(PriceCharging(tariff, kwh, start, start.Add(duration), loc).Total)
+	}
+	consider(session.MaxCost)
+
+	return estimate
+}
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestReachedLimit(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	startedAt := now.Add(-30 * time.Minute)
+
+	tests := []struct {
+		name    string
+		session models.ChargingSession
+		want    models.StopReason
+	}{
+		{
+			name:    "no limit reached",
+			session: models.ChargingSession{TargetKWH: 10, EnergyKWH: 9.9, MaxCost: models.NewMoney(20000), TotalCost: models.NewMoney(19999)},
+		},
+		{
+			name:    "target energy",
+			session: models.ChargingSession{TargetKWH: 10, EnergyKWH: 10},
+			want:    models.StopTargetKWH,
+		},
+		{
+			name:    "max cost",
+			session: models.ChargingSession{MaxCost: models.NewMoney(20000), TotalCost: models.NewMoney(20000)},
+			want:    models.StopMaxCost,
+		},
+		{
+			name:    "max duration",
+			session: models.ChargingSession{MaxDuration: 30, StartedAt: &startedAt},
+			want:    models.StopMaxDuration,
+		},
+		{
+			name:    "max duration not started",
+			session: models.ChargingSession{MaxDuration: 30},
+		},
+		{
+			name:    "target SoC",
+			session: models.ChargingSession{TargetSoC: 80, SoC: 80},
+			want:    models.StopTargetSoC,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ReachedLimit(&tt.session, now); got != tt.want {
+				t.Errorf("ReachedLimit() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestReachedLimitDiscountedDirectPay follows a QRIS session for 10 kWh at
+// 2000/kWh with a 20% voucher and 11% tax. It paid the discounted estimate,
+// so it must keep charging until all 10 kWh are delivered.
+func TestReachedLimitDiscountedDirectPay(t *testing.T) {
+	voucherID := uuid.New()
+	rules := ChargeRules{TaxRate: 11}
+	_, _, paid := rules.Gross(models.NewMoney(20000) - models.NewMoney(4000))
+
+	tests := []struct {
+		kwh  float64
+		want models.StopReason
+	}{
+		{kwh: 5},
+		{kwh: 8},
+		{kwh: 9.99},
+		{kwh: 10, want: models.StopTargetKWH},
+	}
+
+	for _, tt := range tests {
+		db, mock := newMockDB(t)
+		mock.ExpectQuery(`SELECT \* FROM "vouchers" WHERE id = \$1`).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "type", "percent"}).AddRow(voucherID, models.VoucherPercentage, 20.0))
+
+		session := models.ChargingSession{TargetKWH: 10, MaxCost: paid, VoucherID: &voucherID, EnergyKWH: tt.kwh}
+		session.EnergyCost = models.NewMoney(2000).Mul(tt.kwh)
+		session.Discount = RunningDiscount(db, &session)
+		ApplyCharges(&session, rules)
+
+		if got := ReachedLimit(&session, time.Now()); got != tt.want {
+			t.Errorf("at %.2f kWh: ReachedLimit() = %q with total %s of %s paid, want %q",
+				tt.kwh, got, session.TotalCost, paid, tt.want)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// Without the discount the running cost passes the paid amount at 8 kWh
+	session := models.ChargingSession{TargetKWH: 10, MaxCost: paid, EnergyKWH: 8, EnergyCost: models.NewMoney(16000)}
+	ApplyCharges(&session, rules)
+	if ReachedLimit(&session, time.Now()) != models.StopMaxCost {
+		t.Errorf("undiscounted total %s should reach the paid %s", session.TotalCost, paid)
+	}
+}
@@ -0,0 +1,280 @@
+package services
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrOfflineSessionInvalid = errors.New("laporan sesi offline tidak valid")
+	ErrOfflineTokenNotListed = errors.New("token tidak ada di daftar otorisasi lokal charger")
+)
+
+// localAuthResend is how long an update the charger has not confirmed
+// waits before it is sent again.
+const localAuthResend = 10 * time.Minute
+
+// LocalAuthUpdate is a change to a charger's local authorization list:
+// either the full list, or the items added or changed and the ID tags
+// removed since the version the charger confirmed.
+type LocalAuthUpdate struct {
+	Version int
+	Full    bool
+	Items   []models.LocalAuthItem
+	Removed []string
+}
+
+// LocalAuthItems returns the tokens that belong on a charger's local list:
+// those put on it that would be accepted online right now. Personal tokens
+// of users without a positive balance are left off, since offline sessions
+// are billed whatever the balance.
+func LocalAuthItems(tx *gorm.DB, connectorID uuid.UUID, now time.Time) ([]models.LocalAuthItem, error) {
+	var entries []models.LocalAuthEntry
+	if err := tx.Preload("AuthToken").Where("connector_id = ?", connectorID).Find(&entries).Error; err != nil {
+		return nil, err
+	}
+
+	items := make([]models.LocalAuthItem, 0, len(entries))
+	for _, entry := range entries {
+		if entry.AuthToken == nil {
+			continue
+		}
+		token, err := AuthorizeToken(tx, entry.AuthToken.UID, now)
+		switch {
+		case errors.Is(err, ErrTokenUnknown), errors.Is(err, ErrTokenBlocked), errors.Is(err, ErrTokenExpired):
+			continue
+		case err != nil:
+			return nil, err
+		}
+		if token.OrganizationID == nil {
+			balance, err := WalletBalance(tx, token.UserID)
+			if err != nil {
+				return nil, err
+			}
+			if balance <= 0 {
+				continue
+			}
+		}
+		items = append(items, models.LocalAuthItem{IDTag: token.UID, ExpiresAt: token.ExpiresAt})
+	}
+
+	sort.Slice(items, func(i, j int) bool { return items[i].IDTag < items[j].IDTag })
+	return items, nil
+}
+
+// diffLocalAuth returns the items of next that are new or changed since
+// prev and the ID tags that were dropped.
+func diffLocalAuth(prev, next []models.LocalAuthItem) (changed []models.LocalAuthItem, removed []string) {
+	old := make(map[string]models.LocalAuthItem, len(prev))
+	for _, item := range prev {
+		old[item.IDTag] = item
+	}
+	for _, item := range next {
+		before, ok := old[item.IDTag]
+		sameExpiry := before.ExpiresAt == nil && item.ExpiresAt == nil ||
+			before.ExpiresAt != nil && item.ExpiresAt != nil && before.ExpiresAt.Equal(*item.ExpiresAt)
+		if !ok || !sameExpiry {
+			changed = append(changed, item)
+		}
+		delete(old, item.IDTag)
+	}
+	for tag := range old {
+		removed = append(removed, tag)
+	}
+	sort.Strings(removed)
+	return changed, removed
+}
+
+// listedAt reports whether the ID tag is among the items and was not expired
+// at the given time.
+func listedAt(items []models.LocalAuthItem, idTag string, at time.Time) bool {
+	for _, item := range items {
+		if item.IDTag == idTag {
+			return item.ExpiresAt == nil || at.Before(*item.ExpiresAt)
+		}
+	}
+	return false
+}
+
+// NextLocalAuthUpdate works out the update a charger's local list needs and
+// records it as sent under a new version. Changes are sent as a difference
+// when the charger confirmed the previous version, otherwise the full list
+// is sent; an unconfirmed update is repeated after a while, and force
+// always sends the full list. It returns nil when the charger is up to
+// date. It must be called inside a transaction.
+func NextLocalAuthUpdate(tx *gorm.DB, connectorID uuid.UUID, force bool, now time.Time) (*LocalAuthUpdate, error) {
+	list := models.LocalAuthList{ConnectorID: connectorID}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&list).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&list, "connector_id = ?", connectorID).Error; err != nil {
+		return nil, err
+	}
+
+	items, err := LocalAuthItems(tx, connectorID, now)
+	if err != nil {
+		return nil, err
+	}
+	changed, removed := diffLocalAuth(list.Items, items)
+	confirmed := list.AckedVersion == list.Version
+	resend := !confirmed && (list.SentAt == nil || now.Sub(*list.SentAt) >= localAuthResend)
+	if !force && !resend && len(changed) == 0 && len(removed) == 0 {
+		return nil, nil
+	}
+
+	update := &LocalAuthUpdate{Version: list.Version + 1, Items: items}
+	if force || !confirmed || list.Version == 0 {
+		update.Full = true
+	} else {
+		update.Items, update.Removed = changed, removed
+	}
+
+	list.Version = update.Version
+	list.Items = items
+	list.SentAt = &now
+	if err := tx.Save(&list).Error; err != nil {
+		return nil, err
+	}
+	return update, nil
+}
+
+// AckLocalAuthList records the list version a charger reports having, after
+// an update or when it reconnects. It reports whether the charger's list is
+// out of date and needs the full list again.
+func AckLocalAuthList(tx *gorm.DB, connectorID uuid.UUID, version int, accepted bool, now time.Time) (bool, error) {
+	var list models.LocalAuthList
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&list, "connector_id = ?", connectorID).Error
+	if err == gorm.ErrRecordNotFound {
+		return version != 0, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if accepted && version == list.Version {
+		list.AckedVersion = version
+		list.AckedItems = list.Items
+		list.AckedAt = &now
+	} else {
+		list.AckedVersion = 0
+		// A charger without a list cannot accept anyone offline; one with
+		// an older list keeps at most the items it last confirmed
+		if version == 0 {
+			list.AckedItems = nil
+		}
+	}
+	if err := tx.Save(&list).Error; err != nil {
+		return false, err
+	}
+	return list.AckedVersion != list.Version, nil
+}
+
+// OfflineSession is a session a charger ran on its local authorization
+// list while it could not reach the backend, as reported once it is back.
+type OfflineSession struct {
+	OfflineID string    `json:"offline_id"` // The charger's own ID for the session
+	IDTag     string    `json:"id_tag"`
+	StartedAt time.Time `json:"started_at"`
+	EndedAt   time.Time `json:"ended_at"`
+	EnergyKWH float64   `json:"energy_kwh"`
+	SoC       int       `json:"soc"`
+}
+
+// RecordOfflineSession creates and settles the session a charger ran
+// offline, billed to the token's owner under the connector's current
+// tariff. The token must be on the list the charger last confirmed, and the
+// energy within what the connector's rated power can deliver in the
+// reported time; otherwise the report is rejected. A listed token is billed
+// even if it was blocked since or the balance is short.
+// Reports are idempotent per connector and offline ID; a repeated one
+// returns the existing session and false. It must be called inside a
+// transaction.
+func RecordOfflineSession(tx *gorm.DB, connector models.Connector, report OfflineSession, now time.Time) (*models.ChargingSession, bool, error) {
+	if report.OfflineID == "" || len(report.OfflineID) > 64 || report.StartedAt.IsZero() ||
+		report.EndedAt.Before(report.StartedAt) || report.EndedAt.After(now) || report.EnergyKWH < 0 {
+		return nil, false, ErrOfflineSessionInvalid
+	}
+	if report.EnergyKWH > connector.PowerKW*report.EndedAt.Sub(report.StartedAt).Hours() {
+		return nil, false, ErrOfflineSessionInvalid
+	}
+
+	var existing models.ChargingSession
+	err := tx.First(&existing, "connector_id = ? AND offline_id = ?", connector.ID, report.OfflineID).Error
+	if err == nil {
+		return &existing, false, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, false, err
+	}
+
+	var token models.AuthToken
+	if err := tx.First(&token, "uid = ?", models.NormalizeTokenUID(report.IDTag)).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, false, ErrTokenUnknown
+		}
+		return nil, false, err
+	}
+
+	var list models.LocalAuthList
+	if err := tx.First(&list, "connector_id = ?", connector.ID).Error; err != nil && err != gorm.ErrRecordNotFound {
+		return nil, false, err
+	}
+	if !listedAt(list.AckedItems, token.UID, report.StartedAt) {
+		return nil, false, ErrOfflineTokenNotListed
+	}
+
+	tariff, err := ResolveTariff(tx, connector)
+	if err != nil {
+		return nil, false, err
+	}
+
+	startedAt := report.StartedAt
+	offlineID := report.OfflineID
+	session := models.ChargingSession{
+		UserID:         token.UserID,
+		ConnectorID:    connector.ID,
+		Status:         models.SessionCharging,
+		EnergyKWH:      report.EnergyKWH,
+		SoC:            report.SoC,
+		StopReason:     models.StopCharger,
+		StartedAt:      &startedAt,
+		Tariff:         &tariff,
+		OrganizationID: token.OrganizationID,
+		AuthTokenID:    &token.ID,
+		OfflineID:      &offlineID,
+	}
+	if tariff.ID != uuid.Nil {
+		session.TariffID = &tariff.ID
+	}
+	if err := tx.Create(&session).Error; err != nil {
+		return nil, false, err
+	}
+
+	payment := models.Payment{
+		UserID:         token.UserID,
+		Purpose:        models.PurposeSession,
+		SessionID:      &session.ID,
+		PaymentMethod:  "wallet",
+		PaymentGateway: "wallet",
+		ExternalID:     "WALLET-" + session.ID.String()[:8],
+		Status:         models.PaymentPending,
+		PaidAt:         &now,
+	}
+	if token.OrganizationID != nil {
+		payment.PaymentMethod = "organization"
+	}
+	if err := tx.Create(&payment).Error; err != nil {
+		return nil, false, err
+	}
+
+	if err := SettleSession(tx, &session, report.EndedAt); err != nil {
+		return nil, false, err
+	}
+	return &session, true, nil
+}
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestDiffLocalAuth(t *testing.T) {
+	expiry := time.Date(2026, 12, 31, 17, 0, 0, 0, time.UTC)
+	later := expiry.AddDate(1, 0, 0)
+	sameInWIB := expiry.In(time.FixedZone("WIB", 7*60*60))
+	item := func(tag string, expiresAt *time.Time) models.LocalAuthItem {
+		return models.LocalAuthItem{IDTag: tag, ExpiresAt: expiresAt}
+	}
+
+	tests := []struct {
+		name        string
+		prev, next  []models.LocalAuthItem
+		wantChanged []string
+		wantRemoved []string
+	}{
+		{
+			name: "both empty",
+		},
+		{
+			name:        "first list",
+			next:        []models.LocalAuthItem{item("A1", nil), item("B2", &expiry)},
+			wantChanged: []string{"A1", "B2"},
+		},
+		{
+			name: "unchanged",
+			prev: []models.LocalAuthItem{item("A1", nil), item("B2", &expiry)},
+			next: []models.LocalAuthItem{item("A1", nil), item("B2", &expiry)},
+		},
+		{
+			name: "same expiry in another timezone",
+			prev: []models.LocalAuthItem{item("B2", &expiry)},
+			next: []models.LocalAuthItem{item("B2", &sameInWIB)},
+		},
+		{
+			name:        "token added",
+			prev:        []models.LocalAuthItem{item("A1", nil)},
+			next:        []models.LocalAuthItem{item("A1", nil), item("C3", nil)},
+			wantChanged: []string{"C3"},
+		},
+		{
+			name:        "tokens removed",
+			prev:        []models.LocalAuthItem{item("C3", nil), item("A1", nil), item("B2", nil)},
+			next:        []models.LocalAuthItem{item("B2", nil)},
+			wantRemoved: []string{"A1", "C3"},
+		},
+		{
+			name:        "expiry set",
+			prev:        []models.LocalAuthItem{item("A1", nil)},
+			next:        []models.LocalAuthItem{item("A1", &expiry)},
+			wantChanged: []string{"A1"},
+		},
+		{
+			name:        "expiry cleared",
+			prev:        []models.LocalAuthItem{item("A1", &expiry)},
+			next:        []models.LocalAuthItem{item("A1", nil)},
+			wantChanged: []string{"A1"},
+		},
+		{
+			name:        "expiry extended",
+			prev:        []models.LocalAuthItem{item("A1", &expiry)},
+			next:        []models.LocalAuthItem{item("A1", &later)},
+			wantChanged: []string{"A1"},
+		},
+		{
+			name:        "list emptied",
+			prev:        []models.LocalAuthItem{item("A1", nil), item("B2", &expiry)},
+			wantRemoved: []string{"A1", "B2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changed, removed := diffLocalAuth(tt.prev, tt.next)
+
+			var changedTags []string
+			for _, item := range changed {
+				changedTags = append(changedTags, item.IDTag)
+			}
+			if !slices.Equal(changedTags, tt.wantChanged) {
+				t.Errorf("changed = %v, want %v", changedTags, tt.wantChanged)
+			}
+			if !slices.Equal(removed, tt.wantRemoved) {
+				t.Errorf("removed = %v, want %v", removed, tt.wantRemoved)
+			}
+		})
+	}
+}
+
+func TestDiffLocalAuthKeepsNewExpiry(t *testing.T) {
+	expiry := time.Date(2026, 12, 31, 17, 0, 0, 0, time.UTC)
+	later := expiry.AddDate(1, 0, 0)
+
+	changed, _ := diffLocalAuth(
+		[]models.LocalAuthItem{{IDTag: "A1", ExpiresAt: &expiry}},
+		[]models.LocalAuthItem{{IDTag: "A1", ExpiresAt: &later}},
+	)
+	if len(changed) != 1 || changed[0].ExpiresAt == nil || !changed[0].ExpiresAt.Equal(later) {
+		t.Errorf("changed = %+v, want A1 expiring %s", changed, later)
+	}
+}
+
+func TestRecordOfflineSessionRejectsImpossibleEnergy(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	connector := models.Connector{PowerKW: 22}
+	report := func(minutes int, kwh float64) OfflineSession {
+		return OfflineSession{
+			OfflineID: "off-1",
+			IDTag:     "04A1B2C3",
+			StartedAt: now.Add(-time.Duration(minutes) * time.Minute),
+			EndedAt:   now,
+			EnergyKWH: kwh,
+		}
+	}
+
+	tests := []struct {
+		name   string
+		report OfflineSession
+	}{
+		{"more than rated power for the duration", report(60, 22.01)},
+		{"energy without duration", report(0, 0.5)},
+		{"negative energy", report(60, -1)},
+		{"ended in the future", OfflineSession{OfflineID: "off-1", StartedAt: now, EndedAt: now.Add(time.Minute)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A nil transaction panics if the report gets as far as the database
+			_, _, err := RecordOfflineSession(nil, connector, tt.report, now)
+			if !errors.Is(err, ErrOfflineSessionInvalid) {
+				t.Errorf("RecordOfflineSession() error = %v, want %v", err, ErrOfflineSessionInvalid)
+			}
+		})
+	}
+}
+
+func TestRecordOfflineSessionRequiresListedToken(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	connector := models.Connector{ID: uuid.New(), PowerKW: 22}
+	report := OfflineSession{OfflineID: "off-1", IDTag: "04a1b2c3", StartedAt: now.Add(-time.Hour), EndedAt: now, EnergyKWH: 15}
+	expired := now.Add(-2 * time.Hour)
+
+	tests := []struct {
+		name       string
+		ackedItems string // JSON of the confirmed list, empty for no list
+	}{
+		{"no list confirmed", ""},
+		{"token not on the confirmed list", `[{"id_tag":"FFFFFFFF"}]`},
+		{"token expired before the session", `[{"id_tag":"04A1B2C3","expires_at":"` + expired.Format(time.RFC3339) + `"}]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newMockDB(t)
+			mock.ExpectQuery(`SELECT \* FROM "charging_sessions" WHERE \(connector_id = \$1 AND offline_id = \$2\)`).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}))
+			mock.ExpectQuery(`SELECT \* FROM "auth_tokens" WHERE uid = \$1`).
+				WithArgs("04A1B2C3", sqlmock.AnyArg()).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "uid", "user_id"}).AddRow(uuid.New(), "04A1B2C3", uuid.New()))
+			lists := sqlmock.NewRows([]string{"connector_id", "acked_items"})
+			if tt.ackedItems != "" {
+				lists.AddRow(connector.ID, []byte(tt.ackedItems))
+			}
+			mock.ExpectQuery(`SELECT \* FROM "local_auth_lists" WHERE connector_id = \$1`).WillReturnRows(lists)
+
+			_, _, err := RecordOfflineSession(db, connector, report, now)
+			if !errors.Is(err, ErrOfflineTokenNotListed) {
+				t.Errorf("RecordOfflineSession() error = %v, want %v", err, ErrOfflineTokenNotListed)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,238 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrOrgSuspended       = errors.New("akun organisasi sedang ditangguhkan")
+	ErrOrgCreditExceeded  = errors.New("saldo dan batas kredit organisasi tidak mencukupi")
+	ErrOrgMemberLimit     = errors.New("batas pemakaian bulanan Anda di organisasi sudah tercapai")
+	ErrInvoiceExists      = errors.New("invoice untuk periode ini sudah dibuat")
+	ErrInvoiceAlreadyPaid = errors.New("invoice sudah lunas")
+)
+
+// SessionAccountCode returns the ledger account a session is paid from: the
+// organization's wallet for fleet sessions, otherwise the user's.
+func SessionAccountCode(session *models.ChargingSession) string {
+	if session.OrganizationID != nil {
+		return OrganizationAccountCode(*session.OrganizationID)
+	}
+	return WalletAccountCode(session.UserID)
+}
+
+// sessionBalance returns the balance of the wallet a session is paid from.
+func sessionBalance(tx *gorm.DB, session *models.ChargingSession) (models.Money, error) {
+	if session.OrganizationID != nil {
+		return OrganizationBalance(tx, *session.OrganizationID)
+	}
+	return WalletBalance(tx, session.UserID)
+}
+
+// OrganizationBalance returns the balance of an organization's wallet. It is
+// negative while a postpaid organization uses its credit.
+func OrganizationBalance(tx *gorm.DB, orgID uuid.UUID) (models.Money, error) {
+	var account models.LedgerAccount
+	err := tx.Select("balance").First(&account, "organization_id = ?", orgID).Error
+	if err == gorm.ErrRecordNotFound {
+		return 0, nil
+	}
+	return account.Balance, err
+}
+
+// ActiveMembership returns the user's membership with its organization
+// loaded, or nil when they are not an active member of one.
+func ActiveMembership(db *gorm.DB, userID uuid.UUID) (*models.OrganizationMember, error) {
+	var member models.OrganizationMember
+	err := db.Preload("Organization").First(&member, "user_id = ? AND active", userID).Error
+	if err == gorm.ErrRecordNotFound || (err == nil && member.Organization == nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// MonthStart returns the start of the calendar month of now in the
+// platform's time zone.
+func MonthStart(db *gorm.DB, now time.Time) time.Time {
+	local := now.In(TariffLocation(db))
+	return time.Date(local.Year(), local.Month(), 1, 0, 0, 0, 0, local.Location())
+}
+
+// MemberMonthlySpend sums what a member charged to their organization this
+// month: the final cost of closed sessions and the estimate of open ones.
+func MemberMonthlySpend(db *gorm.DB, member *models.OrganizationMember, now time.Time) (models.Money, error) {
+	var spent models.Money
+	err := db.Model(&models.ChargingSession{}).
+		Where("organization_id = ? AND user_id = ? AND status <> ? AND created_at >= ?",
+			member.OrganizationID, member.UserID, models.SessionCancelled, MonthStart(db, now)).
+		Select("COALESCE(SUM(total_cost), 0)").Row().Scan(&spent)
+	return spent, err
+}
+
+// OrganizationAvailable returns what an organization's members may still
+// charge: its balance plus credit limit, less the estimates of sessions
+// that are still open.
+func OrganizationAvailable(db *gorm.DB, org *models.Organization) (models.Money, error) {
+	balance, err := OrganizationBalance(db, org.ID)
+	if err != nil {
+		return 0, err
+	}
+	var reserved models.Money
+	if err := db.Model(&models.ChargingSession{}).
+		Where("organization_id = ? AND status IN ?", org.ID, activeSessionStatuses).
+		Select("COALESCE(SUM(total_cost), 0)").Row().Scan(&reserved); err != nil {
+		return 0, err
+	}
+	return balance + org.CreditLimit - reserved, nil
+}
+
+// MemberAllowance returns how much a member may charge to their
+// organization for a new session: what the organization has available,
+// capped by what is left of the member's monthly limit.
+func MemberAllowance(db *gorm.DB, member *models.OrganizationMember, now time.Time) (models.Money, error) {
+	if member.Organization.Status != "active" {
+		return 0, ErrOrgSuspended
+	}
+	allowance, err := OrganizationAvailable(db, member.Organization)
+	if err != nil {
+		return 0, err
+	}
+	if member.MonthlyLimit > 0 {
+		spent, err := MemberMonthlySpend(db, member, now)
+		if err != nil {
+			return 0, err
+		}
+		allowance = min(allowance, member.MonthlyLimit-spent)
+	}
+	return max(allowance, 0), nil
+}
+
+// TopUpOrganization credits a deposit the organization paid by bank
+// transfer to its wallet. It must be called inside a transaction.
+func TopUpOrganization(tx *gorm.DB, orgID uuid.UUID, amount models.Money, reference, description string) (*models.LedgerTransaction, error) {
+	return Post(tx, models.LedgerOrgTopUp, reference, description,
+		Debit(AccountCash, amount),
+		Credit(OrganizationAccountCode(orgID), amount),
+	)
+}
+
+// GenerateInvoice issues the invoice of an organization for the calendar
+// month starting at periodStart, listing every session its members closed
+// in it with the refunds given so far. Invoices are numbered sequentially
+// across organizations. A prepaid organization has already paid from its
+// wallet, so its invoice is issued as paid. It must be called inside a
+// transaction.
+func GenerateInvoice(tx *gorm.DB, org *models.Organization, periodStart, now time.Time) (*models.Invoice, error) {
+	var existing int64
+	if err := tx.Model(&models.Invoice{}).
+		Where("organization_id = ? AND period_start = ?", org.ID, periodStart).
+		Count(&existing).Error; err != nil {
+		return nil, err
+	}
+	if existing > 0 {
+		return nil, ErrInvoiceExists
+	}
+
+	invoice := models.Invoice{
+		ID:             uuid.New(),
+		OrganizationID: org.ID,
+		PeriodStart:    periodStart,
+		PeriodEnd:      periodStart.AddDate(0, 1, 0),
+		Status:         models.InvoiceIssued,
+		IssuedAt:       now,
+	}
+
+	var sessions []models.ChargingSession
+	if err := tx.Preload("User").Preload("Connector.Station").
+		Where("organization_id = ? AND status IN ? AND ended_at >= ? AND ended_at < ?", org.ID,
+			[]models.SessionStatus{models.SessionCompleted, models.SessionFailed}, invoice.PeriodStart, invoice.PeriodEnd).
+		Order("ended_at").Find(&sessions).Error; err != nil {
+		return nil, err
+	}
+
+	for _, session := range sessions {
+		var refunded models.Money
+		if err := tx.Model(&models.Refund{}).Where("session_id = ?", session.ID).
+			Select("COALESCE(SUM(amount), 0)").Row().Scan(&refunded); err != nil {
+			return nil, err
+		}
+		invoice.Lines = append(invoice.Lines, models.InvoiceLine{
+			InvoiceID:    invoice.ID,
+			SessionID:    session.ID,
+			UserID:       session.UserID,
+			DriverName:   session.User.Name,
+			VehiclePlate: session.VehiclePlate,
+			StationName:  session.Connector.Station.Name,
+			StartedAt:    session.StartedAt,
+			EndedAt:      session.EndedAt,
+			EnergyKWH:    session.EnergyKWH,
+			Tax:          session.Tax,
+			Amount:       session.TotalCost,
+			Refunded:     refunded,
+		})
+		invoice.SessionCount++
+		invoice.EnergyKWH += session.EnergyKWH
+		invoice.Tax += session.Tax
+		invoice.Refunded += refunded
+		invoice.Total += session.TotalCost - refunded
+	}
+	if org.CreditLimit == 0 || invoice.Total == 0 {
+		invoice.Status = models.InvoicePaid
+		invoice.PaidAt = &now
+	}
+
+	// Serialize numbering so the sequence has no gaps or duplicates
+	if err := tx.Exec("LOCK TABLE invoices IN EXCLUSIVE MODE").Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Model(&models.Invoice{}).Select("COALESCE(MAX(sequence), 0) + 1").
+		Row().Scan(&invoice.Sequence); err != nil {
+		return nil, err
+	}
+	invoice.Number = fmt.Sprintf("INV-%d-%06d", periodStart.Year(), invoice.Sequence)
+
+	if err := tx.Create(&invoice).Error; err != nil {
+		return nil, err
+	}
+	return &invoice, nil
+}
+
+// PayInvoice records that a postpaid organization paid an invoice by bank
+// transfer, which credits its wallet by the invoice total. It must be
+// called inside a transaction.
+func PayInvoice(tx *gorm.DB, invoiceID uuid.UUID, now time.Time) (*models.Invoice, error) {
+	var invoice models.Invoice
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&invoice, "id = ?", invoiceID).Error; err != nil {
+		return nil, err
+	}
+	if invoice.Status == models.InvoicePaid {
+		return nil, ErrInvoiceAlreadyPaid
+	}
+
+	if _, err := Post(tx, models.LedgerInvoice, invoice.ID.String(), "Pembayaran invoice "+invoice.Number,
+		Debit(AccountCash, invoice.Total),
+		Credit(OrganizationAccountCode(invoice.OrganizationID), invoice.Total),
+	); err != nil {
+		return nil, err
+	}
+
+	invoice.Status = models.InvoicePaid
+	invoice.PaidAt = &now
+	if err := tx.Model(&invoice).Updates(map[string]interface{}{
+		"status":  invoice.Status,
+		"paid_at": invoice.PaidAt,
+	}).Error; err != nil {
+		return nil, err
+	}
+	return &invoice, nil
+}
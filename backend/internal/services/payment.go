@@ -0,0 +1,107 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrPaymentNotFound       = errors.New("pembayaran tidak ditemukan")
+	ErrPaymentAmountMismatch = errors.New("jumlah yang dibayar tidak sesuai dengan tagihan")
+)
+
+// PaymentUpdate is a payment state confirmed by the payment provider.
+type PaymentUpdate struct {
+	Gateway      string
+	Status       models.PaymentStatus
+	Amount       models.Money // Amount the provider reports as paid
+	Reference    string       // Provider reference, stored as ExternalID
+	CallbackData string
+}
+
+// CompletePayment applies a confirmed provider state to a pending payment.
+// A paid top-up, or the upfront amount of a direct-pay session, is credited
+// to the user's wallet; a direct-pay session whose payment failed is
+// cancelled. Payments that are no longer pending are left alone, so repeated
+// callbacks have no effect; the returned bool reports whether the payment
+// changed. It must be called inside a transaction.
+func CompletePayment(tx *gorm.DB, paymentID uuid.UUID, update PaymentUpdate, at time.Time) (*models.Payment, bool, error) {
+	var payment models.Payment
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		First(&payment, "id = ? AND payment_gateway = ?", paymentID, update.Gateway).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, false, ErrPaymentNotFound
+		}
+		return nil, false, err
+	}
+
+	// A direct-pay session cancelled before its QR code was paid is still
+	// credited when the payer pays it anyway, so the money is not lost. The
+	// payment stays cancelled as nothing was charged.
+	late := payment.Status == models.PaymentCancelled && payment.PrepaidAmount > 0 &&
+		update.Status == models.PaymentSuccess
+	if (payment.Status != models.PaymentPending && !late) || update.Status == models.PaymentPending {
+		return &payment, false, nil
+	}
+
+	updates := map[string]interface{}{
+		"callback_data": update.CallbackData,
+	}
+	if !late {
+		updates["status"] = update.Status
+	}
+	if update.Status == models.PaymentSuccess {
+		if update.Amount != payment.Amount {
+			return nil, false, ErrPaymentAmountMismatch
+		}
+		switch {
+		case payment.Purpose == models.PurposeTopUp:
+			txType, description := models.TransactionTopUp, "Top up saldo via "+update.Gateway
+			if payment.Automatic {
+				txType, description = models.TransactionAutoTopUp, "Top up otomatis via "+update.Gateway
+			}
+			if _, err := CreditWallet(tx, payment.UserID, payment.Amount, AccountCash, models.LedgerTopUp,
+				txType, payment.ID.String(), description); err != nil {
+				return nil, false, err
+			}
+		case payment.PrepaidAmount > 0:
+			// The session is charged from the wallet at settlement, which
+			// leaves what it did not use there
+			if _, err := CreditWallet(tx, payment.UserID, payment.PrepaidAmount, AccountCash, models.LedgerTopUp,
+				models.TransactionTopUp, payment.ID.String(), "Pembayaran langsung sesi charging via "+update.Gateway); err != nil {
+				return nil, false, err
+			}
+		}
+		payment.PaidAt = &at
+		updates["paid_at"] = at
+		if update.Reference != "" {
+			payment.ExternalID = update.Reference
+			updates["external_id"] = update.Reference
+		}
+	}
+	if update.Status != models.PaymentSuccess && payment.Purpose == models.PurposeSession && payment.SessionID != nil {
+		var session models.ChargingSession
+		if err := tx.First(&session, "id = ?", *payment.SessionID).Error; err != nil {
+			return nil, false, err
+		}
+		if session.Status == models.SessionPending {
+			if err := CancelSession(tx, &session, at); err != nil && !errors.Is(err, ErrSessionNotWaiting) {
+				return nil, false, err
+			}
+		}
+	}
+	if !late {
+		payment.Status = update.Status
+	}
+	payment.CallbackData = update.CallbackData
+
+	if err := tx.Model(&payment).Updates(updates).Error; err != nil {
+		return nil, false, err
+	}
+	return &payment, true, nil
+}
@@ -0,0 +1,84 @@
+package services
+
+import (
+	"time"
+
+	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// SessionTariff returns the tariff a session is billed under: the snapshot
+// taken when the session was created, or the connector's current tariff for
+// sessions created before snapshots existed.
+func SessionTariff(tx *gorm.DB, session *models.ChargingSession, connector models.Connector) (models.Tariff, error) {
+	if session.Tariff != nil {
+		return *session.Tariff, nil
+	}
+	return ResolveTariff(tx, connector)
+}
+
+// ApplyPriceChange sets the connector's flat price and tariff from a price
+// history entry and marks the entry as applied. An entry that was applied
+// or cancelled in the meantime is left alone.
+func ApplyPriceChange(tx *gorm.DB, change *models.ConnectorPriceChange, now time.Time) error {
+	result := tx.Model(&models.ConnectorPriceChange{}).Where("id = ? AND applied_at IS NULL", change.ID).
+		Update("applied_at", now)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return result.Error
+	}
+	change.AppliedAt = &now
+
+	return tx.Model(&models.Connector{}).Where("id = ?", change.ConnectorID).
+		Updates(map[string]interface{}{
+			"price_per_kwh": change.PricePerKWH,
+			"tariff_id":     change.TariffID,
+		}).Error
+}
+
+// CancelPendingPriceChanges removes the connector's price changes that have
+// not been applied yet, so that a direct edit of its price is not later
+// overwritten by a change scheduled against the old one. It returns how
+// many were removed.
+func CancelPendingPriceChanges(tx *gorm.DB, connectorID uuid.UUID) (int64, error) {
+	result := tx.Where("connector_id = ? AND applied_at IS NULL", connectorID).
+		Delete(&models.ConnectorPriceChange{})
+	return result.RowsAffected, result.Error
+}
+
+// RecordPriceChange adds an already applied entry to the connector's price
+// history, e.g. after an admin edited the price directly.
+func RecordPriceChange(tx *gorm.DB, connector models.Connector, createdBy *uuid.UUID, note string, now time.Time) error {
+	change := models.ConnectorPriceChange{
+		ConnectorID: connector.ID,
+		PricePerKWH: connector.PricePerKWH,
+		TariffID:    connector.TariffID,
+		EffectiveAt: now,
+		AppliedAt:   &now,
+		CreatedBy:   createdBy,
+		Note:        note,
+	}
+	return tx.Create(&change).Error
+}
+
+// ApplyDuePriceChanges applies all pending price changes whose effective time
+// has passed, oldest first, and returns how many were applied.
+func ApplyDuePriceChanges(db *gorm.DB, now time.Time) (int, error) {
+	var changes []models.ConnectorPriceChange
+	if err := db.Where("applied_at IS NULL AND effective_at <= ?", now).
+		Order("effective_at ASC").Find(&changes).Error; err != nil {
+		return 0, err
+	}
+
+	applied := 0
+	for i := range changes {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			return ApplyPriceChange(tx, &changes[i], now)
+		})
+		if err != nil {
+			return applied, err
+		}
+		applied++
+	}
+	return applied, nil
+}
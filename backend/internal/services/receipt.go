@@ -0,0 +1,64 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var ErrReceiptUnavailable = errors.New("kwitansi hanya tersedia untuk sesi yang sudah selesai")
+
+// ReceiptIssuer returns the name receipts are issued under, taken from the
+// system_name system setting.
+func ReceiptIssuer(tx *gorm.DB) string {
+	var cfg models.SystemConfig
+	if err := tx.First(&cfg, "config_key = ?", "system_name").Error; err == nil && cfg.ConfigValue != "" {
+		return cfg.ConfigValue
+	}
+	return "SistemCharging"
+}
+
+// IssueReceipt returns the receipt of a completed session, numbering it on
+// first request. It must be called inside a transaction.
+func IssueReceipt(tx *gorm.DB, session *models.ChargingSession, now time.Time) (*models.Receipt, error) {
+	if session.Status != models.SessionCompleted {
+		return nil, ErrReceiptUnavailable
+	}
+
+	var receipt models.Receipt
+	find := func() error {
+		return tx.Where("session_id = ?", session.ID).Limit(1).Find(&receipt).Error
+	}
+	if err := find(); err != nil || receipt.ID != uuid.Nil {
+		return &receipt, err
+	}
+
+	// Serialize numbering so the sequence has no gaps or duplicates, then
+	// check again for a receipt issued while waiting for the lock
+	if err := tx.Exec("LOCK TABLE receipts IN EXCLUSIVE MODE").Error; err != nil {
+		return nil, err
+	}
+	if err := find(); err != nil || receipt.ID != uuid.Nil {
+		return &receipt, err
+	}
+
+	receipt = models.Receipt{
+		SessionID: session.ID,
+		UserID:    session.UserID,
+		IssuedAt:  now,
+	}
+	if err := tx.Model(&models.Receipt{}).Select("COALESCE(MAX(sequence), 0) + 1").
+		Row().Scan(&receipt.Sequence); err != nil {
+		return nil, err
+	}
+	receipt.Number = fmt.Sprintf("RCP-%d-%06d", now.In(TariffLocation(tx)).Year(), receipt.Sequence)
+
+	if err := tx.Create(&receipt).Error; err != nil {
+		return nil, err
+	}
+	return &receipt, nil
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"errors"
+
+	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrRefundNoPayment   = errors.New("pembayaran sesi tidak ditemukan")
+	ErrRefundNotSettled  = errors.New("sesi belum selesai, pembayaran belum dapat direfund")
+	ErrRefundNotPaid     = errors.New("pembayaran sesi ini tidak dapat direfund")
+	ErrRefundInvalid     = errors.New("jumlah refund harus lebih dari 0")
+	ErrRefundExceedsPaid = errors.New("jumlah refund melebihi sisa pembayaran yang dapat direfund")
+	ErrRefundNotWallet   = errors.New("pembayaran ini tidak masuk ke dompet, refund harus diproses di payment gateway")
+)
+
+// RefundSession returns amount of a settled session's payment to the wallet
+// it was paid from; an amount of zero refunds everything not refunded yet.
+// The tax and voucher discount shares of the refund are proportional to the
+// amount, and the last refund takes whatever is left so a full refund
+// always reverses all of them.
+//
+// Refunds only ever go to the wallet: sessions are settled from it, and a
+// direct-pay session's QRIS payment was credited to it before charging.
+// Nothing is sent back through the payment gateway, and a payment whose
+// money never reached the wallet is rejected with ErrRefundNotWallet.
+// refundedBy is the admin issuing the refund, or nil for automatic refunds.
+// It must be called inside a transaction.
+func RefundSession(tx *gorm.DB, sessionID uuid.UUID, amount models.Money, reason string, refundedBy *uuid.UUID) (*models.Refund, error) {
+	var payment models.Payment
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		First(&payment, "session_id = ?", sessionID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrRefundNoPayment
+		}
+		return nil, err
+	}
+	var session models.ChargingSession
+	if err := tx.Select("id", "user_id", "organization_id", "status").First(&session, "id = ?", sessionID).Error; err != nil {
+		return nil, err
+	}
+
+	// Wallets are only charged at settlement, so there is nothing to give
+	// back before the session closed
+	if session.Status != models.SessionCompleted && session.Status != models.SessionFailed {
+		return nil, ErrRefundNotSettled
+	}
+	if payment.Status != models.PaymentSuccess && payment.Status != models.PaymentPartiallyRefunded {
+		return nil, ErrRefundNotPaid
+	}
+	if payment.PaymentGateway != "wallet" && (payment.PrepaidAmount == 0 || payment.PaidAt == nil) {
+		return nil, ErrRefundNotWallet
+	}
+
+	remaining := payment.Amount - payment.RefundedAmount
+	if amount < 0 {
+		return nil, ErrRefundInvalid
+	}
+	if amount == 0 {
+		amount = remaining
+	}
+	if amount == 0 {
+		return nil, ErrRefundInvalid
+	}
+	if amount > remaining {
+		return nil, ErrRefundExceedsPaid
+	}
+
+	var refunded struct {
+		Tax      models.Money
+		Discount models.Money
+	}
+	if err := tx.Model(&models.Refund{}).Where("payment_id = ?", payment.ID).
+		Select("COALESCE(SUM(tax), 0) AS tax, COALESCE(SUM(discount), 0) AS discount").
+		Scan(&refunded).Error; err != nil {
+		return nil, err
+	}
+	tax := refundShare(payment.Tax, refunded.Tax, amount, remaining, payment.Amount)
+	discount := refundShare(payment.Discount, refunded.Discount, amount, remaining, payment.Amount)
+
+	refund := models.Refund{
+		ID:         uuid.New(),
+		PaymentID:  payment.ID,
+		SessionID:  session.ID,
+		UserID:     session.UserID,
+		Amount:     amount,
+		Tax:        tax,
+		Discount:   discount,
+		Reason:     reason,
+		Automatic:  refundedBy == nil,
+		RefundedBy: refundedBy,
+	}
+
+	description := "Refund pengisian daya"
+	if reason != "" {
+		description += ": " + reason
+	}
+	// Settlement booked revenue before the discount and carried the
+	// discount as a promotion expense, so that is reversed as well
+	entry, err := Post(tx, models.LedgerRefund, refund.ID.String(), description,
+		Debit(AccountRevenue, amount-tax+discount),
+		Debit(AccountTaxPayable, tax),
+		Credit(SessionAccountCode(&session), amount),
+		Credit(AccountPromotions, discount),
+	)
+	if err != nil {
+		return nil, err
+	}
+	refund.LedgerTransactionID = &entry.ID
+	if err := tx.Create(&refund).Error; err != nil {
+		return nil, err
+	}
+
+	payment.RefundedAmount += amount
+	payment.Status = models.PaymentPartiallyRefunded
+	if payment.RefundedAmount == payment.Amount {
+		payment.Status = models.PaymentRefunded
+	}
+	if err := tx.Model(&payment).Updates(map[string]interface{}{
+		"refunded_amount": payment.RefundedAmount,
+		"status":          payment.Status,
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	balance, err := sessionBalance(tx, &session)
+	if err != nil {
+		return nil, err
+	}
+	transaction := models.WalletTransaction{
+		UserID:              session.UserID,
+		Amount:              amount,
+		TransactionType:     models.TransactionRefund,
+		ReferenceID:         refund.ID.String(),
+		SessionID:           &session.ID,
+		OrganizationID:      session.OrganizationID,
+		LedgerTransactionID: &entry.ID,
+		BalanceAfter:        &balance,
+		Description:         description,
+	}
+	if err := tx.Create(&transaction).Error; err != nil {
+		return nil, err
+	}
+
+	return &refund, nil
+}
+
+// refundShare returns the part of total, of which refunded was already
+// given back, that goes with refunding amount of a payment of paid with
+// remaining still refundable.
+func refundShare(total, refunded, amount, remaining, paid models.Money) models.Money {
+	share := total - refunded
+	if amount < remaining {
+		share = min(total.Mul(float64(amount)/float64(paid)), share)
+	}
+	return share
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
+	"github.com/google/uuid"
+)
+
+// TestRefundShare refunds a payment of 22200 with 2200 tax and a 5000
+// voucher discount in three parts; together they must give back exactly the
+// tax and discount, however the amounts round.
+func TestRefundShare(t *testing.T) {
+	paid := models.NewMoney(22200)
+	tax := models.NewMoney(2200)
+	discount := models.NewMoney(5000)
+
+	var refundedTax, refundedDiscount, refunded models.Money
+	for _, amount := range []models.Money{models.NewMoney(10000), models.NewMoney(3333.33), paid - models.NewMoney(13333.33)} {
+		remaining := paid - refunded
+		refundedTax += refundShare(tax, refundedTax, amount, remaining, paid)
+		refundedDiscount += refundShare(discount, refundedDiscount, amount, remaining, paid)
+		refunded += amount
+	}
+
+	if refundedTax != tax {
+		t.Errorf("refunded tax = %s, want %s", refundedTax, tax)
+	}
+	if refundedDiscount != discount {
+		t.Errorf("refunded discount = %s, want %s", refundedDiscount, discount)
+	}
+
+	// Half the payment takes half the discount
+	if got := refundShare(discount, 0, paid/2, paid, paid); got != discount/2 {
+		t.Errorf("refundShare() for half the payment = %s, want %s", got, discount/2)
+	}
+}
+
+func TestRefundSessionRejectsPaymentsOutsideTheWallet(t *testing.T) {
+	paidAt := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		gateway  string
+		prepaid  models.Money
+		paidAt   *time.Time
+		rejected bool
+	}{
+		{"paid from the wallet", "wallet", 0, nil, false},
+		{"direct pay credited to the wallet", "midtrans", models.NewMoney(25000), &paidAt, false},
+		{"direct pay never credited", "midtrans", models.NewMoney(25000), nil, true},
+		{"charged by the gateway", "xendit", 0, &paidAt, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newMockDB(t)
+			sessionID := uuid.New()
+			mock.ExpectQuery(`SELECT \* FROM "payments" WHERE session_id = \$1`).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "session_id", "payment_gateway", "amount", "prepaid_amount", "paid_at", "status"}).
+					AddRow(uuid.New(), sessionID, tt.gateway, models.NewMoney(22200), tt.prepaid, tt.paidAt, models.PaymentSuccess))
+			mock.ExpectQuery(`SELECT "id","user_id","organization_id","status" FROM "charging_sessions"`).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "status"}).
+					AddRow(sessionID, uuid.New(), models.SessionCompleted))
+			if !tt.rejected {
+				// Refunds that pass the checks go on to sum the earlier refunds
+				mock.ExpectQuery(`SELECT COALESCE\(SUM\(tax\), 0\) AS tax, COALESCE\(SUM\(discount\), 0\) AS discount FROM "refunds"`).
+					WillReturnError(errors.New("stop"))
+			}
+
+			_, err := RefundSession(db, sessionID, 0, "test", nil)
+			if got := errors.Is(err, ErrRefundNotWallet); got != tt.rejected {
+				t.Errorf("RefundSession() error = %v, want rejected %v", err, tt.rejected)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
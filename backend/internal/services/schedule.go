@@ -0,0 +1,87 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
+)
+
+var (
+	ErrScheduleConflict  = errors.New("pilih salah satu: scheduled_start_at atau ready_by")
+	ErrScheduleInPast    = errors.New("waktu mulai terjadwal harus di masa depan")
+	ErrReadyByNeedsLimit = errors.New("ready_by membutuhkan target_kwh, max_cost, atau max_duration_minutes")
+)
+
+// readyByBuffer is the extra share of the estimated duration reserved before
+// a ready-by deadline to absorb slower-than-rated charging.
+const readyByBuffer = 0.1
+
+// EstimateDuration returns how long charging is expected to take at the
+// connector's rated power until the first energy, cost or duration limit is
+// reached, using the tariff's base rates for a cost limit. It returns 0 when
+// the session only has a SoC limit.
+func EstimateDuration(session *models.ChargingSession, connector models.Connector, tariff models.Tariff) time.Duration {
+	var estimate time.Duration
+	consider := func(d time.Duration) {
+		if d > 0 && (estimate == 0 || d < estimate) {
+			estimate = d
+		}
+	}
+
+	if connector.PowerKW > 0 {
+		if session.TargetKWH > 0 {
+			consider(time.Duration(session.TargetKWH / connector.PowerKW * float64(time.Hour)))
+		}
+		// Cost per hour at full power, including the per-minute time rate
+		hourlyCost := tariff.PricePerKWH.Mul(connector.PowerKW) + 60*tariff.PricePerMinute
+		if session.MaxCost > tariff.StartFee && hourlyCost > 0 {
+			hours := float64(session.MaxCost-tariff.StartFee) / float64(hourlyCost)
+			consider(time.Duration(hours * float64(time.Hour)))
+		}
+	}
+	if session.MaxDuration > 0 {
+		consider(time.Duration(session.MaxDuration) * time.Minute)
+	}
+
+	return estimate
+}
+
+// ResolveSchedule sets session.ScheduledAt and session.ReadyBy from an
+// explicit start time or a ready-by deadline. With a deadline the start is
+// brought forward by the estimated duration plus a small buffer; a deadline
+// too close to honour starts immediately (ScheduledAt nil).
+func ResolveSchedule(session *models.ChargingSession, connector models.Connector, tariff models.Tariff, startAt, readyBy *time.Time, now time.Time) error {
+	if startAt != nil && readyBy != nil {
+		return ErrScheduleConflict
+	}
+
+	session.ScheduledAt = nil
+	session.ReadyBy = nil
+
+	if startAt != nil {
+		if !startAt.After(now) {
+			return ErrScheduleInPast
+		}
+		session.ScheduledAt = startAt
+		return nil
+	}
+
+	if readyBy != nil {
+		duration := EstimateDuration(session, connector, tariff)
+		if duration == 0 {
+			return ErrReadyByNeedsLimit
+		}
+		if !readyBy.After(now) {
+			return ErrScheduleInPast
+		}
+
+		start := readyBy.Add(-duration - time.Duration(float64(duration)*readyByBuffer))
+		session.ReadyBy = readyBy
+		if start.After(now) {
+			session.ScheduledAt = &start
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,286 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrSessionClosed is returned when settling a session that another request
+// or charger report already closed.
+var ErrSessionClosed = errors.New("sesi sudah selesai")
+
+// ErrSessionNotWaiting is returned when starting or cancelling a session
+// that is no longer waiting to start, e.g. because another request started
+// or cancelled it first.
+var ErrSessionNotWaiting = errors.New("sesi sudah dimulai atau dibatalkan")
+
+// ClosedSessionStatuses are the statuses of sessions that no longer accept
+// charger updates.
+var ClosedSessionStatuses = []models.SessionStatus{models.SessionCompleted, models.SessionCancelled, models.SessionFailed}
+
+// SettleSession closes a charging or idle session at closedAt: it prices the
+// charging period under the connector's tariff, adds the idle fee, takes off
+// any voucher discount, adds service fee and tax, stores the line items,
+// marks the payment as paid, posts the wallet deduction to the ledger and
+// frees the connector. It must be called inside a transaction.
+func SettleSession(tx *gorm.DB, session *models.ChargingSession, closedAt time.Time) error {
+	return settle(tx, session, closedAt, models.SessionCompleted)
+}
+
+// FailSession closes a session whose charger reported an error. What was
+// delivered up to failedAt is billed like a normal settlement and the
+// connector is marked faulted. When no energy was delivered at all, the
+// whole payment is refunded automatically and the refund is returned. It
+// must be called inside a transaction.
+func FailSession(tx *gorm.DB, session *models.ChargingSession, failedAt time.Time) (*models.Refund, error) {
+	session.StopReason = models.StopError
+	if err := settle(tx, session, failedAt, models.SessionFailed); err != nil {
+		return nil, err
+	}
+	if session.EnergyKWH > 0 || session.TotalCost == 0 {
+		return nil, nil
+	}
+
+	refund, err := RefundSession(tx, session.ID, 0, "Sesi gagal tanpa energi tersalurkan", nil)
+	if err != nil {
+		return nil, err
+	}
+	activity := models.ActivityLog{
+		AdminName: "Sistem",
+		Action:    "Refund Otomatis",
+		Target:    session.ID.String(),
+		Detail:    fmt.Sprintf("Refund otomatis Rp %s untuk sesi gagal tanpa energi", refund.Amount),
+	}
+	if err := tx.Create(&activity).Error; err != nil {
+		return nil, err
+	}
+	return refund, nil
+}
+
+// CancelSession closes a pending or scheduled session that never started
+// charging: its payment is cancelled, a reserved voucher use is released
+// and a connector held for a scheduled start is freed. It returns
+// ErrSessionNotWaiting when the session was started or closed in the
+// meantime. It must be called inside a transaction.
+func CancelSession(tx *gorm.DB, session *models.ChargingSession, cancelledAt time.Time) error {
+	// Lock the session so a concurrent start, such as the scheduler's,
+	// either claims it first or not at all
+	var current models.ChargingSession
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "status").
+		First(&current, "id = ?", session.ID).Error; err != nil {
+		return err
+	}
+	if current.Status != models.SessionPending && current.Status != models.SessionScheduled {
+		return ErrSessionNotWaiting
+	}
+
+	session.Status = models.SessionCancelled
+	session.EndedAt = &cancelledAt
+	if err := tx.Omit(clause.Associations).Save(session).Error; err != nil {
+		return err
+	}
+
+	if err := tx.Model(&models.Payment{}).Where("session_id = ?", session.ID).
+		Update("status", models.PaymentCancelled).Error; err != nil {
+		return err
+	}
+
+	if err := ReleaseSessionVoucher(tx, session.ID); err != nil {
+		return err
+	}
+
+	return tx.Model(&models.Connector{}).
+		Where("id = ? AND status = ?", session.ConnectorID, models.ConnectorReserved).
+		Update("status", models.ConnectorAvailable).Error
+}
+
+// ExpirePendingSessions cancels wallet-paid sessions created before cutoff
+// whose payment was never confirmed, so abandoned checkouts give back their
+// voucher use. Sessions paid through a gateway are cancelled when the
+// provider reports their payment expired instead. It returns the sessions
+// it cancelled.
+func ExpirePendingSessions(db *gorm.DB, cutoff, now time.Time) ([]models.ChargingSession, error) {
+	var sessions []models.ChargingSession
+	if err := db.Where("status = ? AND created_at < ? AND id IN (?)", models.SessionPending, cutoff,
+		db.Model(&models.Payment{}).Select("session_id").
+			Where("payment_gateway = ? AND status = ?", "wallet", models.PaymentPending),
+	).Find(&sessions).Error; err != nil {
+		return nil, err
+	}
+
+	var expired []models.ChargingSession
+	for i := range sessions {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			return CancelSession(tx, &sessions[i], now)
+		})
+		if errors.Is(err, ErrSessionNotWaiting) {
+			continue
+		}
+		if err != nil {
+			return expired, err
+		}
+		expired = append(expired, sessions[i])
+	}
+	return expired, nil
+}
+
+func settle(tx *gorm.DB, session *models.ChargingSession, closedAt time.Time, status models.SessionStatus) error {
+	// Lock the session so that concurrent closes, such as a user STOP and
+	// the charger's complete report, bill it only once
+	var current models.ChargingSession
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "status", "charged_at").
+		First(&current, "id = ?", session.ID).Error; err != nil {
+		return err
+	}
+	if IsSessionClosed(current.Status) {
+		return ErrSessionClosed
+	}
+	// The charger may have reported complete since the caller loaded it
+	if session.ChargedAt == nil {
+		session.ChargedAt = current.ChargedAt
+	}
+
+	var connector models.Connector
+	if err := tx.Preload("Station").First(&connector, "id = ?", session.ConnectorID).Error; err != nil {
+		return err
+	}
+
+	// Bill under the tariff snapshot taken at session start, so price
+	// changes made mid-session do not re-price it
+	tariff, err := SessionTariff(tx, session, connector)
+	if err != nil {
+		return err
+	}
+
+	// Charging runs from start until the charger reported complete, or until
+	// the session closes if it never did
+	chargeEnd := closedAt
+	if session.ChargedAt != nil {
+		chargeEnd = *session.ChargedAt
+	}
+	chargeStart := chargeEnd
+	if session.StartedAt != nil {
+		chargeStart = *session.StartedAt
+	}
+	ApplyBreakdown(session, PriceCharging(tariff, session.EnergyKWH, chargeStart, chargeEnd, TariffLocation(tx)))
+
+	// Idle time runs from the charging-complete event until the session closes
+	session.IdleFee = 0
+	session.IdleMinutes = 0
+	if session.ChargedAt != nil && closedAt.After(*session.ChargedAt) {
+		policy := models.EffectiveIdleFee(connector, connector.Station)
+		idle := closedAt.Sub(*session.ChargedAt)
+		session.IdleMinutes = policy.BillableMinutes(idle)
+		session.IdleFee = policy.Fee(idle)
+	}
+
+	// Voucher discounts apply to the charging cost, not to the idle fee
+	session.Discount = 0
+	if session.VoucherID != nil {
+		var voucher models.Voucher
+		if err := tx.Unscoped().First(&voucher, "id = ?", *session.VoucherID).Error; err == nil {
+			session.Discount = VoucherDiscount(&voucher, ChargingCost(session), session.EnergyKWH, session.EnergyCost)
+			if err := tx.Model(&models.VoucherRedemption{}).Where("session_id = ?", session.ID).
+				Update("amount", session.Discount).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	rules := LoadChargeRules(tx)
+	ApplyCharges(session, rules)
+	session.Status = status
+	if status == models.SessionCompleted {
+		session.Progress = 100
+	}
+	session.EndedAt = &closedAt
+
+	if err := tx.Omit(clause.Associations).Save(session).Error; err != nil {
+		return err
+	}
+	if err := SaveLineItems(tx, session, rules); err != nil {
+		return err
+	}
+
+	// Update payment record with final cost
+	if err := tx.Model(&models.Payment{}).Where("session_id = ?", session.ID).
+		Updates(map[string]interface{}{
+			"amount":      session.TotalCost,
+			"discount":    session.Discount,
+			"service_fee": session.ServiceFee,
+			"tax":         session.Tax,
+			"status":      models.PaymentSuccess,
+		}).Error; err != nil {
+		return err
+	}
+
+	description := "Pembayaran pengisian daya"
+	if session.IdleFee > 0 {
+		description = "Pembayaran pengisian daya + biaya parkir (idle)"
+	}
+	transaction := models.WalletTransaction{
+		UserID:          session.UserID,
+		Amount:          session.TotalCost,
+		Discount:        session.Discount,
+		TransactionType: models.TransactionDeduction,
+		ReferenceID:     session.ID.String(),
+		SessionID:       &session.ID,
+		OrganizationID:  session.OrganizationID,
+		Description:     description,
+	}
+
+	// Deduct balance, from the organization's wallet for fleet sessions.
+	// Revenue is booked before the discount, which the platform carries as
+	// a promotion expense.
+	if session.TotalCost > 0 || session.Discount > 0 {
+		entry, err := Post(tx, models.LedgerCharge, session.ID.String(), description,
+			Debit(SessionAccountCode(session), session.TotalCost),
+			Debit(AccountPromotions, session.Discount),
+			Credit(AccountRevenue, session.TotalCost-session.Tax+session.Discount),
+			Credit(AccountTaxPayable, session.Tax),
+		)
+		if err != nil {
+			return err
+		}
+		transaction.LedgerTransactionID = &entry.ID
+	}
+
+	balance, err := sessionBalance(tx, session)
+	if err != nil {
+		return err
+	}
+	transaction.BalanceAfter = &balance
+	if err := tx.Create(&transaction).Error; err != nil {
+		return err
+	}
+
+	// Offline sessions are reported after the fact, when the connector has
+	// long moved on
+	if session.OfflineID != nil {
+		return nil
+	}
+
+	// Free connector, or take it out of service after a charger error
+	connectorStatus := models.ConnectorAvailable
+	if status == models.SessionFailed {
+		connectorStatus = models.ConnectorFault
+	}
+	if err := tx.Model(&models.Connector{}).Where("id = ?", connector.ID).
+		Update("status", connectorStatus).Error; err != nil {
+		return err
+	}
+	session.Connector.Status = connectorStatus
+
+	return nil
+}
+
+// IsSessionClosed reports whether a session no longer accepts charger updates.
+func IsSessionClosed(status models.SessionStatus) bool {
+	return slices.Contains(ClosedSessionStatuses, status)
+}
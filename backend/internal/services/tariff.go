@@ -0,0 +1,138 @@
+package services
+
+import (
+	"time"
+	_ "time/tzdata" // Tariff bands are evaluated in the configured timezone
+
+	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+const defaultTimezone = "Asia/Jakarta"
+
+// CostBreakdown is the priced result of a charging period under a tariff.
+type CostBreakdown struct {
+	EnergyCost models.Money `json:"energy_cost"`
+	TimeCost   models.Money `json:"time_cost"`
+	StartFee   models.Money `json:"start_fee"`
+	Adjustment models.Money `json:"price_adjustment"` // Brings the subtotal within the tariff's min/max price
+	Total      models.Money `json:"total"`
+}
+
+// ResolveTariff returns the tariff in force for a connector: the connector's
+// own tariff, then its station's, then a flat tariff built from the
+// connector price or the default_price_per_kwh system setting.
+func ResolveTariff(tx *gorm.DB, connector models.Connector) (models.Tariff, error) {
+	var tariff models.Tariff
+
+	tariffID := connector.TariffID
+	if tariffID == nil {
+		var station models.Station
+		if err := tx.Select("id", "tariff_id").First(&station, "id = ?", connector.StationID).Error; err == nil {
+			tariffID = station.TariffID
+		}
+	}
+
+	if tariffID != nil {
+		err := tx.Preload("Bands").First(&tariff, "id = ?", *tariffID).Error
+		if err == nil {
+			return tariff, nil
+		}
+		if err != gorm.ErrRecordNotFound {
+			return tariff, err
+		}
+	}
+
+	tariff.Name = "Flat"
+	tariff.PricePerKWH = connector.PricePerKWH
+	if tariff.PricePerKWH <= 0 {
+		tariff.PricePerKWH = DefaultPricePerKWH(tx)
+	}
+	return tariff, nil
+}
+
+// DefaultPricePerKWH reads the default_price_per_kwh system setting.
+func DefaultPricePerKWH(tx *gorm.DB) models.Money {
+	var cfg models.SystemConfig
+	if err := tx.First(&cfg, "config_key = ?", "default_price_per_kwh").Error; err != nil {
+		return 0
+	}
+	price, _ := models.ParseMoney(cfg.ConfigValue)
+	return price
+}
+
+// TariffLocation returns the timezone tariff bands are evaluated in, taken
+// from the timezone system setting.
+func TariffLocation(tx *gorm.DB) *time.Location {
+	name := defaultTimezone
+	var cfg models.SystemConfig
+	if err := tx.First(&cfg, "config_key = ?", "timezone").Error; err == nil && cfg.ConfigValue != "" {
+		name = cfg.ConfigValue
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
+// maxPricedSlices bounds the hourly slices PriceCharging walks through, so a
+// nonsensical period cannot keep it looping. The rest of a longer period is
+// priced at the rate in force where the walk stopped.
+const maxPricedSlices = 31 * 24
+
+// PriceCharging prices kwh delivered evenly between start and end. The
+// period is split at local hour boundaries so that each slice is billed at
+// the time-of-use rate in force during that hour. Energy and time cost are
+// summed in fractional minor units and rounded once each.
+func PriceCharging(tariff models.Tariff, kwh float64, start, end time.Time, loc *time.Location) CostBreakdown {
+	var b CostBreakdown
+	var energy, timeCost float64
+
+	duration := end.Sub(start)
+	if duration <= 0 {
+		perKWH, _ := tariff.RatesAt(start.In(loc))
+		energy = kwh * float64(perKWH)
+	} else {
+		cursor := start.In(loc)
+		stop := end.In(loc)
+		for slices := 1; cursor.Before(stop); slices++ {
+			next := time.Date(cursor.Year(), cursor.Month(), cursor.Day(), cursor.Hour()+1, 0, 0, 0, loc)
+			if next.After(stop) || slices == maxPricedSlices {
+				next = stop
+			}
+			slice := next.Sub(cursor)
+			perKWH, perMinute := tariff.RatesAt(cursor)
+			energy += kwh * (float64(slice) / float64(duration)) * float64(perKWH)
+			timeCost += slice.Minutes() * float64(perMinute)
+			cursor = next
+		}
+	}
+
+	b.EnergyCost = models.RoundMinor(energy)
+	b.TimeCost = models.RoundMinor(timeCost)
+	b.StartFee = tariff.StartFee
+
+	subtotal := b.EnergyCost + b.TimeCost + b.StartFee
+	b.Total = subtotal
+	if tariff.MinPrice > 0 && b.Total < tariff.MinPrice {
+		b.Total = tariff.MinPrice
+	}
+	if tariff.MaxPrice > 0 && b.Total > tariff.MaxPrice {
+		b.Total = tariff.MaxPrice
+	}
+	b.Adjustment = b.Total - subtotal
+
+	return b
+}
+
+// ApplyBreakdown copies the charging price components onto the session.
+// TotalCost covers charging only until ApplyCharges adds the idle fee,
+// discount, service fee and tax.
+func ApplyBreakdown(session *models.ChargingSession, b CostBreakdown) {
+	session.EnergyCost = b.EnergyCost
+	session.TimeCost = b.TimeCost
+	session.StartFee = b.StartFee
+	session.Adjustment = b.Adjustment
+	session.TotalCost = b.Total
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
+)
+
+func TestPriceCharging(t *testing.T) {
+	wib := time.FixedZone("WIB", 7*60*60)
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, 10, day, hour, minute, 0, 0, wib)
+	}
+
+	// Off-peak from 22:00 to 06:00 at half the energy and time rate
+	offPeak := models.Tariff{
+		PricePerKWH:    models.NewMoney(2000),
+		PricePerMinute: models.NewMoney(100),
+		Bands: []models.TariffBand{
+			{StartHour: 22, EndHour: 6, PricePerKWH: models.NewMoney(1000), PricePerMinute: models.NewMoney(50)},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		tariff     models.Tariff
+		kwh        float64
+		start, end time.Time
+		want       CostBreakdown
+	}{
+		{
+			name:   "within base hours",
+			tariff: offPeak, kwh: 10, start: at(19, 10, 0), end: at(19, 11, 0),
+			want: CostBreakdown{EnergyCost: models.NewMoney(20000), TimeCost: models.NewMoney(6000), Total: models.NewMoney(26000)},
+		},
+		{
+			name:   "split at the band start",
+			tariff: offPeak, kwh: 10, start: at(19, 21, 0), end: at(19, 23, 0),
+			want: CostBreakdown{EnergyCost: models.NewMoney(15000), TimeCost: models.NewMoney(9000), Total: models.NewMoney(24000)},
+		},
+		{
+			name:   "split mid-hour at the band start",
+			tariff: offPeak, kwh: 10, start: at(19, 21, 30), end: at(19, 22, 30),
+			want: CostBreakdown{EnergyCost: models.NewMoney(15000), TimeCost: models.NewMoney(4500), Total: models.NewMoney(19500)},
+		},
+		{
+			name:   "across midnight inside the band",
+			tariff: offPeak, kwh: 10, start: at(19, 23, 0), end: at(20, 1, 0),
+			want: CostBreakdown{EnergyCost: models.NewMoney(10000), TimeCost: models.NewMoney(6000), Total: models.NewMoney(16000)},
+		},
+		{
+			name:   "split at the band end",
+			tariff: offPeak, kwh: 10, start: at(20, 5, 0), end: at(20, 7, 0),
+			want: CostBreakdown{EnergyCost: models.NewMoney(15000), TimeCost: models.NewMoney(9000), Total: models.NewMoney(24000)},
+		},
+		{
+			name:   "no duration uses the rate at start",
+			tariff: offPeak, kwh: 2, start: at(19, 23, 0), end: at(19, 23, 0),
+			want: CostBreakdown{EnergyCost: models.NewMoney(2000), Total: models.NewMoney(2000)},
+		},
+		{
+			name:   "fractional energy is rounded once",
+			tariff: models.Tariff{PricePerKWH: models.NewMoney(2444.44)}, kwh: 1.5, start: at(19, 10, 0), end: at(19, 10, 30),
+			want: CostBreakdown{EnergyCost: models.NewMoney(3666.66), Total: models.NewMoney(3666.66)},
+		},
+		{
+			name:   "start fee and minimum price",
+			tariff: models.Tariff{PricePerKWH: models.NewMoney(2000), StartFee: models.NewMoney(5000), MinPrice: models.NewMoney(10000)},
+			kwh:    1, start: at(19, 10, 0), end: at(19, 10, 10),
+			want: CostBreakdown{EnergyCost: models.NewMoney(2000), StartFee: models.NewMoney(5000), Adjustment: models.NewMoney(3000), Total: models.NewMoney(10000)},
+		},
+		{
+			name:   "maximum price",
+			tariff: models.Tariff{PricePerKWH: models.NewMoney(2000), MaxPrice: models.NewMoney(50000)},
+			kwh:    40, start: at(19, 10, 0), end: at(19, 11, 0),
+			want: CostBreakdown{EnergyCost: models.NewMoney(80000), Adjustment: models.NewMoney(-30000), Total: models.NewMoney(50000)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Bands follow the tariff's timezone, not the one the times are in
+			got := PriceCharging(tt.tariff, tt.kwh, tt.start.UTC(), tt.end.UTC(), wib)
+			if got != tt.want {
+				t.Errorf("PriceCharging() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPriceChargingLongPeriod(t *testing.T) {
+	tariff := models.Tariff{
+		PricePerKWH:    models.NewMoney(2000),
+		PricePerMinute: models.NewMoney(1),
+		Bands: []models.TariffBand{
+			{StartHour: 22, EndHour: 6, PricePerKWH: models.NewMoney(2000), PricePerMinute: models.NewMoney(1)},
+		},
+	}
+	start := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(100, 0, 0)
+
+	// The walk stops after maxPricedSlices hours; at a flat rate the price
+	// is still exact
+	got := PriceCharging(tariff, 1000, start, end, time.UTC)
+	minutes := end.Sub(start).Minutes()
+	want := CostBreakdown{
+		EnergyCost: models.NewMoney(2000000),
+		TimeCost:   models.RoundMinor(minutes * 100),
+	}
+	want.Total = want.EnergyCost + want.TimeCost
+	if got != want {
+		t.Errorf("PriceCharging() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrTransferInvalid      = errors.New("jumlah transfer harus lebih dari 0 dan dalam rupiah bulat")
+	ErrTransferSelf         = errors.New("tidak dapat mentransfer saldo ke akun sendiri")
+	ErrTransferBlocked      = errors.New("akun Anda diblokir, transfer saldo tidak diizinkan")
+	ErrTransferRecipient    = errors.New("akun penerima tidak dapat menerima transfer")
+	ErrTransferBelowMin     = errors.New("jumlah transfer di bawah minimum")
+	ErrTransferAboveMax     = errors.New("jumlah transfer melebihi batas per transaksi")
+	ErrTransferDailyLimit   = errors.New("jumlah transfer melebihi batas transfer harian")
+	ErrTransferInsufficient = errors.New("saldo tidak mencukupi")
+)
+
+// activeSessionStatuses are the statuses of sessions that will still be
+// settled from the wallet.
+var activeSessionStatuses = []models.SessionStatus{
+	models.SessionPending, models.SessionPaid, models.SessionScheduled, models.SessionCharging, models.SessionIdle,
+}
+
+// TransferLimits bounds wallet-to-wallet transfers. Zero limits are not
+// enforced.
+type TransferLimits struct {
+	Min   models.Money `json:"min"`   // Per transfer
+	Max   models.Money `json:"max"`   // Per transfer
+	Daily models.Money `json:"daily"` // Sent per sender per calendar day
+}
+
+// WalletTransfer is a transfer between two wallets, recorded as a pair of
+// wallet transactions sharing its ID as reference.
+type WalletTransfer struct {
+	ID        uuid.UUID
+	Amount    models.Money
+	Sender    *models.WalletTransaction
+	Recipient *models.WalletTransaction
+}
+
+// TransferBalance moves amount from the sender's wallet to the recipient's.
+// Both wallets are locked before the checks, so the balance and the daily
+// limit cannot change until the transfer is booked. The estimated cost of
+// the sender's active sessions stays in the wallet, since they are settled
+// from it. It must be called inside a transaction.
+func TransferBalance(tx *gorm.DB, senderID, recipientID uuid.UUID, amount models.Money, note string, limits TransferLimits, now time.Time) (*WalletTransfer, error) {
+	if amount <= 0 || amount.Minor()%100 != 0 {
+		return nil, ErrTransferInvalid
+	}
+	if senderID == recipientID {
+		return nil, ErrTransferSelf
+	}
+	if limits.Min > 0 && amount < limits.Min {
+		return nil, ErrTransferBelowMin
+	}
+	if limits.Max > 0 && amount > limits.Max {
+		return nil, ErrTransferAboveMax
+	}
+
+	var sender, recipient models.User
+	if err := tx.First(&sender, "id = ?", senderID).Error; err != nil {
+		return nil, err
+	}
+	if sender.Status == "blocked" {
+		return nil, ErrTransferBlocked
+	}
+	if err := tx.First(&recipient, "id = ?", recipientID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrTransferRecipient
+		}
+		return nil, err
+	}
+	if recipient.Status == "blocked" {
+		return nil, ErrTransferRecipient
+	}
+
+	// Lock in code order like Post does, so opposite transfers cannot
+	// deadlock
+	codes := []string{WalletAccountCode(senderID), WalletAccountCode(recipientID)}
+	sort.Strings(codes)
+	accounts := map[string]*models.LedgerAccount{}
+	for _, code := range codes {
+		account, err := lockAccount(tx, code)
+		if err != nil {
+			return nil, err
+		}
+		accounts[code] = account
+	}
+
+	if limits.Daily > 0 {
+		local := now.In(TariffLocation(tx))
+		dayStart := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, local.Location())
+		var sent models.Money
+		if err := tx.Model(&models.WalletTransaction{}).
+			Where("user_id = ? AND transaction_type = ? AND created_at >= ?", senderID, models.TransactionTransferOut, dayStart).
+			Select("COALESCE(SUM(amount), 0)").Row().Scan(&sent); err != nil {
+			return nil, err
+		}
+		if sent+amount > limits.Daily {
+			return nil, ErrTransferDailyLimit
+		}
+	}
+
+	var reserved models.Money
+	if err := tx.Model(&models.ChargingSession{}).
+		Where("user_id = ? AND organization_id IS NULL AND status IN ?", senderID, activeSessionStatuses).
+		Select("COALESCE(SUM(total_cost), 0)").Row().Scan(&reserved); err != nil {
+		return nil, err
+	}
+	if accounts[WalletAccountCode(senderID)].Balance-reserved < amount {
+		return nil, ErrTransferInsufficient
+	}
+
+	transfer := &WalletTransfer{ID: uuid.New(), Amount: amount}
+	suffix := ""
+	if note != "" {
+		suffix = ": " + note
+	}
+	entry, err := Post(tx, models.LedgerTransfer, transfer.ID.String(),
+		"Transfer saldo dari "+sender.Name+" ke "+recipient.Name,
+		Debit(WalletAccountCode(senderID), amount),
+		Credit(WalletAccountCode(recipientID), amount),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	transfer.Sender, err = recordTransfer(tx, senderID, amount, models.TransactionTransferOut,
+		transfer.ID, entry.ID, "Transfer ke "+recipient.Name+suffix)
+	if err != nil {
+		return nil, err
+	}
+	transfer.Recipient, err = recordTransfer(tx, recipientID, amount, models.TransactionTransferIn,
+		transfer.ID, entry.ID, "Transfer dari "+sender.Name+suffix)
+	if err != nil {
+		return nil, err
+	}
+	return transfer, nil
+}
+
+func recordTransfer(tx *gorm.DB, userID uuid.UUID, amount models.Money, txType models.TransactionType, transferID, entryID uuid.UUID, description string) (*models.WalletTransaction, error) {
+	balance, err := WalletBalance(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	transaction := models.WalletTransaction{
+		UserID:              userID,
+		Amount:              amount,
+		TransactionType:     txType,
+		ReferenceID:         transferID.String(),
+		LedgerTransactionID: &entryID,
+		BalanceAfter:        &balance,
+		Description:         description,
+	}
+	if err := tx.Create(&transaction).Error; err != nil {
+		return nil, err
+	}
+	return &transaction, nil
+}
@@ -0,0 +1,195 @@
+package services
+
+import (
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestTransferBalanceLimits(t *testing.T) {
+	sender, recipient := uuid.New(), uuid.New()
+	limits := TransferLimits{Min: models.NewMoney(10000), Max: models.NewMoney(1000000)}
+
+	tests := []struct {
+		name      string
+		recipient uuid.UUID
+		amount    models.Money
+		limits    TransferLimits
+		wantErr   error
+	}{
+		{"zero amount", recipient, 0, TransferLimits{}, ErrTransferInvalid},
+		{"negative amount", recipient, models.NewMoney(-10000), TransferLimits{}, ErrTransferInvalid},
+		{"fraction of a rupiah", recipient, models.NewMoney(10000.50), TransferLimits{}, ErrTransferInvalid},
+		{"to own wallet", sender, models.NewMoney(10000), TransferLimits{}, ErrTransferSelf},
+		{"below minimum", recipient, models.NewMoney(9999), limits, ErrTransferBelowMin},
+		{"above maximum", recipient, models.NewMoney(1000001), limits, ErrTransferAboveMax},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A nil transaction panics if the checks get as far as the database
+			_, err := TransferBalance(nil, sender, tt.recipient, tt.amount, "", tt.limits, time.Now())
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("TransferBalance() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// errPosted stands in for the first query of the ledger posting, so a test
+// can tell that a transfer passed every check without mocking the booking.
+var errPosted = errors.New("posting started")
+
+func TestTransferBalanceChecks(t *testing.T) {
+	senderID, recipientID := uuid.New(), uuid.New()
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name            string
+		senderStatus    string
+		recipientStatus string // Empty when the recipient does not exist
+		balance         models.Money
+		daily           models.Money
+		sentToday       models.Money
+		reserved        models.Money
+		amount          models.Money
+		wantErr         error
+	}{
+		{
+			name:         "sender blocked",
+			senderStatus: "blocked", recipientStatus: "active",
+			amount: models.NewMoney(10000), wantErr: ErrTransferBlocked,
+		},
+		{
+			name:         "recipient does not exist",
+			senderStatus: "active",
+			amount:       models.NewMoney(10000), wantErr: ErrTransferRecipient,
+		},
+		{
+			name:         "recipient blocked",
+			senderStatus: "active", recipientStatus: "blocked",
+			amount: models.NewMoney(10000), wantErr: ErrTransferRecipient,
+		},
+		{
+			name:         "enough balance",
+			senderStatus: "active", recipientStatus: "active",
+			balance: models.NewMoney(100000), amount: models.NewMoney(50000), wantErr: errPosted,
+		},
+		{
+			name:         "more than the balance",
+			senderStatus: "active", recipientStatus: "active",
+			balance: models.NewMoney(40000), amount: models.NewMoney(50000), wantErr: ErrTransferInsufficient,
+		},
+		{
+			name:         "balance reserved for active sessions",
+			senderStatus: "active", recipientStatus: "active",
+			balance: models.NewMoney(100000), reserved: models.NewMoney(60000), amount: models.NewMoney(50000), wantErr: ErrTransferInsufficient,
+		},
+		{
+			name:         "exactly the unreserved balance",
+			senderStatus: "active", recipientStatus: "active",
+			balance: models.NewMoney(100000), reserved: models.NewMoney(50000), amount: models.NewMoney(50000), wantErr: errPosted,
+		},
+		{
+			name:         "within the daily limit",
+			senderStatus: "active", recipientStatus: "active",
+			balance: models.NewMoney(100000), daily: models.NewMoney(100000), sentToday: models.NewMoney(70000), amount: models.NewMoney(30000), wantErr: errPosted,
+		},
+		{
+			name:         "over the daily limit",
+			senderStatus: "active", recipientStatus: "active",
+			balance: models.NewMoney(100000), daily: models.NewMoney(100000), sentToday: models.NewMoney(80000), amount: models.NewMoney(30000), wantErr: ErrTransferDailyLimit,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newMockDB(t)
+
+			// The queries TransferBalance runs before it gives up or starts posting
+			func() {
+				mock.ExpectQuery(`SELECT \* FROM "users" WHERE id = \$1`).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "name", "status"}).AddRow(senderID, "Andi", tt.senderStatus))
+				if tt.senderStatus == "blocked" {
+					return
+				}
+				if tt.recipientStatus == "" {
+					mock.ExpectQuery(`SELECT \* FROM "users" WHERE id = \$1`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+					return
+				}
+				mock.ExpectQuery(`SELECT \* FROM "users" WHERE id = \$1`).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "name", "status"}).AddRow(recipientID, "Budi", tt.recipientStatus))
+				if tt.recipientStatus == "blocked" {
+					return
+				}
+
+				expectLockedWallets(mock, map[string]models.Money{
+					WalletAccountCode(senderID):    tt.balance,
+					WalletAccountCode(recipientID): models.NewMoney(5000),
+				})
+				if tt.daily > 0 {
+					mock.ExpectQuery(`SELECT \* FROM "system_configs" WHERE config_key = \$1`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+					mock.ExpectQuery(`SELECT COALESCE\(SUM\(amount\), 0\) FROM "wallet_transactions"`).
+						WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(int64(tt.sentToday)))
+					if tt.wantErr == ErrTransferDailyLimit {
+						return
+					}
+				}
+				mock.ExpectQuery(`SELECT COALESCE\(SUM\(total_cost\), 0\) FROM "charging_sessions"`).
+					WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(int64(tt.reserved)))
+				if tt.wantErr == errPosted {
+					mock.ExpectQuery(`SELECT \* FROM "ledger_accounts"`).WillReturnError(errPosted)
+				}
+			}()
+
+			limits := TransferLimits{Daily: tt.daily}
+			_, err := TransferBalance(db, senderID, recipientID, tt.amount, "", limits, now)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("TransferBalance() error = %v, want %v", err, tt.wantErr)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// expectLockedWallets expects both wallet accounts to be locked in code
+// order, returning the given balances.
+func expectLockedWallets(mock sqlmock.Sqlmock, balances map[string]models.Money) {
+	codes := make([]string, 0, len(balances))
+	for code := range balances {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		mock.ExpectQuery(`SELECT \* FROM "ledger_accounts" WHERE code = \$1 .*FOR UPDATE`).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "code", "balance"}).AddRow(uuid.New(), code, int64(balances[code])))
+	}
+}
+
+func newMockDB(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	t.Helper()
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{
+		SkipDefaultTransaction: true,
+		Logger:                 logger.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, mock
+}
@@ -0,0 +1,42 @@
+package services
+
+import (
+	"errors"
+
+	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
+)
+
+var ErrVehicleIncompatible = errors.New("kendaraan tidak mendukung tipe konektor ini")
+
+// ApplyVehicle records the vehicle a session charges and fits the session to
+// it: the connector must be one the vehicle can plug into, and the energy
+// target is capped at the battery capacity. It returns the connector as the
+// vehicle sees it, with its power lowered to what the vehicle accepts, for
+// duration and cost estimates.
+func ApplyVehicle(session *models.ChargingSession, connector models.Connector, vehicle *models.Vehicle) (models.Connector, error) {
+	if !vehicle.Supports(connector.ConnectorType) {
+		return connector, ErrVehicleIncompatible
+	}
+
+	session.VehicleID = &vehicle.ID
+	if session.VehiclePlate == "" {
+		session.VehiclePlate = vehicle.Plate
+	}
+	if vehicle.BatteryKWH > 0 && session.TargetKWH > vehicle.BatteryKWH {
+		session.TargetKWH = vehicle.BatteryKWH
+	}
+
+	return VehicleConnector(connector, vehicle), nil
+}
+
+// VehicleConnector returns the connector with its power capped at what the
+// vehicle accepts on it. A vehicle without a known limit leaves it as is.
+func VehicleConnector(connector models.Connector, vehicle *models.Vehicle) models.Connector {
+	if vehicle == nil {
+		return connector
+	}
+	if limit := vehicle.MaxPowerKW(connector.ConnectorType); limit > 0 && limit < connector.PowerKW {
+		connector.PowerKW = limit
+	}
+	return connector
+}
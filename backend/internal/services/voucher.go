@@ -0,0 +1,176 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrVoucherNotFound    = errors.New("kode voucher tidak ditemukan")
+	ErrVoucherInactive    = errors.New("voucher tidak aktif atau di luar masa berlaku")
+	ErrVoucherExhausted   = errors.New("kuota voucher sudah habis")
+	ErrVoucherUserLimit   = errors.New("batas penggunaan voucher untuk akun Anda sudah tercapai")
+	ErrVoucherRestricted  = errors.New("voucher tidak berlaku untuk stasiun atau konektor ini")
+	ErrVoucherWrongUsage  = errors.New("voucher ini tidak dapat digunakan dengan cara ini")
+	ErrVoucherZeroBalance = errors.New("voucher tidak memiliki nilai")
+)
+
+// FindVoucher looks up an active voucher by code and checks its validity
+// window and usage limits for the user. With lock set the voucher row is
+// locked for the rest of the transaction so concurrent redemptions cannot
+// exceed the limits.
+func FindVoucher(tx *gorm.DB, code string, userID uuid.UUID, now time.Time, lock bool) (*models.Voucher, error) {
+	query := tx
+	if lock {
+		query = query.Clauses(clause.Locking{Strength: "UPDATE"})
+	}
+
+	var voucher models.Voucher
+	if err := query.First(&voucher, "UPPER(code) = ?", strings.ToUpper(strings.TrimSpace(code))).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrVoucherNotFound
+		}
+		return nil, err
+	}
+
+	if !voucher.IsActive ||
+		(voucher.ValidFrom != nil && now.Before(*voucher.ValidFrom)) ||
+		(voucher.ValidUntil != nil && now.After(*voucher.ValidUntil)) {
+		return nil, ErrVoucherInactive
+	}
+
+	if voucher.UsageLimit > 0 {
+		var used int64
+		tx.Model(&models.VoucherRedemption{}).Where("voucher_id = ?", voucher.ID).Count(&used)
+		if used >= int64(voucher.UsageLimit) {
+			return nil, ErrVoucherExhausted
+		}
+	}
+	if voucher.PerUserLimit > 0 {
+		var used int64
+		tx.Model(&models.VoucherRedemption{}).Where("voucher_id = ? AND user_id = ?", voucher.ID, userID).Count(&used)
+		if used >= int64(voucher.PerUserLimit) {
+			return nil, ErrVoucherUserLimit
+		}
+	}
+
+	return &voucher, nil
+}
+
+// CheckVoucherForConnector verifies a session voucher may be used on the
+// connector.
+func CheckVoucherForConnector(voucher *models.Voucher, connector models.Connector) error {
+	if voucher.Type == models.VoucherCredit {
+		return ErrVoucherWrongUsage
+	}
+	if voucher.StationID != nil && *voucher.StationID != connector.StationID {
+		return ErrVoucherRestricted
+	}
+	if voucher.ConnectorType != "" && !strings.EqualFold(voucher.ConnectorType, connector.ConnectorType) {
+		return ErrVoucherRestricted
+	}
+	return nil
+}
+
+// VoucherDiscount returns the discount a session voucher grants on the
+// charging cost. Free kWh are valued at the session's average energy price.
+func VoucherDiscount(voucher *models.Voucher, chargingCost models.Money, energyKWH float64, energyCost models.Money) models.Money {
+	var discount models.Money
+	switch voucher.Type {
+	case models.VoucherPercentage:
+		discount = chargingCost.Percent(voucher.Percent)
+		if voucher.MaxDiscount > 0 && discount > voucher.MaxDiscount {
+			discount = voucher.MaxDiscount
+		}
+	case models.VoucherFixed:
+		discount = voucher.Amount
+	case models.VoucherFreeKWH:
+		if energyKWH > 0 {
+			free := voucher.FreeKWH
+			if free > energyKWH {
+				free = energyKWH
+			}
+			discount = energyCost.Mul(free / energyKWH)
+		}
+	}
+
+	if discount > chargingCost {
+		discount = chargingCost
+	}
+	if discount < 0 {
+		discount = 0
+	}
+	return discount
+}
+
+// RunningDiscount returns the voucher discount on the charging cost so far,
+// or 0 for a session without a voucher. It keeps the running total, and so
+// the max_cost limit, at what the customer pays; settlement works out the
+// final discount the same way.
+func RunningDiscount(tx *gorm.DB, session *models.ChargingSession) models.Money {
+	if session.VoucherID == nil {
+		return 0
+	}
+	var voucher models.Voucher
+	if err := tx.Unscoped().First(&voucher, "id = ?", *session.VoucherID).Error; err != nil {
+		return 0
+	}
+	return VoucherDiscount(&voucher, ChargingCost(session), session.EnergyKWH, session.EnergyCost)
+}
+
+// ReserveSessionVoucher records the voucher use for a new session so it
+// counts towards the usage limits right away.
+func ReserveSessionVoucher(tx *gorm.DB, voucher *models.Voucher, session *models.ChargingSession) error {
+	redemption := models.VoucherRedemption{
+		VoucherID: voucher.ID,
+		UserID:    session.UserID,
+		SessionID: &session.ID,
+	}
+	return tx.Create(&redemption).Error
+}
+
+// ReleaseSessionVoucher frees the voucher use of a session that never
+// charged, e.g. after cancellation.
+func ReleaseSessionVoucher(tx *gorm.DB, sessionID uuid.UUID) error {
+	return tx.Where("session_id = ?", sessionID).Delete(&models.VoucherRedemption{}).Error
+}
+
+// RedeemVoucherToWallet credits a credit voucher to the user's wallet from
+// the promotions account and records the redemption. It must be called
+// inside a transaction.
+func RedeemVoucherToWallet(tx *gorm.DB, code string, userID uuid.UUID, now time.Time) (*models.VoucherRedemption, error) {
+	voucher, err := FindVoucher(tx, code, userID, now, true)
+	if err != nil {
+		return nil, err
+	}
+	if voucher.Type != models.VoucherCredit {
+		return nil, ErrVoucherWrongUsage
+	}
+	credit := voucher.Amount
+	if credit <= 0 {
+		return nil, ErrVoucherZeroBalance
+	}
+
+	redemption := models.VoucherRedemption{
+		VoucherID: voucher.ID,
+		UserID:    userID,
+		Amount:    credit,
+	}
+	if err := tx.Create(&redemption).Error; err != nil {
+		return nil, err
+	}
+
+	if _, err := CreditWallet(tx, userID, credit, AccountPromotions, models.LedgerPromo, models.TransactionPromo,
+		redemption.ID.String(), "Kredit voucher "+voucher.Code); err != nil {
+		return nil, err
+	}
+
+	redemption.Voucher = *voucher
+	return &redemption, nil
+}
@@ -0,0 +1,36 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/Julianarwansah/sistemcharging/backend/internal/models"
+)
+
+// TestVoucherDiscount values a 10 kWh session at 2000/kWh plus a 5000 start
+// fee with each session voucher type.
+func TestVoucherDiscount(t *testing.T) {
+	energyCost := models.NewMoney(20000)
+	chargingCost := energyCost + models.NewMoney(5000)
+
+	tests := []struct {
+		name    string
+		voucher models.Voucher
+		want    models.Money
+	}{
+		{"percentage", models.Voucher{Type: models.VoucherPercentage, Percent: 20}, models.NewMoney(5000)},
+		{"percentage capped", models.Voucher{Type: models.VoucherPercentage, Percent: 20, MaxDiscount: models.NewMoney(3000)}, models.NewMoney(3000)},
+		{"fixed", models.Voucher{Type: models.VoucherFixed, Amount: models.NewMoney(7500.50)}, models.NewMoney(7500.50)},
+		{"fixed above the cost", models.Voucher{Type: models.VoucherFixed, Amount: models.NewMoney(30000)}, chargingCost},
+		{"free kWh", models.Voucher{Type: models.VoucherFreeKWH, FreeKWH: 2.5}, models.NewMoney(5000)},
+		{"free kWh above the energy", models.Voucher{Type: models.VoucherFreeKWH, FreeKWH: 50}, energyCost},
+		{"credit", models.Voucher{Type: models.VoucherCredit, Amount: models.NewMoney(10000)}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VoucherDiscount(&tt.voucher, chargingCost, 10, energyCost); got != tt.want {
+				t.Errorf("VoucherDiscount() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
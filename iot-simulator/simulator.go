@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
@@ -26,6 +27,7 @@ type ChargerStatus struct {
 	EnergyKWH float64 `json:"energy_kwh"`
 	PowerKW   float64 `json:"power_kw"`
 	Progress  int     `json:"progress"`
+	SoC       int     `json:"soc"`
 	SessionID string  `json:"session_id"`
 }
 
@@ -37,6 +39,13 @@ type ChargerSimulator struct {
 	energyKWH float64
 	powerKW   float64
 	targetKWH float64
+	// batteryKWH and startSoC model the plugged-in vehicle so the backend
+	// can enforce target SoC limits
+	batteryKWH float64
+	startSoC   float64
+	// unplugDelay is how long the simulated vehicle stays plugged in after
+	// charging completes; the backend bills idle time until "unplugged"
+	unplugDelay time.Duration
 }
 
 func main() {
@@ -45,11 +54,15 @@ func main() {
 	mqttUser  := getEnv("MQTT_USER", "")
 	mqttPass  := getEnv("MQTT_PASS", "")
 	httpPort  := getEnv("SERVER_PORT", "7860")
+	unplugSec, _ := strconv.Atoi(getEnv("UNPLUG_DELAY_SECONDS", "30"))
+	batteryKWH, _ := strconv.ParseFloat(getEnv("BATTERY_KWH", "10"), 64)
 
 	sim := &ChargerSimulator{
 		chargerID: chargerID,
 		powerKW:   3.3, // Default 3.3 kW
 		targetKWH: 5.0, // Default target 5 kWh
+		batteryKWH:  batteryKWH,
+		unplugDelay: time.Duration(unplugSec) * time.Second,
 	}
 
 	opts := mqtt.NewClientOptions().
@@ -144,9 +157,12 @@ func (s *ChargerSimulator) startCharging(sessionID string, targetKWH float64) {
 	s.charging = true
 	s.sessionID = sessionID
 	s.energyKWH = 0
+	s.startSoC = 20 + rand.Float64()*30 // Vehicle arrives with 20-50% battery
 	s.targetKWH = targetKWH
 	if s.targetKWH <= 0 {
-		s.targetKWH = 5.0 // Fallback
+		// No energy target: the backend enforces cost/duration/SoC limits,
+		// so charge until the battery is full
+		s.targetKWH = s.batteryKWH * (100 - s.startSoC) / 100
 	}
 
 	log.Printf("⚡ Starting charging session: %s (Target: %.2f kWh)", sessionID, targetKWH)
@@ -177,6 +193,7 @@ func (s *ChargerSimulator) startCharging(sessionID string, targetKWH float64) {
 				s.publishStatusWithSession("complete", 100)
 				s.charging = false
 				log.Printf("✅ Charging complete! Total: %.3f kWh", s.energyKWH)
+				s.scheduleUnplug(s.sessionID)
 				return
 			}
 
@@ -195,6 +212,20 @@ func (s *ChargerSimulator) stopCharging() {
 	s.charging = false
 	s.publishStatusWithSession("complete", 100)
 	log.Printf("🛑 Charging stopped. Total: %.3f kWh", s.energyKWH)
+	s.scheduleUnplug(s.sessionID)
+}
+
+// scheduleUnplug simulates the driver unplugging the vehicle some time after
+// charging finished, which ends the idle period on the backend.
+func (s *ChargerSimulator) scheduleUnplug(sessionID string) {
+	go func() {
+		time.Sleep(s.unplugDelay)
+		if s.charging || s.sessionID != sessionID {
+			return
+		}
+		s.publishStatusWithSession("unplugged", 100)
+		log.Printf("🔌 Vehicle unplugged (session: %s)", sessionID)
+	}()
 }
 
 func (s *ChargerSimulator) publishStatus(status string, progress int, energyKWH float64) {
@@ -217,6 +248,7 @@ func (s *ChargerSimulator) publishStatusWithSession(status string, progress int)
 		EnergyKWH: s.energyKWH,
 		PowerKW:   s.powerKW,
 		Progress:  progress,
+		SoC:       s.soc(),
 		SessionID: s.sessionID,
 	}
 
@@ -226,6 +258,13 @@ func (s *ChargerSimulator) publishStatusWithSession(status string, progress int)
 	s.client.Publish(topic, 1, false, data)
 }
 
+func (s *ChargerSimulator) soc() int {
+	if s.batteryKWH <= 0 {
+		return 0
+	}
+	return int(math.Min(s.startSoC+(s.energyKWH/s.batteryKWH)*100, 100))
+}
+
 func getEnv(key, fallback string) string {
 	if val, ok := os.LookupEnv(key); ok {
 		return val